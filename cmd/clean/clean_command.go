@@ -14,6 +14,7 @@ import (
 var (
 	dryRun                 bool
 	eligibleForCleaningAge time.Duration
+	checkpointDirectory    string
 )
 
 // Command is the command for cleaning a directory.
@@ -35,6 +36,11 @@ var Command = &cli.Command{
 			Aliases:     []string{"cleaning-age"},
 			Destination: &eligibleForCleaningAge,
 		},
+		&cli.StringFlag{
+			Name:        "checkpoint-directory",
+			Usage:       "Keep the .part files of the downloads which can be resumed from the checkpoints of this directory.",
+			Destination: &checkpointDirectory,
+		},
 	},
 	Action: func(_ context.Context, cmd *cli.Command) error {
 		path := cmd.Args().First()
@@ -50,6 +56,9 @@ var Command = &cli.Command{
 		if dryRun {
 			opts = append(opts, cleaner.WithDryRun())
 		}
+		if checkpointDirectory != "" {
+			opts = append(opts, cleaner.WithCheckpointDirectory(checkpointDirectory))
+		}
 
 		return cleaner.Clean(path, opts...)
 	},
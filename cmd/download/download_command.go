@@ -21,14 +21,17 @@ import (
 )
 
 var (
-	downloadParams    = fc2.Params{}
-	maxTries          int
-	loop              bool
-	qualityRaw        string
-	latencyRaw        string
-	noRemux           bool
-	noDeleteCorrupted bool
-	noWait            bool
+	downloadParams      = fc2.Params{}
+	maxTries            int
+	loop                bool
+	qualityRaw          string
+	latencyRaw          string
+	noRemux             bool
+	noDeleteCorrupted   bool
+	noWait              bool
+	noWriteReport       bool
+	noValidateFragments bool
+	noWriteChapters     bool
 )
 
 // Command is the command for downloading a live FC2 stream.
@@ -58,6 +61,13 @@ var Command = &cli.Command{
 			Usage:       "Golang templating format. Available fields: ChannelID, ChannelName, Date, Time, Title, Ext, Labels.Key.\nAvailable format options:\n  ChannelID: ID of the broadcast\n  ChannelName: broadcaster's profile name\n  Date: local date YYYY-MM-DD\n  Time: local time HHMMSS\n  Ext: file extension\n  Title: title of the live broadcast\n  Labels.Key: custom labels\n",
 			Destination: &downloadParams.OutFormat,
 		},
+		&cli.StringFlag{
+			Name:        "scratch-directory",
+			Value:       "",
+			Category:    "Post-Processing:",
+			Usage:       "Directory where the stream is downloaded and post-processed before moving the final files to the output format location. Empty value means no scratch directory.",
+			Destination: &downloadParams.ScratchDirectory,
+		},
 		&cli.IntFlag{
 			Name:        "max-packet-loss",
 			Value:       20,
@@ -65,6 +75,34 @@ var Command = &cli.Command{
 			Usage:       "Allow a maximum of packet loss before aborting stream download.",
 			Destination: &downloadParams.PacketLossMax,
 		},
+		&cli.IntFlag{
+			Name:        "fragment-concurrency",
+			Value:       1,
+			Category:    "Streaming:",
+			Usage:       "Number of fragments downloaded concurrently. The fragments are still written in order.",
+			Destination: &downloadParams.FragmentConcurrency,
+		},
+		&cli.IntFlag{
+			Name:        "fragment-retries",
+			Value:       2,
+			Category:    "Streaming:",
+			Usage:       "Number of retries of a fragment before counting it as a packet loss.",
+			Destination: &downloadParams.FragmentRetries,
+		},
+		&cli.BoolFlag{
+			Name:        "no-validate-fragments",
+			Value:       false,
+			Category:    "Streaming:",
+			Usage:       "Do not check that the fragments are valid MPEG-TS before writing them.",
+			Destination: &noValidateFragments,
+		},
+		&cli.DurationFlag{
+			Name:        "stall-timeout",
+			Value:       30 * time.Second,
+			Category:    "Streaming:",
+			Usage:       "Abort the download if there is no new fragment for this duration.",
+			Destination: &downloadParams.StallTimeout,
+		},
 		&cli.BoolFlag{
 			Name:     "no-remux",
 			Value:    false,
@@ -122,6 +160,13 @@ var Command = &cli.Command{
 			Aliases:     []string{"x"},
 			Destination: &downloadParams.ExtractAudio,
 		},
+		&cli.StringFlag{
+			Name:        "checkpoint-directory",
+			Value:       "",
+			Category:    "Streaming:",
+			Usage:       "Directory where the download checkpoints are saved to resume an interrupted download. Empty value means no checkpoint.",
+			Destination: &downloadParams.CheckpointDirectory,
+		},
 		&cli.StringFlag{
 			Name:        "cookies-file",
 			Usage:       "Path to a cookies file. Format is a netscape cookies file.",
@@ -135,6 +180,41 @@ var Command = &cli.Command{
 			Usage:       "Save live chat into a json file.",
 			Destination: &downloadParams.WriteChat,
 		},
+		&cli.BoolFlag{
+			Name:        "write-events",
+			Value:       false,
+			Category:    "Streaming:",
+			Usage:       "Save every websocket event (gifts, viewer counts, control messages...) with its receive time into a json file.",
+			Destination: &downloadParams.WriteEvents,
+		},
+		&cli.BoolFlag{
+			Name:        "write-timeline",
+			Value:       false,
+			Category:    "Streaming:",
+			Usage:       "Save the changes of title, category and viewer count during the recording into a json file.",
+			Destination: &downloadParams.WriteTimeline,
+		},
+		&cli.StringFlag{
+			Name:        "convert-chat",
+			Value:       "",
+			Category:    "Post-Processing:",
+			Usage:       "Convert the live chat into subtitles: ass (scrolling comments) or srt. Needs --write-chat. Empty value means no conversion.",
+			Destination: &downloadParams.ConvertChat,
+		},
+		&cli.BoolFlag{
+			Name:        "embed-chat",
+			Value:       false,
+			Category:    "Post-Processing:",
+			Usage:       "Embed the live chat as a subtitle track into the remuxed and concatenated videos. Needs --write-chat.",
+			Destination: &downloadParams.EmbedChat,
+		},
+		&cli.BoolFlag{
+			Name:        "no-write-chapters",
+			Value:       false,
+			Category:    "Post-Processing:",
+			Usage:       "Do not write chapters (recording parts and title changes) into the remuxed and concatenated videos.",
+			Destination: &noWriteChapters,
+		},
 		&cli.BoolFlag{
 			Name:        "write-info-json",
 			Value:       false,
@@ -149,6 +229,13 @@ var Command = &cli.Command{
 			Usage:       "Download thumbnail into a file.",
 			Destination: &downloadParams.WriteThumbnail,
 		},
+		&cli.BoolFlag{
+			Name:        "no-write-report",
+			Value:       false,
+			Category:    "Streaming:",
+			Usage:       "Do not write the integrity report (fragments, gaps and quality switches) into a json file.",
+			Destination: &noWriteReport,
+		},
 		&cli.IntFlag{
 			Name:        "wait-for-quality-max-tries",
 			Value:       60,
@@ -170,6 +257,13 @@ var Command = &cli.Command{
 			Usage:       "How many seconds between checks to see if a better quality is available.",
 			Destination: &downloadParams.PollQualityUpgradeInterval,
 		},
+		&cli.DurationFlag{
+			Name:        "poll-metadata-interval",
+			Value:       time.Minute,
+			Category:    "Streaming:",
+			Usage:       "How many seconds between checks of the title and viewer count during the recording. 0 means no check.",
+			Destination: &downloadParams.PollMetadataInterval,
+		},
 		&cli.BoolFlag{
 			Name:     "no-wait",
 			Value:    false,
@@ -228,6 +322,9 @@ var Command = &cli.Command{
 		downloadParams.Remux = !noRemux
 		downloadParams.DeleteCorrupted = !noDeleteCorrupted
 		downloadParams.WaitForLive = !noWait
+		downloadParams.WriteReport = !noWriteReport
+		downloadParams.ValidateFragments = !noValidateFragments
+		downloadParams.WriteChapters = !noWriteChapters
 
 		channelID := cmd.Args().Get(0)
 		if channelID == "" {
@@ -0,0 +1,161 @@
+// Package subtitle provides a command for converting a chat file into
+// subtitles.
+package subtitle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/subtitle"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+const chatExt = ".fc2chat.json"
+
+var (
+	outputFormat string
+	startRaw     string
+	duration     time.Duration
+)
+
+// Command is the command for converting a chat file into subtitles.
+var Command = &cli.Command{
+	Name:      "subtitle",
+	Usage:     "Convert a chat file (.fc2chat.json) into subtitles.",
+	ArgsUsage: "file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output-format",
+			Value:       "ass",
+			Usage:       "Format of the subtitles: ass (scrolling comments) or srt.",
+			Aliases:     []string{"format", "f"},
+			Destination: &outputFormat,
+		},
+		&cli.StringFlag{
+			Name:        "start",
+			Value:       "",
+			Usage:       "Start of the recording (RFC3339 or UNIX timestamp). Empty value means the start of the recording from the .report.json next to the chat file, or the start of the live stream from the .info.json, or the first comment.",
+			Destination: &startRaw,
+		},
+		&cli.DurationFlag{
+			Name:        "duration",
+			Value:       0,
+			Usage:       "How long each comment is displayed. Zero means 8s for ass and 4s for srt.",
+			Destination: &duration,
+		},
+	},
+	Action: func(_ context.Context, cmd *cli.Command) error {
+		file := cmd.Args().Get(0)
+		if file == "" {
+			log.Error().Msg("arg[0] is empty")
+			return errors.New("missing file path")
+		}
+
+		format, err := subtitle.ParseFormat(outputFormat)
+		if err != nil {
+			return err
+		}
+		start, err := findStart(file)
+		if err != nil {
+			return err
+		}
+		var opts []subtitle.Option
+		if duration > 0 {
+			opts = append(opts, subtitle.WithDuration(duration))
+		}
+
+		output := prepareFile(file, string(format))
+		log.Info().
+			Str("output", output).
+			Str("input", file).
+			Time("start", start).
+			Msg("converting chat to subtitles...")
+		return subtitle.ConvertFile(output, file, start, format, opts...)
+	},
+}
+
+// findStart returns the start of the recording.
+func findStart(file string) (time.Time, error) {
+	if startRaw != "" {
+		return parseTime(startRaw)
+	}
+
+	// The report has the start of the video timeline, which is later than the
+	// start of the live stream.
+	start, err := fc2.RecordingStart(strings.TrimSuffix(file, chatExt) + ".report.json")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !start.IsZero() {
+		return start, nil
+	}
+
+	info := strings.TrimSuffix(file, chatExt) + ".info.json"
+	if b, err := os.ReadFile(info); err == nil {
+		var meta api.GetMetaData
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return time.Time{}, fmt.Errorf("cannot decode %s: %w", info, err)
+		}
+		if start, err := meta.ChannelData.Start.Int64(); err == nil && start > 0 {
+			return time.Unix(start, 0), nil
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	comments, err := subtitle.ReadComments(f)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, c := range comments {
+		if t, err := subtitle.CommentTime(c); err == nil {
+			log.Warn().Msg("start of the recording not found, using the first comment")
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("no comment found")
+}
+
+func parseTime(s string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func prepareFile(filename, newExt string) (fName string) {
+	n := 0
+	// Find unique name
+	if base, ok := strings.CutSuffix(filename, chatExt); ok {
+		filename = base
+	} else {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	for {
+		var extn string
+		if n == 0 {
+			extn = newExt
+		} else {
+			extn = fmt.Sprintf("%d.%s", n, newExt)
+		}
+		fName = fmt.Sprintf("%s.%s", filename, extn)
+		if _, err := os.Stat(fName); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		n++
+	}
+	return fName
+}
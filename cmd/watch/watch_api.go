@@ -0,0 +1,454 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/postprocess"
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errChannelNotFound = errors.New("channel not found")
+	errChannelExists   = errors.New("channel is already watched")
+	errNotRecording    = errors.New("channel is not recording")
+	errConfigNotLoaded = errors.New("config is not loaded yet")
+	errNoPostProcessor = errors.New("post-processing queue is disabled")
+)
+
+// channelStatus is the status of a watcher returned by the control API.
+type channelStatus struct {
+	ChannelID  string              `json:"channel_id"`
+	Discovered bool                `json:"discovered"`
+	Paused     bool                `json:"paused"`
+	Recording  bool                `json:"recording"`
+	State      state.DownloadState `json:"state"`
+}
+
+// addChannelRequest is the body of POST /api/channels.
+//
+// The body must be written in JSON. The params are the same as the params of a
+// channel in the config.
+type addChannelRequest struct {
+	ChannelID string    `yaml:"channelId"`
+	Params    yaml.Node `yaml:"params"`
+}
+
+// registerAPI registers the control API of the watchers.
+//
+// The endpoints changing the state are only registered if control is true,
+// that is, if the HTTP server is protected by authentication. They reject the
+// cross-origin requests of the browsers.
+func (m *manager) registerAPI(mux *http.ServeMux, control bool) {
+	mux.HandleFunc("GET /api/channels", m.handleListChannels)
+	mux.HandleFunc("GET /api/jobs", m.handleListJobs)
+	if !control {
+		return
+	}
+
+	csrf := http.NewCrossOriginProtection()
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, csrf.Handler(handler))
+	}
+	handle("POST /api/channels", m.handleAddChannel)
+	handle("DELETE /api/channels/{channelID}", m.handleRemoveChannel)
+	handle("POST /api/channels/{channelID}/pause", m.handleChannelAction(
+		func(f *fc2.FC2) error {
+			f.Pause()
+			return nil
+		},
+	))
+	handle("POST /api/channels/{channelID}/resume", m.handleChannelAction(
+		func(f *fc2.FC2) error {
+			f.Resume()
+			return nil
+		},
+	))
+	handle("POST /api/channels/{channelID}/check", m.handleChannelAction(
+		func(f *fc2.FC2) error {
+			f.Check()
+			return nil
+		},
+	))
+	handle("POST /api/channels/{channelID}/stop", m.handleChannelAction(
+		func(f *fc2.FC2) error {
+			if !f.StopRecording() {
+				return errNotRecording
+			}
+			return nil
+		},
+	))
+	handle("POST /api/jobs/{jobID}/retry", m.handleJobAction(
+		func(q *postprocess.Queue, id string) error {
+			return q.Retry(id)
+		},
+	))
+	handle("DELETE /api/jobs/{jobID}", m.handleJobAction(
+		func(q *postprocess.Queue, id string) error {
+			return q.Remove(id)
+		},
+	))
+}
+
+func (m *manager) handleListJobs(w http.ResponseWriter, _ *http.Request) {
+	jobs := []state.Job{}
+	if m.postProcessor != nil {
+		jobs = m.postProcessor.Jobs()
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleJobAction runs an action on a post-processing job.
+func (m *manager) handleJobAction(
+	action func(q *postprocess.Queue, id string) error,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.postProcessor == nil {
+			writeError(w, errNoPostProcessor)
+			return
+		}
+		jobID := r.PathValue("jobID")
+		if err := action(m.postProcessor, jobID); err != nil {
+			writeError(w, err)
+			return
+		}
+		log.Info().Str("jobID", jobID).Str("path", r.URL.Path).Msg("control API action")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (m *manager) handleListChannels(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	res := make([]channelStatus, 0, len(m.channels)+len(m.discovered))
+	for channelID, wt := range m.channels {
+		res = append(res, newChannelStatus(channelID, wt.fc2, false))
+	}
+	for channelID, wt := range m.discovered {
+		// A discovered channel may be added to the config while finishing its
+		// recording.
+		if _, ok := m.channels[channelID]; ok {
+			continue
+		}
+		res = append(res, newChannelStatus(channelID, wt.fc2, true))
+	}
+	m.mu.Unlock()
+	slices.SortFunc(res, func(a, b channelStatus) int {
+		return strings.Compare(a.ChannelID, b.ChannelID)
+	})
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func newChannelStatus(channelID string, f *fc2.FC2, discovered bool) channelStatus {
+	return channelStatus{
+		ChannelID:  channelID,
+		Discovered: discovered,
+		Paused:     f.Paused(),
+		Recording:  f.Recording(),
+		State:      state.DefaultState.GetChannelState(channelID),
+	}
+}
+
+func (m *manager) handleAddChannel(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	persist, err := parsePersist(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req addChannelRequest
+	if err := yaml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ChannelID == "" {
+		http.Error(w, "channelId is empty", http.StatusBadRequest)
+		return
+	}
+	if req.Params.Kind == 0 {
+		req.Params = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	var params fc2.OptionalParams
+	if err := req.Params.Decode(&params); err != nil {
+		http.Error(w, "invalid params: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := m.addChannel(req.ChannelID, params, persist, &req.Params); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *manager) handleRemoveChannel(w http.ResponseWriter, r *http.Request) {
+	persist, err := parsePersist(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := m.removeChannel(r.PathValue("channelID"), persist); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *manager) handleChannelAction(action func(f *fc2.FC2) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channelID := r.PathValue("channelID")
+		f := m.lookup(channelID)
+		if f == nil {
+			writeError(w, errChannelNotFound)
+			return
+		}
+		if err := action(f); err != nil {
+			writeError(w, err)
+			return
+		}
+		log.Info().Str("channelID", channelID).Str("path", r.URL.Path).Msg("control API action")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// lookup returns the watcher of a configured or discovered channel.
+func (m *manager) lookup(channelID string) *fc2.FC2 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if w, ok := m.channels[channelID]; ok {
+		return w.fc2
+	}
+	if w, ok := m.discovered[channelID]; ok {
+		return w.fc2
+	}
+	return nil
+}
+
+// addChannel starts watching a channel.
+//
+// If persist is true, the raw params are written in the config file.
+// Otherwise, the channel is watched until the next restart.
+func (m *manager) addChannel(
+	channelID string,
+	params fc2.OptionalParams,
+	persist bool,
+	raw *yaml.Node,
+) error {
+	m.mu.Lock()
+	if m.configCtx == nil {
+		m.mu.Unlock()
+		return errConfigNotLoaded
+	}
+	if _, ok := m.channels[channelID]; ok {
+		m.mu.Unlock()
+		return errChannelExists
+	}
+	m.added[channelID] = params
+	delete(m.removed, channelID)
+
+	channelParams := m.configParams.Clone()
+	params.Override(&channelParams)
+	startCleaner(m.configCtx, m.configWg, channelParams)
+	w := m.newWatcherLocked(channelID, channelParams)
+	m.mu.Unlock()
+
+	log.Info().Str("channelID", channelID).Bool("persist", persist).Msg("channel added")
+	m.startWatcher(channelID, w, 0)
+
+	if !persist {
+		return nil
+	}
+	m.configMu.Lock()
+	err := updateConfigChannel(configPath, channelID, raw)
+	m.configMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("channel added but the config could not be written: %w", err)
+	}
+	m.mu.Lock()
+	delete(m.added, channelID)
+	m.mu.Unlock()
+	return nil
+}
+
+// removeChannel stops watching a channel after the current recording.
+//
+// If persist is true, the channel is removed from the config file. Otherwise,
+// the channel is not watched until the next restart.
+func (m *manager) removeChannel(channelID string, persist bool) error {
+	m.mu.Lock()
+	w, ok := m.channels[channelID]
+	if !ok {
+		m.mu.Unlock()
+		return errChannelNotFound
+	}
+	m.removeChannelLocked(channelID, w)
+	m.removed[channelID] = struct{}{}
+	delete(m.added, channelID)
+	m.mu.Unlock()
+
+	if !persist {
+		return nil
+	}
+	m.configMu.Lock()
+	err := updateConfigChannel(configPath, channelID, nil)
+	m.configMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("channel removed but the config could not be written: %w", err)
+	}
+	m.mu.Lock()
+	delete(m.removed, channelID)
+	m.mu.Unlock()
+	return nil
+}
+
+// updateConfigChannel replaces the params of a channel in the config file. If
+// params is nil, the channel is removed.
+//
+// Comments are kept, but the file is reformatted.
+func updateConfigChannel(filename string, channelID string, params *yaml.Node) error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("config is not a map")
+	}
+
+	var channels *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "channels" {
+			channels = root.Content[i+1]
+			break
+		}
+	}
+	if channels == nil {
+		channels = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "channels"},
+			channels,
+		)
+	} else if channels.Kind != yaml.MappingNode {
+		// Empty "channels:".
+		*channels = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	for i := 0; i+1 < len(channels.Content); i += 2 {
+		if channels.Content[i].Value == channelID {
+			channels.Content = slices.Delete(channels.Content, i, i+2)
+			break
+		}
+	}
+	if params != nil {
+		setBlockStyle(params)
+		channels.Content = append(channels.Content,
+			&yaml.Node{
+				Kind:  yaml.ScalarNode,
+				Tag:   "!!str",
+				Style: yaml.SingleQuotedStyle,
+				Value: channelID,
+			},
+			params,
+		)
+	}
+
+	var sb strings.Builder
+	enc := yaml.NewEncoder(&sb)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	// The file is replaced atomically, so that the config watcher never reads
+	// a truncated config. The watcher follows the new file.
+	part := utils.PartName(filename)
+	if err := os.WriteFile(part, []byte(sb.String()), stat.Mode()); err != nil {
+		return err
+	}
+	return utils.FinalizePart(part, filename)
+}
+
+// setBlockStyle converts the JSON-like flow style into the block style used by
+// the config.
+func setBlockStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		if len(node.Content) > 0 {
+			node.Style &^= yaml.FlowStyle
+		}
+	}
+	if node.Kind == yaml.ScalarNode {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, n := range node.Content {
+		setBlockStyle(n)
+	}
+}
+
+func parsePersist(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("persist")
+	if v == "" {
+		return false, nil
+	}
+	persist, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("invalid persist")
+	}
+	return persist, nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errChannelNotFound), errors.Is(err, postprocess.ErrJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errChannelExists), errors.Is(err, errNotRecording),
+		errors.Is(err, postprocess.ErrJobRunning), errors.Is(err, postprocess.ErrJobNotFailed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errConfigNotLoaded), errors.Is(err, errNoPostProcessor):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Err(err).Msg("failed to encode response")
+	}
+}
@@ -0,0 +1,158 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpdateConfigChannel(t *testing.T) {
+	// Arrange
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`defaultParams:
+  quality: 3Mbps
+## A list of channels.
+channels:
+  '40740626':
+    labels:
+      EnglishName: Komae Nadeshiko
+`), 0o644))
+	var params yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(`{"labels": {"EnglishName": "Uno Sakura"}}`), &params))
+
+	// Act
+	err := updateConfigChannel(configFile, "72364867", params.Content[0])
+	require.NoError(t, err)
+	err = updateConfigChannel(configFile, "40740626", nil)
+	require.NoError(t, err)
+
+	// Assert
+	b, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.Equal(t, `defaultParams:
+  quality: 3Mbps
+## A list of channels.
+channels:
+  '72364867':
+    labels:
+      EnglishName: Uno Sakura
+`, string(b))
+	config, err := loadConfig(configFile)
+	require.NoError(t, err)
+	require.Contains(t, config.Channels, "72364867")
+	require.NotContains(t, config.Channels, "40740626")
+}
+
+func TestControlAPIUnknownChannel(t *testing.T) {
+	// Arrange
+	m := newManager(context.Background(), "dev", nil)
+	mux := http.NewServeMux()
+	m.registerAPI(mux, true)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/api/channels/unknown/pause", nil),
+		httptest.NewRequest(http.MethodPost, "/api/channels/unknown/stop", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/channels/unknown", nil),
+	} {
+		// Act
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		// Assert
+		require.Equal(t, http.StatusNotFound, rec.Code, req.URL.Path)
+	}
+}
+
+func TestControlAPIWithoutAuth(t *testing.T) {
+	// Arrange
+	m := newManager(context.Background(), "dev", nil)
+	mux := http.NewServeMux()
+	m.registerAPI(mux, false)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/api/channels", strings.NewReader(`{"channelId":"1"}`)),
+		httptest.NewRequest(http.MethodPost, "/api/channels/unknown/stop", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/jobs/unknown", nil),
+	} {
+		req.Header.Set("Content-Type", "application/json")
+
+		// Act
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		// Assert
+		// The endpoint is not registered.
+		require.Contains(t, []int{http.StatusNotFound, http.StatusMethodNotAllowed}, rec.Code, req.URL.Path)
+	}
+}
+
+func TestAddChannelContentType(t *testing.T) {
+	tests := []struct {
+		title       string
+		contentType string
+		origin      string
+		expected    int
+	}{
+		{
+			title:       "No Content-Type",
+			contentType: "",
+			expected:    http.StatusUnsupportedMediaType,
+		},
+		{
+			title:       "Text Content-Type",
+			contentType: "text/plain",
+			expected:    http.StatusUnsupportedMediaType,
+		},
+		{
+			title:       "YAML Content-Type",
+			contentType: "application/yaml",
+			expected:    http.StatusUnsupportedMediaType,
+		},
+		{
+			title:       "Cross-origin request",
+			contentType: "application/json",
+			origin:      "https://attacker.test",
+			expected:    http.StatusForbidden,
+		},
+		{
+			title:       "JSON Content-Type",
+			contentType: "application/json; charset=utf-8",
+			// The config is not loaded.
+			expected: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			m := newManager(context.Background(), "dev", nil)
+			mux := http.NewServeMux()
+			m.registerAPI(mux, true)
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/api/channels?persist=true",
+				strings.NewReader(`{"channelId":"1"}`),
+			)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			// Act
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			// Assert
+			require.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
@@ -5,14 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
@@ -22,17 +19,13 @@ import (
 	// Import the godeltaprof package to enable continuous profiling via Pyroscope.
 	_ "github.com/grafana/pyroscope-go/godeltaprof/http/pprof"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
-	"go.opentelemetry.io/otel/trace/noop"
 
-	"github.com/Darkness4/fc2-live-dl-go/cookie"
 	"github.com/Darkness4/fc2-live-dl-go/fc2"
 	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
-	"github.com/Darkness4/fc2-live-dl-go/fc2/cleaner"
-	"github.com/Darkness4/fc2-live-dl-go/notify"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/postprocess"
 	"github.com/Darkness4/fc2-live-dl-go/notify/notifier"
 	"github.com/Darkness4/fc2-live-dl-go/state"
 	"github.com/Darkness4/fc2-live-dl-go/telemetry"
@@ -46,9 +39,21 @@ const versionCheckURL = "https://api.github.com/repos/Darkness4/fc2-live-dl-go/r
 var (
 	configPath             string
 	pprofListenAddress     string
+	metricsListenAddress   string
+	httpAuthBearerToken    string
+	httpAuthUsername       string
+	httpAuthPassword       string
+	httpTLSCertFile        string
+	httpTLSKeyFile         string
 	enableTracesExporting  bool
 	enableMetricsExporting bool
 	cookieEncryptionSecret string
+	stateFile              string
+	stateMaxHistory        int
+	stateMaxErrors         int
+	stateRetention         time.Duration
+	postProcessingWorkers  int
+	postProcessingFile     string
 )
 
 // Command is the command for watching multiple live FC2 streams.
@@ -67,9 +72,51 @@ var Command = &cli.Command{
 			Name:        "pprof.listen-address",
 			Value:       ":3000",
 			Destination: &pprofListenAddress,
-			Usage:       "The address to listen on for pprof.",
+			Usage:       "The address to listen on for pprof, the status page and the control API.",
 			Sources:     cli.EnvVars("PPROF_LISTEN_ADDRESS"),
 		},
+		&cli.StringFlag{
+			Name:        "metrics.listen-address",
+			Value:       "",
+			Destination: &metricsListenAddress,
+			Usage:       "The address to listen on for /metrics, without authentication. Empty value means /metrics is served on pprof.listen-address.",
+			Sources:     cli.EnvVars("METRICS_LISTEN_ADDRESS"),
+		},
+		&cli.StringFlag{
+			Name:        "http.auth.bearer-token",
+			Value:       "",
+			Destination: &httpAuthBearerToken,
+			Usage:       "Require a bearer token to access the HTTP server. Empty value means no bearer authentication.",
+			Sources:     cli.EnvVars("HTTP_AUTH_BEARER_TOKEN"),
+		},
+		&cli.StringFlag{
+			Name:        "http.auth.username",
+			Value:       "",
+			Destination: &httpAuthUsername,
+			Usage:       "Require a basic authentication to access the HTTP server. Empty value means no basic authentication.",
+			Sources:     cli.EnvVars("HTTP_AUTH_USERNAME"),
+		},
+		&cli.StringFlag{
+			Name:        "http.auth.password",
+			Value:       "",
+			Destination: &httpAuthPassword,
+			Usage:       "Password of the basic authentication.",
+			Sources:     cli.EnvVars("HTTP_AUTH_PASSWORD"),
+		},
+		&cli.StringFlag{
+			Name:        "http.tls.cert-file",
+			Value:       "",
+			Destination: &httpTLSCertFile,
+			Usage:       "TLS certificate file of the HTTP servers. Empty value means no TLS.",
+			Sources:     cli.EnvVars("HTTP_TLS_CERT_FILE"),
+		},
+		&cli.StringFlag{
+			Name:        "http.tls.key-file",
+			Value:       "",
+			Destination: &httpTLSKeyFile,
+			Usage:       "TLS key file of the HTTP servers.",
+			Sources:     cli.EnvVars("HTTP_TLS_KEY_FILE"),
+		},
 		&cli.StringFlag{
 			Name:        "cookie.encryption-secret",
 			Value:       "FC2_LIVE_DL_GO_COOKIE_ENCRYPTION_SECRET",
@@ -77,6 +124,48 @@ var Command = &cli.Command{
 			Usage:       "A encryption secret to encrypt the cookies.",
 			Sources:     cli.EnvVars("COOKIE_ENCRYPTION_SECRET"),
 		},
+		&cli.StringFlag{
+			Name:        "state.file",
+			Value:       "",
+			Destination: &stateFile,
+			Usage:       "File where the state and the history of the recordings are persisted and reloaded on boot. Empty value means no persistence.",
+			Sources:     cli.EnvVars("STATE_FILE"),
+		},
+		&cli.IntFlag{
+			Name:        "state.max-history",
+			Value:       1000,
+			Destination: &stateMaxHistory,
+			Usage:       "Maximum number of recordings kept in the history. A zero value means no limit.",
+			Sources:     cli.EnvVars("STATE_MAX_HISTORY"),
+		},
+		&cli.IntFlag{
+			Name:        "state.max-errors",
+			Value:       100,
+			Destination: &stateMaxErrors,
+			Usage:       "Maximum number of errors kept per channel. A zero value means no limit.",
+			Sources:     cli.EnvVars("STATE_MAX_ERRORS"),
+		},
+		&cli.DurationFlag{
+			Name:        "state.retention",
+			Value:       30 * 24 * time.Hour,
+			Destination: &stateRetention,
+			Usage:       "Maximum age of the recordings and the errors kept in the state. A zero value means no limit.",
+			Sources:     cli.EnvVars("STATE_RETENTION"),
+		},
+		&cli.IntFlag{
+			Name:        "post-processing.workers",
+			Value:       2,
+			Destination: &postProcessingWorkers,
+			Usage:       "Maximum number of post-processing jobs (remux, audio extraction, concatenation) running at the same time.",
+			Sources:     cli.EnvVars("POST_PROCESSING_WORKERS"),
+		},
+		&cli.StringFlag{
+			Name:        "post-processing.queue-file",
+			Value:       "",
+			Destination: &postProcessingFile,
+			Usage:       "File where the post-processing jobs are persisted and resumed on boot. Empty value means no persistence.",
+			Sources:     cli.EnvVars("POST_PROCESSING_QUEUE_FILE"),
+		},
 		&cli.BoolFlag{
 			Name:        "traces.export",
 			Usage:       "Enable traces push. (To configure the exporter, set the OTEL_EXPORTER_OTLP_ENDPOINT environment variable, see https://opentelemetry.io/docs/languages/sdk-configuration/otlp-exporter/)",
@@ -93,6 +182,22 @@ var Command = &cli.Command{
 		},
 	},
 	Action: func(ctx context.Context, cmd *cli.Command) error {
+		auth := httpAuth{
+			bearerToken: httpAuthBearerToken,
+			username:    httpAuthUsername,
+			password:    httpAuthPassword,
+		}
+		if auth.password != "" && auth.username == "" {
+			return errors.New("http.auth.password is set without http.auth.username")
+		}
+		tls := httpTLS{
+			certFile: httpTLSCertFile,
+			keyFile:  httpTLSKeyFile,
+		}
+		if err := tls.validate(); err != nil {
+			return err
+		}
+
 		ctx, cancel := context.WithCancel(ctx)
 
 		// Trap cleanup
@@ -141,9 +246,37 @@ var Command = &cli.Command{
 			}
 		}()
 
+		if stateFile != "" {
+			if err := state.DefaultState.Persist(
+				stateFile,
+				state.WithMaxHistory(stateMaxHistory),
+				state.WithMaxErrors(stateMaxErrors),
+				state.WithMaxAge(stateRetention),
+			); err != nil {
+				log.Err(err).Str("file", stateFile).Msg("failed to load state, state won't be persisted")
+			} else {
+				log.Info().Str("file", stateFile).Msg("loaded persisted state")
+			}
+		}
+
+		var queueOpts []postprocess.Option
+		if postProcessingFile != "" {
+			queueOpts = append(queueOpts, postprocess.WithPersistence(postProcessingFile))
+		}
+		queue, err := postprocess.New(postProcessingWorkers, fc2.RunJob, queueOpts...)
+		if err != nil {
+			log.Err(err).
+				Str("file", postProcessingFile).
+				Msg("failed to load post-processing jobs, jobs won't be persisted")
+			queue, _ = postprocess.New(postProcessingWorkers, fc2.RunJob)
+		}
+		go queue.Run(ctx)
+
 		configChan := make(chan *Config)
 		go ObserveConfig(ctx, configPath, configChan)
 
+		m := newManager(ctx, cmd.Root().Version, queue)
+
 		go func() {
 			http.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
 				s := state.DefaultState.ReadState()
@@ -154,20 +287,70 @@ var Command = &cli.Command{
 					return
 				}
 			})
-			http.Handle("/metrics", promhttp.Handler())
-			log.Info().Str("listenAddress", pprofListenAddress).Msg("listening")
-			if err := http.ListenAndServe(pprofListenAddress, nil); err != nil {
-				log.Fatal().Err(err).Msg("fail to serve http")
+			http.HandleFunc("/history", handleHistory)
+			http.HandleFunc("GET /dashboard", handleDashboard)
+			http.HandleFunc("GET /events", handleEvents)
+			m.registerAPI(http.DefaultServeMux, auth.enabled())
+			if metricsListenAddress == "" {
+				http.Handle("/metrics", promhttp.Handler())
+			} else {
+				metricsMux := http.NewServeMux()
+				metricsMux.Handle("/metrics", promhttp.Handler())
+				go tls.listenAndServe("metrics", metricsListenAddress, metricsMux)
 			}
-			log.Fatal().Msg("http server stopped")
+			if !auth.enabled() {
+				log.Warn().
+					Msg("the HTTP server is not protected by authentication, the control API is disabled")
+			}
+			tls.listenAndServe("http", pprofListenAddress, auth.middleware(http.DefaultServeMux))
 		}()
 
-		return ConfigReloader(ctx, configChan, func(ctx context.Context, config *Config) {
-			handleConfig(ctx, cmd.Root().Version, config)
-		})
+		return ConfigReloader(ctx, configChan, m.handleConfig)
 	},
 }
 
+// handleHistory returns the history of the recordings, the most recent first.
+//
+// The history can be filtered with the query parameters channel_id, status,
+// since (RFC3339) and limit.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := state.HistoryQuery{
+		ChannelID: query.Get("channel_id"),
+	}
+	if v := query.Get("status"); v != "" {
+		q.Status = state.RecordingStatusFromString(strings.ToUpper(v))
+		if q.Status == state.RecordingStatusUnspecified {
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Since = since
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(state.DefaultState.History(q)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // PersistentCookieJar is a CookieJar that persists the cookies to a file.
 type PersistentCookieJar interface {
 	http.CookieJar
@@ -191,162 +374,6 @@ func (j *noPersistCookieJar) Save() error {
 
 func (j *noPersistCookieJar) Delete() {}
 
-func handleConfig(ctx context.Context, version string, config *Config) {
-	var jar PersistentCookieJar
-	var err error
-	if config.CookiesFile != "" {
-		jar, err = cookie.NewJar(config.CookiesFile, &cookie.JarOptions{
-			EncryptionSecret: cookieEncryptionSecret,
-		})
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to initialize cookie jar")
-		}
-	} else {
-		ijar, err := cookiejar.New(&cookiejar.Options{})
-		if err != nil {
-			// Panic here since it's unexpected
-			log.Panic().Err(err).Msg("failed to initialize cookie jar")
-		}
-		jar = &noPersistCookieJar{ijar}
-	}
-
-	params := fc2.DefaultParams.Clone()
-	config.DefaultParams.Override(&params)
-
-	// Handle deprecated parameters
-	if config.DefaultParams.CookiesFile != nil && *config.DefaultParams.CookiesFile != "" {
-		config.CookiesImportFile = params.CookiesFile
-
-		log.Warn().
-			Msg("defaultParams.cookiesFile is deprecated, please use top-level cookiesImportFile instead")
-	}
-	if config.DefaultParams.CookiesRefreshDuration != nil &&
-		*config.DefaultParams.CookiesRefreshDuration != 0 {
-		config.CookiesRefreshDuration = params.CookiesRefreshDuration
-
-		log.Warn().
-			Msg("defaultParams.cookiesRefreshDuration is deprecated, please use top-level cookiesRefreshDuration instead")
-	}
-
-	if !jar.Exists() {
-		if config.CookiesImportFile != "" && !jar.Exists() {
-			if err := cookie.ParseFromFile(jar, config.CookiesImportFile); err != nil {
-				log.Error().Err(err).Msg("failed to load cookies, using unauthenticated")
-			} else {
-				log.Info().Str("file", config.CookiesImportFile).Msg("loaded cookies")
-			}
-		}
-	} else {
-		log.Info().Str("file", config.CookiesFile).Msg("loaded persisted cookies")
-	}
-
-	hclient := &http.Client{
-		Jar:     jar,
-		Timeout: time.Minute,
-		Transport: otelhttp.NewTransport(
-			http.DefaultTransport,
-			otelhttp.WithTracerProvider(noop.NewTracerProvider()),
-		),
-	}
-	client := api.NewClient(hclient)
-	if config.CookiesRefreshDuration != 0 && config.CookiesImportFile != "" {
-		log.Info().Dur("duration", config.CookiesRefreshDuration).Msg("will refresh cookies")
-		if err := client.CheckLogin(ctx); err != nil {
-			log.Err(err).
-				Msg("failed to login to id.fc2.com, we will try again, but you should extract new cookies")
-			jar.Delete()
-		}
-		if err := jar.Save(); err != nil {
-			log.Err(err).Msg("failed to save cookies")
-		}
-		go LoginLoop(ctx, client, jar, config.CookiesRefreshDuration)
-	} else {
-		log.Info().Msg("cookies refresh duration is zero, will not refresh cookies")
-	}
-
-	if config.Notifier.Enabled {
-		notifier.Notifier = notify.NewFormatedNotifier(
-			notify.NewShoutrrr(
-				hclient,
-				config.Notifier.URLs,
-				notify.IncludeTitleInMessage(config.Notifier.IncludeTitleInMessage),
-				notify.NoPriority(config.Notifier.NoPriority),
-			),
-			config.Notifier.NotificationFormats,
-		)
-		log.Info().Msg("using shoutrrr")
-		if len(config.Notifier.URLs) == 0 {
-			log.Warn().Msg("using shoutrrr but there is no URLs")
-		}
-	} else {
-		log.Info().Msg("no notifier configured")
-	}
-
-	if err := notifier.NotifyConfigReloaded(ctx); err != nil {
-		log.Err(err).Msg("notify failed")
-	}
-
-	defer func() {
-		if err := recover(); err != nil {
-			fmt.Println(err)
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			defer cancel()
-			if err := notifier.NotifyPanicked(ctx, err); err != nil {
-				log.Err(err).Msg("notify failed")
-			}
-			os.Exit(1)
-		}
-	}()
-
-	// Check new version
-	go checkVersion(ctx, hclient, version)
-
-	var wg sync.WaitGroup
-	wg.Add(len(config.Channels))
-	for channel, overrideParams := range config.Channels {
-		channelParams := params.Clone()
-		overrideParams.Override(&channelParams)
-
-		// Scan for intermediates .ts used for concatenation
-		if !channelParams.KeepIntermediates && channelParams.Concat &&
-			channelParams.ScanDirectory != "" {
-			wg.Add(1)
-			go func(params fc2.Params) {
-				defer wg.Done()
-				cleaner.CleanPeriodically(
-					ctx,
-					params.ScanDirectory,
-					time.Hour,
-					cleaner.WithEligibleAge(params.EligibleForCleaningAge),
-				)
-			}(channelParams)
-		}
-
-		go func(channelID string, params fc2.Params) {
-			defer wg.Done()
-			err := fc2.New(client, params, channelID).Watch(ctx)
-			if err != nil && !errors.Is(err, io.EOF) {
-				log.Err(err).Str("channelID", channelID).Msg("failed to download")
-			}
-
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				log.Panic().
-					Err(err).
-					Str("channelID", channelID).
-					Msg("stopped watching channel without parent context being canceled")
-			}
-		}(channel, channelParams)
-
-		// Spread out the channel start time to avoid hammering the server.
-		time.Sleep(config.RateLimitAvoidance.PollingPacing)
-	}
-
-	wg.Wait()
-}
-
 func checkVersion(ctx context.Context, client *http.Client, version string) {
 	if strings.Contains(version, "-") { // Version containing a hyphen is a development version.
 		log.Warn().Str("version", version).Msg("development version, skipping version check")
@@ -2,6 +2,7 @@ package watch
 
 import (
 	"context"
+	"errors"
 	"os"
 	"time"
 
@@ -20,6 +21,10 @@ type Config struct {
 	CookiesFile            string                        `yaml:"cookiesFile,omitempty"`
 	Notifier               NotifierConfig                `yaml:"notifier,omitempty"`
 	RateLimitAvoidance     RateLimitAvoidance            `yaml:"rateLimitAvoidance,omitempty"`
+	Presence               PresenceConfig                `yaml:"presence,omitempty"`
+	MaxConcurrentDownloads int                           `yaml:"maxConcurrentDownloads,omitempty"`
+	PreemptLowerPriority   bool                          `yaml:"preemptLowerPriority,omitempty"`
+	Discovery              DiscoveryConfig               `yaml:"discovery,omitempty"`
 	DefaultParams          fc2.OptionalParams            `yaml:"defaultParams,omitempty"`
 	Channels               map[string]fc2.OptionalParams `yaml:"channels,omitempty"`
 }
@@ -38,10 +43,48 @@ type RateLimitAvoidance struct {
 	PollingPacing time.Duration `yaml:"pollingPacing,omitempty"`
 }
 
+// PresenceConfig is the configuration for the shared presence poller.
+type PresenceConfig struct {
+	Enabled          *bool         `yaml:"enabled,omitempty"`
+	PollInterval     time.Duration `yaml:"pollInterval,omitempty"`
+	FallbackInterval time.Duration `yaml:"fallbackInterval,omitempty"`
+}
+
+// DiscoveryConfig is the configuration for the auto-discovery of channels.
+type DiscoveryConfig struct {
+	Enabled      bool               `yaml:"enabled,omitempty"`
+	PollInterval time.Duration      `yaml:"pollInterval,omitempty"`
+	MaxChannels  int                `yaml:"maxChannels,omitempty"`
+	RetireAfter  time.Duration      `yaml:"retireAfter,omitempty"`
+	Categories   []string           `yaml:"categories,omitempty"`
+	Keywords     []string           `yaml:"keywords,omitempty"`
+	MinViewers   int                `yaml:"minViewers,omitempty"`
+	Languages    []string           `yaml:"languages,omitempty"`
+	Params       fc2.OptionalParams `yaml:"params,omitempty"`
+}
+
 func applyDefaults(config *Config) {
 	if config.RateLimitAvoidance.PollingPacing == 0 {
 		config.RateLimitAvoidance.PollingPacing = 500 * time.Millisecond
 	}
+	if config.Presence.Enabled == nil {
+		config.Presence.Enabled = new(true)
+	}
+	if config.Presence.PollInterval == 0 {
+		config.Presence.PollInterval = 5 * time.Second
+	}
+	if config.Presence.FallbackInterval == 0 {
+		config.Presence.FallbackInterval = 5 * time.Minute
+	}
+	if config.Discovery.PollInterval == 0 {
+		config.Discovery.PollInterval = time.Minute
+	}
+	if config.Discovery.MaxChannels == 0 {
+		config.Discovery.MaxChannels = 10
+	}
+	if config.Discovery.RetireAfter == 0 {
+		config.Discovery.RetireAfter = 10 * time.Minute
+	}
 }
 
 func loadConfig(filename string) (*Config, error) {
@@ -56,9 +99,24 @@ func loadConfig(filename string) (*Config, error) {
 		return nil, err
 	}
 	applyDefaults(config)
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
 	return config, err
 }
 
+// validateConfig rejects the values which cannot be used once the defaults are
+// applied.
+func validateConfig(config *Config) error {
+	if config.Presence.PollInterval <= 0 {
+		return errors.New("presence.pollInterval must be positive")
+	}
+	if config.Discovery.PollInterval <= 0 {
+		return errors.New("discovery.pollInterval must be positive")
+	}
+	return nil
+}
+
 // ObserveConfig watches the config file for changes and sends the new config to the configChan.
 func ObserveConfig(ctx context.Context, filename string, configChan chan<- *Config) {
 	var lastModTime time.Time
@@ -108,6 +166,11 @@ func ObserveConfig(ctx context.Context, filename string, configChan chan<- *Conf
 				log.Error().Str("file", filename).Err(err).Msg("failed to stat file")
 				continue
 			}
+			// The watch is removed when the file is replaced, for example by
+			// the control API.
+			if err := watcher.Add(filename); err != nil {
+				log.Error().Str("file", filename).Err(err).Msg("failed to watch config")
+			}
 
 			if !stat.ModTime().Equal(lastModTime) {
 				lastModTime = stat.ModTime()
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		title   string
+		edit    func(config *Config)
+		isError bool
+	}{
+		{
+			title: "Default config",
+			edit:  func(*Config) {},
+		},
+		{
+			title: "Negative presence poll interval",
+			edit: func(config *Config) {
+				config.Presence.PollInterval = -time.Second
+			},
+			isError: true,
+		},
+		{
+			title: "Negative discovery poll interval",
+			edit: func(config *Config) {
+				config.Discovery.PollInterval = -time.Minute
+			},
+			isError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			config := testConfig(nil)
+			tt.edit(config)
+
+			// Act
+			err := validateConfig(config)
+
+			// Assert
+			if tt.isError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
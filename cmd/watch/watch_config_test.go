@@ -147,3 +147,36 @@ func TestConfigReloaderCancellation(t *testing.T) {
 	// Wait for the configReloader function to exit
 	wg.Wait()
 }
+
+func TestObserveConfigReplaced(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tempDir := t.TempDir()
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("channels: {}\n"), 0o644))
+	configChan := make(chan *watch.Config)
+	go watch.ObserveConfig(ctx, configFile, configChan)
+	<-configChan
+
+	// Act
+	replace := func(content string) *watch.Config {
+		time.Sleep(time.Second)
+		tmp := filepath.Join(tempDir, "config.tmp.yaml")
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0o644))
+		require.NoError(t, os.Rename(tmp, configFile))
+		select {
+		case config := <-configChan:
+			return config
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "the replaced config was not detected")
+			return nil
+		}
+	}
+	first := replace("channels:\n  '40740626': {}\n")
+	second := replace("channels:\n  '40740626': {}\n  '72364867': {}\n")
+
+	// Assert
+	require.Len(t, first.Channels, 1)
+	require.Len(t, second.Channels, 2)
+}
@@ -0,0 +1,20 @@
+package watch
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboard is a single page listing the channels and the recent recordings.
+//
+// It has no external assets, so it works offline.
+//
+//go:embed dashboard/index.html
+var dashboard []byte
+
+func handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy",
+		"default-src 'self'; img-src 'self' https: data:; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+	_, _ = w.Write(dashboard)
+}
@@ -0,0 +1,76 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	eventsBufferSize  = 64
+	eventsHeartbeat   = 30 * time.Second
+	eventsRetryMillis = 3000
+)
+
+// handleEvents streams the state changes as Server-Sent Events.
+//
+// The events can be filtered with the query parameter channel_id. If the
+// client is too slow, the stream is closed and the client should reconnect.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	channelID := r.URL.Query().Get("channel_id")
+	rc := http.NewResponseController(w)
+
+	events, unsubscribe := state.DefaultState.Subscribe(eventsBufferSize)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disable the buffering of reverse proxies like nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventsRetryMillis); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		log.Err(err).Msg("streaming is not supported")
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				log.Warn().Msg("event stream client is too slow, closing")
+				return
+			}
+			if channelID != "" && e.ChannelID != channelID {
+				continue
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				log.Err(err).Msg("failed to encode event")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,692 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Darkness4/fc2-live-dl-go/cookie"
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/cleaner"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/discovery"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/limiter"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/postprocess"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/presence"
+	"github.com/Darkness4/fc2-live-dl-go/notify"
+	"github.com/Darkness4/fc2-live-dl-go/notify/notifier"
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/rs/zerolog/log"
+)
+
+// manager keeps the watchers running across config reloads.
+//
+// On reload, the config is compared to the previous one:
+//
+//   - Unchanged channels keep running.
+//   - Removed channels are stopped after their current recording.
+//   - Added channels are started.
+//   - Changed channels apply their new parameters at the next stream.
+//
+// The notifier and the cookies are replaced without touching the downloads.
+//
+// Channels added or removed at runtime (see the control API) override the
+// config until the next restart.
+type manager struct {
+	ctx     context.Context
+	version string
+
+	jar     *reloadableJar
+	hclient *http.Client
+	client  *api.Client
+	cookies *cookieSettings
+
+	presenceKey    *presenceKey
+	presence       *presence.Poller
+	presenceCancel context.CancelFunc
+
+	limiterKey *limiterKey
+	limiter    *limiter.Limiter
+
+	postProcessor *postprocess.Queue
+
+	discoveryKey string
+	// discoveryCancel stops the cleaner of the discovered channels.
+	discoveryCancel  context.CancelFunc
+	discoveredParams fc2.Params
+
+	mu         sync.Mutex
+	opts       []fc2.Option
+	channels   map[string]*watcher
+	stopping   map[string]*watcher
+	discoverer *discovery.Discoverer
+	discovered map[string]*watcher
+	wg         sync.WaitGroup
+
+	// Context, wait group and default params of the current config, used to
+	// add channels at runtime.
+	configCtx    context.Context
+	configWg     *sync.WaitGroup
+	configParams fc2.Params
+	// Channels added and removed at runtime.
+	added   map[string]fc2.OptionalParams
+	removed map[string]struct{}
+
+	// configMu serializes the edits of the config file.
+	configMu sync.Mutex
+}
+
+type watcher struct {
+	fc2    *fc2.FC2
+	params string
+	done   chan struct{}
+}
+
+type cookieSettings struct {
+	file            string
+	importFile      string
+	refreshDuration time.Duration
+}
+
+type presenceKey struct {
+	enabled          bool
+	pollInterval     time.Duration
+	fallbackInterval time.Duration
+}
+
+type limiterKey struct {
+	maxDownloads int
+	preempt      bool
+}
+
+func newManager(ctx context.Context, version string, postProcessor *postprocess.Queue) *manager {
+	jar := &reloadableJar{}
+	hclient := &http.Client{
+		Jar:     jar,
+		Timeout: time.Minute,
+		Transport: otelhttp.NewTransport(
+			http.DefaultTransport,
+			otelhttp.WithTracerProvider(noop.NewTracerProvider()),
+		),
+	}
+	return &manager{
+		ctx:           ctx,
+		version:       version,
+		jar:           jar,
+		hclient:       hclient,
+		client:        api.NewClient(hclient),
+		postProcessor: postProcessor,
+		channels:      make(map[string]*watcher),
+		stopping:      make(map[string]*watcher),
+		discovered:    make(map[string]*watcher),
+		added:         make(map[string]fc2.OptionalParams),
+		removed:       make(map[string]struct{}),
+	}
+}
+
+// handleConfig applies the config and blocks until the config is replaced.
+//
+// When the parent context is canceled, it waits for the watchers to exit.
+func (m *manager) handleConfig(ctx context.Context, config *Config) {
+	params := fc2.DefaultParams.Clone()
+	config.DefaultParams.Override(&params)
+
+	// Handle deprecated parameters
+	if config.DefaultParams.CookiesFile != nil && *config.DefaultParams.CookiesFile != "" {
+		config.CookiesImportFile = params.CookiesFile
+
+		log.Warn().
+			Msg("defaultParams.cookiesFile is deprecated, please use top-level cookiesImportFile instead")
+	}
+	if config.DefaultParams.CookiesRefreshDuration != nil &&
+		*config.DefaultParams.CookiesRefreshDuration != 0 {
+		config.CookiesRefreshDuration = params.CookiesRefreshDuration
+
+		log.Warn().
+			Msg("defaultParams.cookiesRefreshDuration is deprecated, please use top-level cookiesRefreshDuration instead")
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Println(err)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			if err := notifier.NotifyPanicked(ctx, err); err != nil {
+				log.Err(err).Msg("notify failed")
+			}
+			os.Exit(1)
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	m.reloadCookies(ctx, &wg, config)
+	m.reloadNotifier(config)
+
+	if err := notifier.NotifyConfigReloaded(ctx); err != nil {
+		log.Err(err).Msg("notify failed")
+	}
+
+	// Check new version
+	go checkVersion(ctx, m.hclient, m.version)
+
+	optsChanged := m.reloadServices(config)
+
+	m.mu.Lock()
+	m.configCtx, m.configWg, m.configParams = ctx, &wg, params
+	config.Channels = maps.Clone(config.Channels)
+	if config.Channels == nil {
+		config.Channels = make(map[string]fc2.OptionalParams)
+	}
+	maps.Copy(config.Channels, m.added)
+	for channelID := range m.removed {
+		delete(config.Channels, channelID)
+	}
+	m.mu.Unlock()
+
+	m.reloadDiscovery(config, params, optsChanged)
+	m.reloadChannels(ctx, &wg, config, params, optsChanged)
+
+	<-ctx.Done()
+	wg.Wait()
+	if m.ctx.Err() != nil {
+		// Wait for the watchers to finish their post-processing.
+		m.wg.Wait()
+	}
+}
+
+func (m *manager) reloadCookies(ctx context.Context, wg *sync.WaitGroup, config *Config) {
+	settings := &cookieSettings{
+		file:            config.CookiesFile,
+		importFile:      config.CookiesImportFile,
+		refreshDuration: config.CookiesRefreshDuration,
+	}
+	jar := m.jar.current()
+	if m.cookies == nil || *m.cookies != *settings {
+		jar = newCookieJar(config)
+		m.jar.set(jar)
+		m.cookies = settings
+
+		if config.CookiesRefreshDuration != 0 && config.CookiesImportFile != "" {
+			if err := m.client.CheckLogin(ctx); err != nil {
+				log.Err(err).
+					Msg("failed to login to id.fc2.com, we will try again, but you should extract new cookies")
+				jar.Delete()
+			}
+			if err := jar.Save(); err != nil {
+				log.Err(err).Msg("failed to save cookies")
+			}
+		}
+	} else {
+		log.Info().Msg("cookie settings unchanged, keeping the cookies")
+	}
+
+	if config.CookiesRefreshDuration != 0 && config.CookiesImportFile != "" {
+		log.Info().Dur("duration", config.CookiesRefreshDuration).Msg("will refresh cookies")
+		wg.Go(func() {
+			LoginLoop(ctx, m.client, jar, config.CookiesRefreshDuration)
+		})
+	} else {
+		log.Info().Msg("cookies refresh duration is zero, will not refresh cookies")
+	}
+}
+
+func newCookieJar(config *Config) PersistentCookieJar {
+	var jar PersistentCookieJar
+	var err error
+	if config.CookiesFile != "" {
+		jar, err = cookie.NewJar(config.CookiesFile, &cookie.JarOptions{
+			EncryptionSecret: cookieEncryptionSecret,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to initialize cookie jar")
+		}
+	} else {
+		ijar, err := cookiejar.New(&cookiejar.Options{})
+		if err != nil {
+			// Panic here since it's unexpected
+			log.Panic().Err(err).Msg("failed to initialize cookie jar")
+		}
+		jar = &noPersistCookieJar{ijar}
+	}
+
+	if !jar.Exists() {
+		if config.CookiesImportFile != "" && !jar.Exists() {
+			if err := cookie.ParseFromFile(jar, config.CookiesImportFile); err != nil {
+				log.Error().Err(err).Msg("failed to load cookies, using unauthenticated")
+			} else {
+				log.Info().Str("file", config.CookiesImportFile).Msg("loaded cookies")
+			}
+		}
+	} else {
+		log.Info().Str("file", config.CookiesFile).Msg("loaded persisted cookies")
+	}
+	return jar
+}
+
+func (m *manager) reloadNotifier(config *Config) {
+	if config.Notifier.Enabled {
+		notifier.Notifier = notify.NewFormatedNotifier(
+			notify.NewShoutrrr(
+				m.hclient,
+				config.Notifier.URLs,
+				notify.IncludeTitleInMessage(config.Notifier.IncludeTitleInMessage),
+				notify.NoPriority(config.Notifier.NoPriority),
+			),
+			config.Notifier.NotificationFormats,
+		)
+		log.Info().Msg("using shoutrrr")
+		if len(config.Notifier.URLs) == 0 {
+			log.Warn().Msg("using shoutrrr but there is no URLs")
+		}
+	} else {
+		notifier.Notifier = notify.NewFormatedNotifier(
+			notify.NewDummyNotifier(),
+			notify.DefaultNotificationFormats,
+		)
+		log.Info().Msg("no notifier configured")
+	}
+}
+
+// reloadServices restarts the presence poller and reconfigures the limiter if
+// their settings changed. It returns true if the options of the watchers
+// changed.
+func (m *manager) reloadServices(config *Config) bool {
+	changed := false
+
+	pKey := &presenceKey{
+		enabled:          *config.Presence.Enabled,
+		pollInterval:     config.Presence.PollInterval,
+		fallbackInterval: config.Presence.FallbackInterval,
+	}
+	if m.presenceKey == nil || *m.presenceKey != *pKey {
+		changed = true
+		m.presenceKey = pKey
+		if m.presenceCancel != nil {
+			m.presenceCancel()
+			m.presence, m.presenceCancel = nil, nil
+		}
+		if pKey.enabled {
+			ctx, cancel := context.WithCancel(m.ctx)
+			p := presence.New(
+				m.client,
+				config.Presence.PollInterval,
+				presence.WithFallbackInterval(config.Presence.FallbackInterval),
+			)
+			m.wg.Go(func() {
+				if err := p.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					log.Err(err).Msg("presence poller failed")
+				}
+			})
+			m.presence, m.presenceCancel = p, cancel
+		} else {
+			log.Info().Msg("presence poller disabled, channels will be polled individually")
+		}
+	}
+
+	lKey := &limiterKey{
+		maxDownloads: config.MaxConcurrentDownloads,
+		preempt:      config.PreemptLowerPriority,
+	}
+	if m.limiterKey == nil || *m.limiterKey != *lKey {
+		m.limiterKey = lKey
+		if lKey.maxDownloads > 0 {
+			log.Info().
+				Int("maxConcurrentDownloads", config.MaxConcurrentDownloads).
+				Bool("preemptLowerPriority", config.PreemptLowerPriority).
+				Msg("limiting simultaneous downloads")
+		}
+		// The limiter is reconfigured in place, so that the running and waiting
+		// downloads keep their slot.
+		if m.limiter == nil {
+			changed = true
+			m.limiter = limiter.New(
+				config.MaxConcurrentDownloads,
+				limiter.WithPreemption(config.PreemptLowerPriority),
+			)
+		} else {
+			m.limiter.SetMax(config.MaxConcurrentDownloads)
+			m.limiter.SetPreemption(config.PreemptLowerPriority)
+		}
+	}
+
+	var opts []fc2.Option
+	if m.presence != nil {
+		opts = append(opts, fc2.WithPresence(m.presence))
+	}
+	if m.limiter != nil {
+		opts = append(opts, fc2.WithLimiter(m.limiter))
+	}
+	if m.postProcessor != nil {
+		opts = append(opts, fc2.WithPostProcessor(m.postProcessor))
+	}
+	m.mu.Lock()
+	m.opts = opts
+	m.mu.Unlock()
+	return changed
+}
+
+// reloadDiscovery restarts the discovery if its settings changed. Otherwise,
+// the discovered watchers are reloaded with the new parameters.
+//
+// On restart, the discovered watchers are retired after their current
+// recording, and their channels can be discovered again once they exited.
+func (m *manager) reloadDiscovery(config *Config, params fc2.Params, optsChanged bool) {
+	discoveredParams := params.Clone()
+	config.Discovery.Params.Override(&discoveredParams)
+
+	// The parameters of the discovered channels can be changed without
+	// restarting the discovery.
+	keyConfig := config.Discovery
+	keyConfig.Params = fc2.OptionalParams{}
+	b, err := yaml.Marshal(keyConfig)
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to marshal discovery config")
+	}
+	key := string(b)
+
+	m.mu.Lock()
+	paramsChanged := m.discoveredParams.String() != discoveredParams.String()
+	m.discoveredParams = discoveredParams
+	if paramsChanged || optsChanged {
+		for _, w := range m.discovered {
+			w.params = discoveredParams.String()
+			w.fc2.Reload(discoveredParams.Clone(), m.opts...)
+		}
+	}
+	m.mu.Unlock()
+
+	if key == m.discoveryKey {
+		return
+	}
+	m.discoveryKey = key
+	m.mu.Lock()
+	prev := m.discoverer
+	m.discoverer = nil
+	m.mu.Unlock()
+	if prev != nil {
+		log.Info().Msg("discovery config changed, restarting the discovery")
+		prev.Stop()
+		m.discoveryCancel()
+		m.discoveryCancel = nil
+	}
+	if !config.Discovery.Enabled {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.discoveryCancel = cancel
+	startCleaner(ctx, &m.wg, discoveredParams)
+
+	d := discovery.New(
+		m.client,
+		discovery.Criteria{
+			Categories: config.Discovery.Categories,
+			Keywords:   config.Discovery.Keywords,
+			MinViewers: config.Discovery.MinViewers,
+			Languages:  config.Discovery.Languages,
+		},
+		config.Discovery.PollInterval,
+		discovery.WithMaxChannels(config.Discovery.MaxChannels),
+		discovery.WithRetireAfter(config.Discovery.RetireAfter),
+		discovery.WithExcludeFunc(m.isWatched),
+	)
+	m.mu.Lock()
+	m.discoverer = d
+	m.mu.Unlock()
+	m.wg.Go(func() {
+		err := d.Run(m.ctx, m.watchDiscovered)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Err(err).Msg("channel discovery failed")
+		}
+	})
+}
+
+// isWatched returns true if the channel is in the config, or is finishing its
+// recording after being removed from the config or retired by a previous
+// discovery.
+func (m *manager) isWatched(channelID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.channels[channelID]
+	_, stopping := m.stopping[channelID]
+	_, discovered := m.discovered[channelID]
+	return ok || stopping || discovered
+}
+
+// watchDiscovered watches a discovered channel until the context is canceled,
+// or after its current recording once stop is closed.
+func (m *manager) watchDiscovered(ctx context.Context, channelID string, stop <-chan struct{}) {
+	m.mu.Lock()
+	if _, ok := m.channels[channelID]; ok {
+		// The channel was added to the config meanwhile.
+		m.mu.Unlock()
+		return
+	}
+	w := &watcher{
+		fc2:    fc2.New(m.client, m.discoveredParams.Clone(), channelID, m.opts...),
+		params: m.discoveredParams.String(),
+		done:   make(chan struct{}),
+	}
+	m.discovered[channelID] = w
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.discovered[channelID] == w {
+			delete(m.discovered, channelID)
+		}
+		// The state belongs to the watcher of the config, if any.
+		if _, ok := m.channels[channelID]; !ok {
+			state.DefaultState.DeleteChannelState(channelID)
+		}
+		close(w.done)
+	}()
+
+	go func() {
+		select {
+		case <-stop:
+			w.fc2.Stop()
+		case <-w.done:
+		}
+	}()
+
+	if err := w.fc2.Watch(ctx); err != nil && !errors.Is(err, io.EOF) {
+		log.Err(err).Str("channelID", channelID).Msg("failed to download")
+	}
+}
+
+func (m *manager) reloadChannels(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	config *Config,
+	params fc2.Params,
+	optsChanged bool,
+) {
+	m.mu.Lock()
+	for channelID, w := range m.channels {
+		if _, ok := config.Channels[channelID]; ok {
+			continue
+		}
+		m.removeChannelLocked(channelID, w)
+	}
+
+	added := make(map[string]*watcher)
+	for channelID, overrideParams := range config.Channels {
+		channelParams := params.Clone()
+		overrideParams.Override(&channelParams)
+
+		startCleaner(ctx, wg, channelParams)
+
+		if w, ok := m.channels[channelID]; ok {
+			if w.params == channelParams.String() && !optsChanged {
+				continue
+			}
+			log.Info().
+				Str("channelID", channelID).
+				Msg("channel changed, reloading at the next stream")
+			w.params = channelParams.String()
+			w.fc2.Reload(channelParams, m.opts...)
+			continue
+		}
+
+		added[channelID] = m.newWatcherLocked(channelID, channelParams)
+	}
+	m.mu.Unlock()
+
+	// Spread out the channel start time to avoid hammering the server. The
+	// watchers are started even if the config is reloaded meanwhile.
+	var delay time.Duration
+	for channelID, w := range added {
+		m.startWatcher(channelID, w, delay)
+		delay += config.RateLimitAvoidance.PollingPacing
+	}
+}
+
+// startCleaner scans periodically the scan and scratch directories for the
+// intermediates .ts used for concatenation, if enabled.
+func startCleaner(ctx context.Context, wg *sync.WaitGroup, params fc2.Params) {
+	if params.KeepIntermediates || !params.Concat {
+		return
+	}
+	opts := []cleaner.Option{cleaner.WithEligibleAge(params.EligibleForCleaningAge)}
+	if params.CheckpointDirectory != "" {
+		opts = append(opts, cleaner.WithCheckpointDirectory(params.CheckpointDirectory))
+	}
+	// The scratch directory holds the .part files left behind by a crash.
+	for _, dir := range []string{params.ScanDirectory, params.ScratchDirectory} {
+		if dir == "" {
+			continue
+		}
+		wg.Go(func() {
+			cleaner.CleanPeriodically(ctx, dir, time.Hour, opts...)
+		})
+	}
+}
+
+func (m *manager) newWatcherLocked(channelID string, params fc2.Params) *watcher {
+	w := &watcher{
+		fc2:    fc2.New(m.client, params, channelID, m.opts...),
+		params: params.String(),
+		done:   make(chan struct{}),
+	}
+	m.channels[channelID] = w
+	return w
+}
+
+func (m *manager) removeChannelLocked(channelID string, w *watcher) {
+	log.Info().
+		Str("channelID", channelID).
+		Msg("channel removed, stopping after the current recording")
+	w.fc2.Stop()
+	delete(m.channels, channelID)
+	m.stopping[channelID] = w
+}
+
+// startWatcher starts the watcher of a channel of the config after delay.
+//
+// If the channel was discovered, the discovered watcher is retired. The watcher
+// starts once the previous watcher of the channel, if any, exited.
+func (m *manager) startWatcher(channelID string, w *watcher, delay time.Duration) {
+	m.mu.Lock()
+	prev := m.stopping[channelID]
+	if prev == nil {
+		prev = m.discovered[channelID]
+	}
+	d := m.discoverer
+	m.mu.Unlock()
+	if d != nil {
+		d.Retire(channelID)
+	}
+
+	m.wg.Go(func() {
+		defer close(w.done)
+
+		if prev != nil {
+			// The channel was removed then added back, or was discovered.
+			<-prev.done
+		}
+		if delay > 0 {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+
+		err := w.fc2.Watch(m.ctx)
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Err(err).Str("channelID", channelID).Msg("failed to download")
+		}
+
+		m.mu.Lock()
+		removed := m.channels[channelID] != w
+		if m.stopping[channelID] == w {
+			delete(m.stopping, channelID)
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-m.ctx.Done():
+			return
+		default:
+		}
+		if removed {
+			log.Info().Str("channelID", channelID).Msg("stopped watching removed channel")
+			state.DefaultState.DeleteChannelState(channelID)
+			return
+		}
+		log.Panic().
+			Err(err).
+			Str("channelID", channelID).
+			Msg("stopped watching channel without parent context being canceled")
+	})
+}
+
+// reloadableJar is a cookie jar which can be replaced while in use.
+type reloadableJar struct {
+	mu  sync.RWMutex
+	jar PersistentCookieJar
+}
+
+func (j *reloadableJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.jar != nil {
+		j.jar.SetCookies(u, cookies)
+	}
+}
+
+func (j *reloadableJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.jar == nil {
+		return nil
+	}
+	return j.jar.Cookies(u)
+}
+
+func (j *reloadableJar) current() PersistentCookieJar {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.jar
+}
+
+func (j *reloadableJar) set(jar PersistentCookieJar) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar = jar
+}
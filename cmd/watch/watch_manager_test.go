@@ -0,0 +1,209 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransport lists the channel "1" as live. The other requests fail, so
+// that the watchers wait for their stream.
+type fakeTransport struct{}
+
+func (fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/allchannellist.php") {
+		return nil, errors.New("offline")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"channel":[{"id":"1","count":10}]}`)),
+		Request:    req,
+	}, nil
+}
+
+func newTestManager(t *testing.T) (*manager, context.Context, *sync.WaitGroup) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := newManager(ctx, "dev", nil)
+	m.client = api.NewClient(&http.Client{Transport: fakeTransport{}})
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		m.wg.Wait()
+	})
+	return m, ctx, &wg
+}
+
+func testConfig(channels map[string]fc2.OptionalParams) *Config {
+	config := &Config{Channels: channels}
+	applyDefaults(config)
+	return config
+}
+
+func TestReloadChannels(t *testing.T) {
+	tests := []struct {
+		title   string
+		next    map[string]fc2.OptionalParams
+		changed bool
+		removed bool
+	}{
+		{
+			title: "Unchanged channel",
+			next:  map[string]fc2.OptionalParams{"1": {}},
+		},
+		{
+			title:   "Changed channel",
+			next:    map[string]fc2.OptionalParams{"1": {WaitPollInterval: new(time.Minute)}},
+			changed: true,
+		},
+		{
+			title:   "Removed channel",
+			next:    map[string]fc2.OptionalParams{},
+			removed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			m, ctx, wg := newTestManager(t)
+			params := fc2.DefaultParams.Clone()
+			m.reloadChannels(ctx, wg, testConfig(map[string]fc2.OptionalParams{"1": {}}), params, false)
+			m.mu.Lock()
+			w := m.channels["1"]
+			before := w.params
+			m.mu.Unlock()
+
+			// Act
+			m.reloadChannels(ctx, wg, testConfig(tt.next), params, false)
+
+			// Assert
+			m.mu.Lock()
+			cur, stopping := m.channels["1"], m.stopping["1"]
+			after := w.params
+			m.mu.Unlock()
+			if tt.removed {
+				require.Nil(t, cur)
+				require.Same(t, w, stopping)
+				// The watcher stops by itself, the parent context is alive.
+				<-w.done
+				require.NoError(t, ctx.Err())
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				require.NotContains(t, m.stopping, "1")
+				return
+			}
+			require.Same(t, w, cur)
+			require.Nil(t, stopping)
+			if tt.changed {
+				require.NotEqual(t, before, after)
+			} else {
+				require.Equal(t, before, after)
+			}
+		})
+	}
+}
+
+func TestReloadDiscoveryChanged(t *testing.T) {
+	// Arrange
+	m, _, _ := newTestManager(t)
+	params := fc2.DefaultParams.Clone()
+	config := testConfig(nil)
+	config.Discovery.Enabled = true
+	config.Discovery.PollInterval = 10 * time.Millisecond
+	m.reloadDiscovery(config, params, false)
+	var w *watcher
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		w = m.discovered["1"]
+		return w != nil
+	}, time.Second, 10*time.Millisecond)
+	m.mu.Lock()
+	first := m.discoverer
+	m.mu.Unlock()
+
+	// Act
+	config.Discovery.MinViewers = 5
+	m.reloadDiscovery(config, params, false)
+
+	// Assert
+	// The discovered watcher is retired, not canceled.
+	<-w.done
+	require.NoError(t, m.ctx.Err())
+	m.mu.Lock()
+	require.NotSame(t, first, m.discoverer)
+	require.NotNil(t, m.discoverer)
+	m.mu.Unlock()
+	// The channel is discovered again by the new discovery.
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		cur := m.discovered["1"]
+		return cur != nil && cur != w
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReloadChannelsPacing(t *testing.T) {
+	// Arrange
+	m, _, wg := newTestManager(t)
+	configCtx, cancelConfig := context.WithCancel(context.Background())
+	config := testConfig(map[string]fc2.OptionalParams{"1": {}, "2": {}, "3": {}})
+	config.RateLimitAvoidance.PollingPacing = 20 * time.Millisecond
+
+	// Act
+	// The config is reloaded while the watchers are starting.
+	time.AfterFunc(10*time.Millisecond, cancelConfig)
+	m.reloadChannels(configCtx, wg, config, fc2.DefaultParams.Clone(), false)
+
+	// Assert
+	m.mu.Lock()
+	watchers := make([]*watcher, 0, len(m.channels))
+	for channelID, w := range m.channels {
+		watchers = append(watchers, w)
+		m.removeChannelLocked(channelID, w)
+	}
+	m.mu.Unlock()
+	require.Len(t, watchers, 3)
+	for _, w := range watchers {
+		select {
+		case <-w.done:
+		case <-time.After(time.Second):
+			require.Fail(t, "watcher not started")
+		}
+	}
+}
+
+func TestReloadServicesLimiter(t *testing.T) {
+	// Arrange
+	m, _, _ := newTestManager(t)
+	config := testConfig(nil)
+	config.MaxConcurrentDownloads = 1
+	require.True(t, m.reloadServices(config))
+	l := m.limiter
+
+	// Act
+	config.MaxConcurrentDownloads = 2
+	config.PreemptLowerPriority = true
+	changed := m.reloadServices(config)
+
+	// Assert
+	// The limiter is reconfigured in place, the watchers keep their options.
+	require.False(t, changed)
+	require.Same(t, l, m.limiter)
+	_, errA := l.Acquire(context.Background(), "a", 0, nil)
+	_, errB := l.Acquire(context.Background(), "b", 0, nil)
+	require.NoError(t, errA)
+	require.NoError(t, errB)
+	require.Equal(t, 2, l.Running())
+}
@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// httpAuth is the authentication of the HTTP server.
+//
+// If both the bearer token and the basic credentials are set, either is
+// accepted.
+type httpAuth struct {
+	bearerToken string
+	username    string
+	password    string
+}
+
+func (a httpAuth) enabled() bool {
+	return a.bearerToken != "" || a.username != ""
+}
+
+func (a httpAuth) authorized(r *http.Request) bool {
+	if a.bearerToken != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			secureCompare(token, a.bearerToken) {
+			return true
+		}
+	}
+	if a.username != "" {
+		if username, password, ok := r.BasicAuth(); ok {
+			// Both are compared to avoid leaking which one is wrong.
+			usernameOK := secureCompare(username, a.username)
+			passwordOK := secureCompare(password, a.password)
+			if usernameOK && passwordOK {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// middleware rejects the unauthorized requests.
+func (a httpAuth) middleware(next http.Handler) http.Handler {
+	if !a.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			if a.username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="fc2-live-dl-go", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="fc2-live-dl-go"`)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// httpTLS is the TLS configuration of the HTTP servers.
+type httpTLS struct {
+	certFile string
+	keyFile  string
+}
+
+func (t httpTLS) validate() error {
+	if (t.certFile == "") != (t.keyFile == "") {
+		return errors.New("both the TLS certificate and the TLS key must be set")
+	}
+	return nil
+}
+
+// listenAndServe serves the handler, with TLS if configured.
+//
+// It never returns.
+func (t httpTLS) listenAndServe(name string, addr string, handler http.Handler) {
+	log.Info().
+		Str("server", name).
+		Str("listenAddress", addr).
+		Bool("tls", t.certFile != "").
+		Msg("listening")
+	var err error
+	if t.certFile != "" {
+		err = http.ListenAndServeTLS(addr, t.certFile, t.keyFile, handler)
+	} else {
+		err = http.ListenAndServe(addr, handler)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("server", name).Msg("fail to serve http")
+	}
+	log.Fatal().Str("server", name).Msg("http server stopped")
+}
@@ -0,0 +1,93 @@
+package watch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		title    string
+		auth     httpAuth
+		setup    func(r *http.Request)
+		expected int
+	}{
+		{
+			title:    "No auth",
+			auth:     httpAuth{},
+			setup:    func(*http.Request) {},
+			expected: http.StatusOK,
+		},
+		{
+			title:    "Missing credentials",
+			auth:     httpAuth{bearerToken: "token"},
+			setup:    func(*http.Request) {},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			title: "Valid bearer token",
+			auth:  httpAuth{bearerToken: "token"},
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer token")
+			},
+			expected: http.StatusOK,
+		},
+		{
+			title: "Invalid bearer token",
+			auth:  httpAuth{bearerToken: "token"},
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer wrong")
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			title: "Valid basic auth",
+			auth:  httpAuth{username: "user", password: "pass"},
+			setup: func(r *http.Request) {
+				r.SetBasicAuth("user", "pass")
+			},
+			expected: http.StatusOK,
+		},
+		{
+			title: "Invalid basic auth",
+			auth:  httpAuth{username: "user", password: "pass"},
+			setup: func(r *http.Request) {
+				r.SetBasicAuth("user", "wrong")
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			title: "Basic auth when both are configured",
+			auth:  httpAuth{bearerToken: "token", username: "user", password: "pass"},
+			setup: func(r *http.Request) {
+				r.SetBasicAuth("user", "pass")
+			},
+			expected: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(req)
+			rec := httptest.NewRecorder()
+
+			// Act
+			tt.auth.middleware(ok).ServeHTTP(rec, req)
+
+			// Assert
+			require.Equal(t, tt.expected, rec.Code)
+			if tt.expected == http.StatusUnauthorized {
+				require.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -275,25 +275,56 @@ func (c *Client) CheckLogin(ctx context.Context) error {
 	return nil
 }
 
-// FindUnrestrictedStream finds the first unrestricted stream.
-func (c *Client) FindUnrestrictedStream(ctx context.Context) (string, error) {
+// GetChannelList gets the list of the channels currently live.
+func (c *Client) GetChannelList(ctx context.Context) (GetChannelListResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
 	req, err := http.NewRequestWithContext(ctx, "GET", liveFC2ChannelListURL, nil)
 	if err != nil {
-		return "", err
+		return GetChannelListResponse{}, err
 	}
 	req.Header.Set("Accept", "application/json")
+
+	log := log.With().
+		Str("method", "GET").
+		Str("url", liveFC2ChannelListURL).
+		Logger()
+
 	resp, err := c.Do(req)
 	if err != nil {
-		return "", err
+		return GetChannelListResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("non-ok http code returned: %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		log.Error().
+			Int("response.status", resp.StatusCode).
+			Str("response.body", string(body)).
+			Msg("http error")
+
+		if resp.StatusCode == 503 {
+			return GetChannelListResponse{}, ErrRateLimit
+		}
+
+		return GetChannelListResponse{}, fmt.Errorf(
+			"non-ok http code returned: %d",
+			resp.StatusCode,
+		)
 	}
 
 	var channelList GetChannelListResponse
 	if err := utils.JSONDecodeAndPrintOnError(resp.Body, &channelList); err != nil {
+		return GetChannelListResponse{}, err
+	}
+	return channelList, nil
+}
+
+// FindUnrestrictedStream finds the first unrestricted stream.
+func (c *Client) FindUnrestrictedStream(ctx context.Context) (string, error) {
+	channelList, err := c.GetChannelList(ctx)
+	if err != nil {
 		return "", err
 	}
 
@@ -320,25 +351,10 @@ func (c *Client) FindUnrestrictedStream(ctx context.Context) (string, error) {
 
 // FindRestrictedStream finds the first restricted stream.
 func (c *Client) FindRestrictedStream(ctx context.Context) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", liveFC2ChannelListURL, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Accept", "application/json")
-	resp, err := c.Do(req)
+	channelList, err := c.GetChannelList(ctx)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("non-ok http code returned: %d", resp.StatusCode)
-	}
-
-	var channelList GetChannelListResponse
-	if err := utils.JSONDecodeAndPrintOnError(resp.Body, &channelList); err != nil {
-		return "", err
-	}
 
 	if len(channelList.Channel) == 0 {
 		return "", errors.New("no channels found")
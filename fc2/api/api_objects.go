@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -157,6 +158,14 @@ func (r WSResponse) String() string {
 	return string(b)
 }
 
+// WSEvent is a message received from the websocket, with its receive time.
+type WSEvent struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	ID         int64           `json:"id,omitempty"`
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+}
+
 // CommentArguments is the type of response corresponding to the "comment" event.
 type CommentArguments struct {
 	Comments []Comment `json:"comments"`
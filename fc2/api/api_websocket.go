@@ -135,11 +135,15 @@ func (w *WebSocket) GetHLSInformation(
 }
 
 // Listen listens for messages from the WebSocket server.
+//
+// If eventChan is not nil, every received message is also sent to eventChan,
+// including the messages which are not handled.
 func (w *WebSocket) Listen(
 	ctx context.Context,
 	conn *websocket.Conn,
 	msgChan chan<- *WSResponse,
 	commentChan chan<- *Comment,
+	eventChan chan<- *WSEvent,
 ) error {
 	// Start listening for messages from the websocket server
 	for {
@@ -158,6 +162,14 @@ func (w *WebSocket) Listen(
 			return err
 		}
 		w.log.Trace().Stringer("msg", msgObj).Msg("ws receive")
+		if eventChan != nil {
+			eventChan <- &WSEvent{
+				ReceivedAt: time.Now().UTC(),
+				ID:         msgObj.ID,
+				Name:       msgObj.Name,
+				Arguments:  msgObj.Arguments,
+			}
+		}
 
 		switch msgObj.Name {
 		case "connect_complete":
@@ -198,6 +210,8 @@ func (w *WebSocket) Listen(
 					commentChan <- &comment
 				}
 			}
+		default:
+			w.log.Debug().Str("name", msgObj.Name).Msg("ws unhandled event")
 		}
 	}
 }
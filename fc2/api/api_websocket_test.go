@@ -73,7 +73,7 @@ func (suite *WebSocketTestSuite) TestListen() {
 	commentChan := make(chan *api.Comment, 100)
 	done := make(chan error, 1)
 	go func() {
-		done <- suite.impl.Listen(suite.ctx, conn, msgChan, commentChan)
+		done <- suite.impl.Listen(suite.ctx, conn, msgChan, commentChan, nil)
 	}()
 	time.Sleep(5 * time.Second)
 	conn.Close(websocket.StatusNormalClosure, "close")
@@ -95,7 +95,7 @@ func (suite *WebSocketTestSuite) TestHealthCheckLoop() {
 
 	// Producer
 	go func() {
-		if err := suite.impl.Listen(ctx, conn, msgChan, nil); err != nil &&
+		if err := suite.impl.Listen(ctx, conn, msgChan, nil, nil); err != nil &&
 			!errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled) {
 			log.Fatal().Err(err).Msg("listen failed")
 		}
@@ -126,7 +126,7 @@ func (suite *WebSocketTestSuite) TestGetHLSInformation() {
 	commentChan := make(chan *api.Comment, 100)
 	done := make(chan error, 1)
 	go func() {
-		done <- suite.impl.Listen(suite.ctx, conn, msgChan, commentChan)
+		done <- suite.impl.Listen(suite.ctx, conn, msgChan, commentChan, nil)
 	}()
 
 	// Try multiple time as FC2 may not return HLS information immediately.
@@ -153,7 +153,7 @@ func (suite *WebSocketTestSuite) TestFetchPlaylist() {
 	commentChan := make(chan *api.Comment, 100)
 	done := make(chan error, 1)
 	go func() {
-		done <- suite.impl.Listen(suite.ctx, conn, msgChan, commentChan)
+		done <- suite.impl.Listen(suite.ctx, conn, msgChan, commentChan, nil)
 	}()
 
 	ret, err := try.DoWithResult(5, time.Second, func(_ int) (struct {
@@ -213,7 +213,7 @@ func (suite *WebSocketTestSuite) TestControlDisconnection() {
 			msgChan := make(chan *api.WSResponse, 100)
 			done := make(chan error, 1)
 			go func() {
-				done <- suite.impl.Listen(suite.ctx, conn, msgChan, nil)
+				done <- suite.impl.Listen(suite.ctx, conn, msgChan, nil, nil)
 			}()
 
 			time.Sleep(2 * time.Second)
@@ -6,11 +6,14 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
 	"github.com/Darkness4/fc2-live-dl-go/telemetry/metrics"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
 	"github.com/Darkness4/fc2-live-dl-go/video/probe"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
@@ -32,9 +35,10 @@ type Option func(*Options)
 
 // Options are the options for the cleaner.
 type Options struct {
-	dryRun      bool
-	probe       bool
-	eligibleAge time.Duration
+	dryRun              bool
+	probe               bool
+	eligibleAge         time.Duration
+	checkpointDirectory string
 }
 
 // WithDryRun sets the dryRun option.
@@ -65,6 +69,14 @@ func WithEligibleAge(d time.Duration) Option {
 	}
 }
 
+// WithCheckpointDirectory keeps the .part files of the downloads which can be
+// resumed from the checkpoints of the directory.
+func WithCheckpointDirectory(dir string) Option {
+	return func(o *Options) {
+		o.checkpointDirectory = dir
+	}
+}
+
 func applyOptions(opts []Option) *Options {
 	o := &Options{
 		probe:       true,
@@ -76,7 +88,8 @@ func applyOptions(opts []Option) *Options {
 	return o
 }
 
-// Scan scans the scanDirectory for old .ts files.
+// Scan scans the scanDirectory for old .ts files and for the .part files left
+// behind by a crash.
 func Scan(
 	scanDirectory string,
 	opts ...Option,
@@ -86,6 +99,7 @@ func Scan(
 	metrics.Cleaner.Runs.Add(context.Background(), 1)
 
 	o := applyOptions(opts)
+	resumable := resumableFiles(o.checkpointDirectory)
 
 	set := make(map[string]bool)
 	queueForRenaming = make([]string, 0)
@@ -98,6 +112,34 @@ func Scan(
 			return err
 		}
 
+		if !d.IsDir() && utils.IsPartName(d.Name()) {
+			// The download will be resumed.
+			if abs, err := filepath.Abs(utils.FinalName(path)); err == nil && resumable[abs] {
+				return nil
+			}
+
+			finfo, err := d.Info()
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+
+			// Check if file is eligible for cleaning.
+			if time.Since(finfo.ModTime()) <= o.eligibleAge {
+				return nil
+			}
+
+			// The recording and the chat left behind by a crash are recovered.
+			// The other files are incomplete and deleted.
+			if isRecoverablePart(d.Name()) {
+				queueForRenaming = append(queueForRenaming, path)
+			} else {
+				set[path] = true
+			}
+			return nil
+		}
+
 		if !d.IsDir() {
 			name := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
 			if before, ok := strings.CutSuffix(name, ".combined"); ok {
@@ -152,6 +194,7 @@ func Scan(
 					if strings.HasPrefix(entry.Name(), prefix+".") &&
 						strings.HasSuffix(entry.Name(), ".ts") &&
 						!strings.Contains(entry.Name(), ".combined.") &&
+						!utils.IsPartName(entry.Name()) &&
 						!entry.IsDir() {
 
 						fpath := filepath.Join(dir, entry.Name())
@@ -178,6 +221,65 @@ func Scan(
 	return queue, queueForRenaming, nil
 }
 
+// sidecarSuffixes are the suffixes of the files written line by line along
+// the recording: the chat, the events and the timeline.
+var sidecarSuffixes = []string{".fc2chat.json", ".fc2events.json", ".timeline.json"}
+
+// isRecoverablePart returns true if the partial file is still readable: the
+// MPEG-TS recording, and its sidecar files.
+func isRecoverablePart(name string) bool {
+	final := utils.FinalName(name)
+	return strings.HasSuffix(final, ".ts") || slices.ContainsFunc(sidecarSuffixes, func(suffix string) bool {
+		return strings.HasSuffix(final, suffix)
+	})
+}
+
+// resumableFiles returns the absolute final names of the recordings and their
+// sidecar files referenced by the checkpoints of the directory.
+func resumableFiles(checkpointDirectory string) map[string]bool {
+	if checkpointDirectory == "" {
+		return nil
+	}
+	checkpoints, err := fc2.LoadStreamCheckpoints(checkpointDirectory)
+	if err != nil {
+		log.Err(err).Str("dir", checkpointDirectory).Msg("failed to load checkpoints")
+		return nil
+	}
+	files := make(map[string]bool)
+	for _, c := range checkpoints {
+		if c.OutputFileName == "" {
+			continue
+		}
+		name, err := filepath.Abs(c.OutputFileName)
+		if err != nil {
+			continue
+		}
+		files[name] = true
+		prefix := strings.TrimSuffix(name, filepath.Ext(name))
+		for _, suffix := range sidecarSuffixes {
+			files[prefix+suffix] = true
+		}
+		// The report is continued too.
+		files[prefix+".report.json"] = true
+		if c.ChatFileName != "" {
+			if chat, err := filepath.Abs(c.ChatFileName); err == nil {
+				files[chat] = true
+			}
+		}
+	}
+	return files
+}
+
+// renamedPath returns the path of the file once renamed.
+func renamedPath(path string) string {
+	if utils.IsPartName(path) {
+		return utils.FinalName(path)
+	}
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext)
+	return strings.TrimSuffix(prefix, ".combined") + ext
+}
+
 // Clean removes old .ts files from the scanDirectory.
 func Clean(scanDirectory string, opts ...Option) error {
 	cleanerMutex.Lock()
@@ -224,9 +326,7 @@ func Clean(scanDirectory string, opts ...Option) error {
 	}
 
 	for _, path := range queueForRenaming {
-		ext := filepath.Ext(path)
-		prefix := strings.TrimSuffix(path, ext)
-		renamedPath := strings.TrimSuffix(prefix, ".combined") + ext
+		renamedPath := renamedPath(path)
 
 		// Check for conflict
 		if _, err := os.Stat(renamedPath); err == nil {
@@ -234,7 +334,7 @@ func Clean(scanDirectory string, opts ...Option) error {
 			continue
 		}
 
-		log.Info().Str("path", path).Str("to", renamedPath).Msg("renaming combined file")
+		log.Info().Str("path", path).Str("to", renamedPath).Msg("renaming file")
 		if !o.dryRun {
 			if err := os.Rename(path, renamedPath); err != nil {
 				log.Err(err).
@@ -99,6 +99,89 @@ func TestScan(t *testing.T) {
 	}, queueForRenaming)
 }
 
+func TestScanPartFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	files := []string{
+		"test.part.ts",
+		"test.part.mp4",
+		"test.fc2chat.part.json",
+		"test.fc2events.part.json",
+		"test.timeline.part.json",
+		"test.info.part.json",
+		"test.1.ts",
+		"test.combined.part.mp4",
+		"recent.part.ts",
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		err := os.WriteFile(path, []byte("test"), 0o0700)
+		require.NoError(t, err)
+		if file == "recent.part.ts" {
+			continue
+		}
+		err = os.Chtimes(path, time.Unix(0, 0), time.Unix(0, 0))
+		require.NoError(t, err)
+	}
+
+	queueForDeletion, queueForRenaming, err := cleaner.Scan(dir, cleaner.WithoutProbe())
+	require.NoError(t, err)
+	requireSlicesEqual(t, []string{
+		filepath.Join(dir, "test.part.mp4"),
+		filepath.Join(dir, "test.info.part.json"),
+		filepath.Join(dir, "test.combined.part.mp4"),
+	}, queueForDeletion)
+	requireSlicesEqual(t, []string{
+		filepath.Join(dir, "test.part.ts"),
+		filepath.Join(dir, "test.fc2chat.part.json"),
+		filepath.Join(dir, "test.fc2events.part.json"),
+		filepath.Join(dir, "test.timeline.part.json"),
+	}, queueForRenaming)
+}
+
+func TestScanResumableParts(t *testing.T) {
+	dir := t.TempDir()
+	checkpointDir := t.TempDir()
+
+	files := []string{
+		"test.part.ts",
+		"test.fc2chat.part.json",
+		"test.timeline.part.json",
+		"test.report.part.json",
+		"test.1.fc2chat.part.json",
+		"old.part.ts",
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		err := os.WriteFile(path, []byte("test"), 0o0700)
+		require.NoError(t, err)
+		err = os.Chtimes(path, time.Unix(0, 0), time.Unix(0, 0))
+		require.NoError(t, err)
+	}
+	err := os.WriteFile(
+		filepath.Join(checkpointDir, "1234.checkpoint.json"),
+		[]byte(fmt.Sprintf(
+			`{"channelId":"1234","outputFileName":%q,"chatFileName":%q}`,
+			filepath.Join(dir, "test.ts"),
+			filepath.Join(dir, "test.1.fc2chat.json"),
+		)),
+		0o0600,
+	)
+	require.NoError(t, err)
+
+	queueForDeletion, queueForRenaming, err := cleaner.Scan(
+		dir,
+		cleaner.WithoutProbe(),
+		cleaner.WithCheckpointDirectory(checkpointDir),
+	)
+	require.NoError(t, err)
+	require.Empty(t, queueForDeletion)
+	requireSlicesEqual(t, []string{
+		filepath.Join(dir, "old.part.ts"),
+	}, queueForRenaming)
+}
+
 func TestClean(t *testing.T) {
 	dir, err := os.MkdirTemp("", "test")
 	if err != nil {
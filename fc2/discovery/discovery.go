@@ -0,0 +1,375 @@
+// Package discovery provides a way to discover channels from the public channel list.
+//
+// The discoverer periodically fetches the list of live channels, selects the
+// channels matching the criteria and spawns a watcher for each of them. The
+// watchers of the channels which stopped matching are retired: they exit after
+// their current recording.
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const tracerName = "fc2/discovery"
+
+// ChannelLister fetches the list of the channels currently live.
+type ChannelLister interface {
+	GetChannelList(ctx context.Context) (api.GetChannelListResponse, error)
+}
+
+// WatchFunc watches a discovered channel until the context is canceled.
+//
+// stop is closed when the channel is retired: the watcher must exit after its
+// current recording.
+type WatchFunc func(ctx context.Context, channelID string, stop <-chan struct{})
+
+// Criteria selects the channels to discover.
+//
+// Each non-empty criterion must match. An empty criteria matches every channel.
+type Criteria struct {
+	// Categories are the FC2 category IDs.
+	Categories []string
+	// Keywords are case-insensitive words searched in the title.
+	Keywords []string
+	// MinViewers is the minimum number of current viewers.
+	MinViewers int
+	// Languages are the language codes, like "ja" or "en".
+	Languages []string
+}
+
+// IsZero returns true if no criterion is set.
+func (c Criteria) IsZero() bool {
+	return len(c.Categories) == 0 &&
+		len(c.Keywords) == 0 &&
+		c.MinViewers <= 0 &&
+		len(c.Languages) == 0
+}
+
+// Match returns true if the channel matches the criteria.
+func (c Criteria) Match(channel api.GetChannelListChannel) bool {
+	if len(c.Categories) > 0 && !slices.Contains(c.Categories, channel.Category.String()) {
+		return false
+	}
+	if len(c.Languages) > 0 && !slices.ContainsFunc(c.Languages, func(lang string) bool {
+		return strings.EqualFold(lang, channel.Lang)
+	}) {
+		return false
+	}
+	if c.MinViewers > 0 {
+		count, _ := channel.Count.Int64()
+		if count < int64(c.MinViewers) {
+			return false
+		}
+	}
+	if len(c.Keywords) > 0 {
+		title := strings.ToLower(channel.Title)
+		if !slices.ContainsFunc(c.Keywords, func(keyword string) bool {
+			return strings.Contains(title, strings.ToLower(keyword))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Option is the option for the discoverer.
+type Option func(*Options)
+
+// Options are the options for the discoverer.
+type Options struct {
+	maxChannels int
+	retireAfter time.Duration
+	exclude     []func(channelID string) bool
+}
+
+// WithMaxChannels sets the maximum number of discovered channels watched at
+// the same time.
+//
+// A zero value means no limit.
+func WithMaxChannels(n int) Option {
+	return func(o *Options) {
+		o.maxChannels = n
+	}
+}
+
+// WithRetireAfter sets the duration after which a channel which stopped
+// matching is retired.
+func WithRetireAfter(d time.Duration) Option {
+	return func(o *Options) {
+		o.retireAfter = d
+	}
+}
+
+// WithExclude excludes channels from the discovery, like the channels which
+// are already watched.
+func WithExclude(channelIDs ...string) Option {
+	return WithExcludeFunc(func(channelID string) bool {
+		return slices.Contains(channelIDs, channelID)
+	})
+}
+
+// WithExcludeFunc excludes the channels for which exclude returns true.
+//
+// exclude is evaluated at each discovery, for the channels which are not
+// watched yet. See Retire to stop watching a discovered channel.
+func WithExcludeFunc(exclude func(channelID string) bool) Option {
+	return func(o *Options) {
+		o.exclude = append(o.exclude, exclude)
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{
+		maxChannels: 10,
+		retireAfter: 10 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+type tracked struct {
+	stop     chan struct{}
+	retiring bool
+	lastSeen time.Time
+}
+
+// Discoverer spawns and retires watchers for the channels matching the
+// criteria.
+type Discoverer struct {
+	lister   ChannelLister
+	criteria Criteria
+	interval time.Duration
+	opts     *Options
+
+	mu       sync.Mutex
+	channels map[string]*tracked
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// New creates a new discoverer.
+func New(
+	lister ChannelLister,
+	criteria Criteria,
+	interval time.Duration,
+	opts ...Option,
+) *Discoverer {
+	if lister == nil {
+		log.Panic().Msg("lister is nil")
+	}
+	return &Discoverer{
+		lister:   lister,
+		criteria: criteria,
+		interval: interval,
+		opts:     applyOptions(opts),
+		channels: make(map[string]*tracked),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Run discovers channels until the context is canceled or Stop is called.
+//
+// Run waits for all the spawned watchers to exit before returning.
+func (d *Discoverer) Run(ctx context.Context, watch WatchFunc) error {
+	log.Info().
+		Stringer("interval", d.interval).
+		Int("maxChannels", d.opts.maxChannels).
+		Msg("channel discovery started")
+	if d.criteria.IsZero() {
+		log.Warn().Msg("discovery has no criteria, every live channel will be watched")
+	}
+
+	defer d.wg.Wait()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Discover(ctx, watch); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Err(err).Msg("failed to discover channels")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("channel discovery stopped")
+			return ctx.Err()
+		case <-d.stopped:
+			log.Info().Msg("channel discovery stopped, retiring the discovered channels")
+			d.mu.Lock()
+			for channelID, t := range d.channels {
+				d.retireLocked(channelID, t)
+			}
+			d.mu.Unlock()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the discovery and retires the discovered channels. Run returns once
+// their watchers exited.
+func (d *Discoverer) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopped)
+	})
+}
+
+// Discover fetches the channel list once, spawns the watchers of the new
+// matching channels and retires the watchers of the stale channels.
+//
+// The watchers are spawned with the given context.
+func (d *Discoverer) Discover(ctx context.Context, watch WatchFunc) error {
+	spanCtx, span := otel.Tracer(tracerName).Start(ctx, "discovery.Discover")
+	defer span.End()
+
+	list, err := d.lister.GetChannelList(spanCtx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	watched := d.Watched()
+	matches := make([]api.GetChannelListChannel, 0)
+	for _, channel := range list.Channel {
+		if !d.criteria.Match(channel) {
+			continue
+		}
+		if !slices.Contains(watched, channel.ID) && d.isExcluded(channel.ID) {
+			continue
+		}
+		matches = append(matches, channel)
+	}
+	// Most viewed channels first, in case the cap is reached.
+	slices.SortStableFunc(matches, func(a, b api.GetChannelListChannel) int {
+		countA, _ := a.Count.Int64()
+		countB, _ := b.Count.Int64()
+		return cmp.Compare(countB, countA)
+	})
+
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, channel := range matches {
+		if t, ok := d.channels[channel.ID]; ok {
+			t.lastSeen = now
+			continue
+		}
+		if d.opts.maxChannels > 0 && len(d.channels) >= d.opts.maxChannels {
+			log.Debug().
+				Str("channelID", channel.ID).
+				Msg("discovered channel ignored, max channels reached")
+			continue
+		}
+		d.spawnLocked(ctx, watch, channel, now)
+	}
+
+	for channelID, t := range d.channels {
+		if t.lastSeen.Equal(now) || now.Sub(t.lastSeen) < d.opts.retireAfter {
+			continue
+		}
+		d.retireLocked(channelID, t)
+	}
+
+	span.SetAttributes(
+		attribute.Int("matches", len(matches)),
+		attribute.Int("watched", len(d.channels)),
+	)
+	return nil
+}
+
+// Retire stops watching a discovered channel after its current recording, for
+// example because the channel is watched elsewhere.
+//
+// The channel can be discovered again once its watcher exited. Retire returns
+// false if the channel is not watched.
+func (d *Discoverer) Retire(channelID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.channels[channelID]
+	if !ok {
+		return false
+	}
+	d.retireLocked(channelID, t)
+	return true
+}
+
+func (d *Discoverer) retireLocked(channelID string, t *tracked) {
+	if t.retiring {
+		return
+	}
+	log.Info().Str("channelID", channelID).Msg("retiring discovered channel")
+	t.retiring = true
+	close(t.stop)
+}
+
+// Watched returns the IDs of the discovered channels currently watched,
+// including the retired channels which are finishing their recording.
+func (d *Discoverer) Watched() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	channelIDs := make([]string, 0, len(d.channels))
+	for channelID := range d.channels {
+		channelIDs = append(channelIDs, channelID)
+	}
+	slices.Sort(channelIDs)
+	return channelIDs
+}
+
+func (d *Discoverer) spawnLocked(
+	ctx context.Context,
+	watch WatchFunc,
+	channel api.GetChannelListChannel,
+	now time.Time,
+) {
+	log.Info().
+		Str("channelID", channel.ID).
+		Str("name", channel.Name).
+		Str("title", channel.Title).
+		Msg("discovered channel")
+
+	t := &tracked{
+		stop:     make(chan struct{}),
+		lastSeen: now,
+	}
+	d.channels[channel.ID] = t
+
+	d.wg.Go(func() {
+		watch(ctx, channel.ID, t.stop)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		// The watcher may exit by itself, allow it to be discovered again.
+		if d.channels[channel.ID] == t {
+			delete(d.channels, channel.ID)
+		}
+	})
+}
+
+func (d *Discoverer) isExcluded(channelID string) bool {
+	for _, exclude := range d.opts.exclude {
+		if exclude(channelID) {
+			return true
+		}
+	}
+	return false
+}
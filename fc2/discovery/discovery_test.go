@@ -0,0 +1,240 @@
+package discovery_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/discovery"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLister struct {
+	mu   sync.Mutex
+	resp api.GetChannelListResponse
+}
+
+func (l *fakeLister) GetChannelList(_ context.Context) (api.GetChannelListResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.resp, nil
+}
+
+func (l *fakeLister) set(channels ...api.GetChannelListChannel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resp = api.GetChannelListResponse{Channel: channels}
+}
+
+type fakeWatcher struct {
+	started chan string
+	stopped chan string
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{
+		started: make(chan string, 10),
+		stopped: make(chan string, 10),
+	}
+}
+
+func (w *fakeWatcher) watch(ctx context.Context, channelID string, stop <-chan struct{}) {
+	w.started <- channelID
+	select {
+	case <-ctx.Done():
+	case <-stop:
+	}
+	w.stopped <- channelID
+}
+
+func TestCriteriaMatch(t *testing.T) {
+	criteria := discovery.Criteria{
+		Categories: []string{"1", "2"},
+		Keywords:   []string{"Karaoke"},
+		MinViewers: 10,
+		Languages:  []string{"ja"},
+	}
+
+	tests := []struct {
+		title    string
+		channel  api.GetChannelListChannel
+		expected bool
+	}{
+		{
+			title: "Match",
+			channel: api.GetChannelListChannel{
+				Category: "2",
+				Title:    "karaoke night",
+				Count:    "12",
+				Lang:     "ja",
+			},
+			expected: true,
+		},
+		{
+			title: "Wrong category",
+			channel: api.GetChannelListChannel{
+				Category: "3",
+				Title:    "karaoke night",
+				Count:    "12",
+				Lang:     "ja",
+			},
+			expected: false,
+		},
+		{
+			title: "Missing keyword",
+			channel: api.GetChannelListChannel{
+				Category: "1",
+				Title:    "talk",
+				Count:    "12",
+				Lang:     "ja",
+			},
+			expected: false,
+		},
+		{
+			title: "Not enough viewers",
+			channel: api.GetChannelListChannel{
+				Category: "1",
+				Title:    "karaoke night",
+				Count:    "9",
+				Lang:     "ja",
+			},
+			expected: false,
+		},
+		{
+			title: "Wrong language",
+			channel: api.GetChannelListChannel{
+				Category: "1",
+				Title:    "karaoke night",
+				Count:    "12",
+				Lang:     "en",
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			require.Equal(t, tt.expected, criteria.Match(tt.channel))
+		})
+	}
+}
+
+func TestDiscoverMaxChannels(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lister := &fakeLister{}
+	lister.set(
+		api.GetChannelListChannel{ID: "low", Count: "1"},
+		api.GetChannelListChannel{ID: "excluded", Count: "100"},
+		api.GetChannelListChannel{ID: "high", Count: "10"},
+	)
+	w := newFakeWatcher()
+	d := discovery.New(
+		lister,
+		discovery.Criteria{},
+		time.Minute,
+		discovery.WithMaxChannels(1),
+		discovery.WithExclude("excluded"),
+	)
+
+	// Act
+	err := d.Discover(ctx, w.watch)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "high", <-w.started)
+	require.Equal(t, []string{"high"}, d.Watched())
+}
+
+func TestDiscoverRetire(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lister := &fakeLister{}
+	lister.set(api.GetChannelListChannel{ID: "1"})
+	w := newFakeWatcher()
+	d := discovery.New(
+		lister,
+		discovery.Criteria{},
+		time.Minute,
+		discovery.WithRetireAfter(0),
+	)
+	require.NoError(t, d.Discover(ctx, w.watch))
+	require.Equal(t, "1", <-w.started)
+
+	// Act
+	lister.set()
+	err := d.Discover(ctx, w.watch)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "1", <-w.stopped)
+	require.Eventually(t, func() bool {
+		return len(d.Watched()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRetire(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lister := &fakeLister{}
+	lister.set(api.GetChannelListChannel{ID: "1"})
+	w := newFakeWatcher()
+	var excluded atomic.Bool
+	d := discovery.New(
+		lister,
+		discovery.Criteria{},
+		time.Minute,
+		discovery.WithExcludeFunc(func(string) bool {
+			return excluded.Load()
+		}),
+	)
+	require.NoError(t, d.Discover(ctx, w.watch))
+	require.Equal(t, "1", <-w.started)
+	// The channel is watched elsewhere.
+	excluded.Store(true)
+	require.NoError(t, d.Discover(ctx, w.watch))
+	require.Equal(t, []string{"1"}, d.Watched())
+
+	// Act
+	retired := d.Retire("1")
+
+	// Assert
+	require.True(t, retired)
+	require.Equal(t, "1", <-w.stopped)
+	require.Eventually(t, func() bool {
+		return len(d.Watched()) == 0
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, d.Retire("1"))
+	require.NoError(t, d.Discover(ctx, w.watch))
+	require.Empty(t, w.started)
+}
+
+func TestStop(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lister := &fakeLister{}
+	lister.set(api.GetChannelListChannel{ID: "1"})
+	w := newFakeWatcher()
+	d := discovery.New(lister, discovery.Criteria{}, time.Minute)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- d.Run(ctx, w.watch)
+	}()
+	require.Equal(t, "1", <-w.started)
+
+	// Act
+	d.Stop()
+
+	// Assert
+	require.NoError(t, <-errs)
+	require.Equal(t, "1", <-w.stopped)
+	require.NoError(t, ctx.Err())
+	require.Empty(t, d.Watched())
+}
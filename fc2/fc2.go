@@ -7,17 +7,23 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/limiter"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/postprocess"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/presence"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/subtitle"
+	"github.com/Darkness4/fc2-live-dl-go/hls"
 	"github.com/Darkness4/fc2-live-dl-go/notify/notifier"
 	"github.com/Darkness4/fc2-live-dl-go/state"
 	"github.com/Darkness4/fc2-live-dl-go/telemetry/metrics"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
 	"github.com/Darkness4/fc2-live-dl-go/utils/try"
-	"github.com/Darkness4/fc2-live-dl-go/video/concat"
 	"github.com/Darkness4/fc2-live-dl-go/video/probe"
-	"github.com/Darkness4/fc2-live-dl-go/video/remux"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -31,6 +37,12 @@ const (
 	msgBufMax     = 100
 	errBufMax     = 10
 	commentBufMax = 100
+	eventBufMax   = 100
+
+	skippedPollInterval = time.Minute
+	// syncInterval is the interval between two flushes of the recording to the
+	// disk.
+	syncInterval = 10 * time.Second
 )
 
 var (
@@ -39,17 +51,82 @@ var (
 
 	// ErrQualityNotExpected is returned when the quality is not expected.
 	ErrQualityNotExpected = errors.New("requested quality is not expected")
+
+	// ErrRecordingStopped is the cause of the cancellation of a recording
+	// stopped by StopRecording.
+	ErrRecordingStopped = errors.New("recording stopped")
 )
 
+// Option is the option for FC2.
+type Option func(*Options)
+
+// Options are the options for FC2.
+type Options struct {
+	presence      *presence.Poller
+	limiter       *limiter.Limiter
+	postProcessor *postprocess.Queue
+}
+
+// WithPresence makes Watch wait for the channel to be seen by the presence
+// poller instead of polling the metadata of the channel.
+func WithPresence(p *presence.Poller) Option {
+	return func(o *Options) {
+		o.presence = p
+	}
+}
+
+// WithLimiter makes Watch acquire a download slot from the limiter before
+// downloading a live stream.
+func WithLimiter(l *limiter.Limiter) Option {
+	return func(o *Options) {
+		o.limiter = l
+	}
+}
+
+// WithPostProcessor runs the post-processing jobs in the queue instead of
+// running them immediately.
+func WithPostProcessor(q *postprocess.Queue) Option {
+	return func(o *Options) {
+		o.postProcessor = q
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 // FC2 is responsible to watch a FC2 channel.
 type FC2 struct {
 	*api.Client
 	Params    Params
 	ChannelID string
+
+	opts *Options
+
+	mu        sync.Mutex
+	pending   *reload
+	stopped   bool
+	paused    bool
+	wake      bool
+	interrupt context.CancelFunc
+	// stopRecording cancels the current recording, if any.
+	stopRecording context.CancelCauseFunc
+	// stoppedStream is the start time of the live stream stopped by
+	// StopRecording, which must not be recorded again.
+	stoppedStream string
+}
+
+type reload struct {
+	params Params
+	opts   *Options
 }
 
 // New creates a new FC2.
-func New(client *api.Client, params Params, channelID string) *FC2 {
+func New(client *api.Client, params Params, channelID string, opts ...Option) *FC2 {
 	if client == nil {
 		log.Panic().Msg("client is nil")
 	}
@@ -57,6 +134,7 @@ func New(client *api.Client, params Params, channelID string) *FC2 {
 		Client:    client,
 		Params:    params,
 		ChannelID: channelID,
+		opts:      applyOptions(opts),
 	}
 }
 
@@ -79,40 +157,182 @@ func (f *FC2) Watch(ctx context.Context) error {
 	delayIndex := 0
 
 	for {
-		state.DefaultState.SetChannelState(
-			f.ChannelID,
-			state.DownloadStateIdle,
-			state.WithLabels(f.Params.Labels),
-		)
-		if err := notifier.NotifyIdle(ctx, f.ChannelID, f.Params.Labels); err != nil {
-			log.Err(err).Msg("notify failed")
+		if !f.applyReload(ctx) {
+			log.Info().Msg("stopped watching channel")
+			return nil
 		}
 
-		res, err := f.IsOnline(ctx)
+		if f.Paused() {
+			log.Info().Msg("watcher paused")
+			state.DefaultState.SetChannelState(
+				f.ChannelID,
+				state.DownloadStatePaused,
+				state.WithLabels(f.Params.Labels),
+			)
+			// The wait is interrupted by Resume, Reload and Stop.
+			waitCtx, cancelWait := f.waitContext(ctx)
+			<-waitCtx.Done()
+			cancelWait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+
+		// A skipped stream stays skipped until it ends, even if the wait is
+		// interrupted.
+		if state.DefaultState.GetChannelState(f.ChannelID) != state.DownloadStateSkipped {
+			f.setIdle(ctx)
+		}
+
+		// The waits are interrupted by Reload and Stop.
+		waitCtx, cancelWait := f.waitContext(ctx)
+
+		res, err := f.IsOnline(waitCtx)
 		if err != nil {
 			log.Err(err).Msg("failed to check if online")
 			if errors.Is(err, context.Canceled) {
-				return nil
+				cancelWait()
+				if ctx.Err() != nil {
+					return nil
+				}
+				continue
 			}
 		}
 
 		if res.Meta.ChannelData.IsPublish == 0 {
+			f.setIdle(ctx)
 			if !f.Params.WaitForLive {
+				cancelWait()
 				return ErrLiveStreamNotOnline
 			}
-			if res, err = f.WaitForOnline(ctx, f.Params.WaitPollInterval); err != nil {
+			if f.opts.presence != nil {
+				res, err = f.WaitForPresence(waitCtx, f.opts.presence)
+			} else {
+				res, err = f.WaitForOnline(waitCtx, f.Params.WaitPollInterval)
+			}
+			if err != nil {
+				cancelWait()
+				if errors.Is(err, context.Canceled) {
+					if ctx.Err() != nil {
+						return nil
+					}
+					continue
+				}
 				log.Err(err).Msg("failed to check if online")
+				continue
+			}
+		}
+
+		if reason := f.skipReason(res.Meta, time.Now()); reason != "" {
+			err := f.waitWhileSkipped(waitCtx, res, reason)
+			cancelWait()
+			if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+				return nil
+			}
+			continue
+		} else if !f.Params.Filters.IsZero() {
+			log.Info().
+				Str("title", res.Meta.ChannelData.Title).
+				Str("category", res.Meta.ChannelData.CategoryName).
+				Msg("stream accepted by filters")
+		}
+		cancelWait()
+
+		var slot *limiter.Slot
+		if f.opts.limiter != nil {
+			// The wait for a slot is interrupted by Reload and Stop. The
+			// download is queued again with the new values.
+			waitCtx, cancelWait := f.waitContext(ctx)
+			slot, res, err = f.acquireSlot(waitCtx, res)
+			cancelWait()
+			if err != nil {
 				if errors.Is(err, context.Canceled) {
-					return nil
+					if ctx.Err() != nil {
+						return nil
+					}
+					continue
+				}
+				if !errors.Is(err, ErrLiveStreamNotOnline) {
+					log.Err(err).Msg("failed to check if online")
 				}
 				continue
 			}
 		}
 
-		err = f.Process(ctx, res.Meta, res.WebsocketURL)
+		if f.isStopped() {
+			if slot != nil {
+				slot.Release()
+			}
+			log.Info().Msg("stopped watching channel")
+			return nil
+		}
+
+		recordingID := state.DefaultState.StartRecording(
+			f.ChannelID,
+			res.Meta.ChannelData.Title,
+			f.Params.Labels,
+		)
+		recCtx, cancelRecording := context.WithCancelCause(ctx)
+		stopPreemption := func() bool { return false }
+		if slot != nil {
+			// The recording is canceled if the slot is preempted.
+			stopPreemption = context.AfterFunc(slot.Context(), func() {
+				cancelRecording(nil)
+			})
+		}
+		f.setStopRecording(cancelRecording)
+		// The recording is post-processed in the background, its files are set
+		// in the history once done.
+		err = f.process(recCtx, res.Meta, res.WebsocketURL, recordingID)
+		stoppedByUser := errors.Is(context.Cause(recCtx), ErrRecordingStopped)
+		f.setStopRecording(nil)
+		stopPreemption()
+		cancelRecording(nil)
+		if slot != nil {
+			slot.Release()
+		}
 
-		if errors.Is(err, context.Canceled) {
+		if slot != nil && slot.Preempted() && ctx.Err() == nil {
+			log.Warn().Msg("download preempted by a channel with a higher priority")
+			state.DefaultState.FinishRecording(
+				recordingID,
+				state.RecordingStatusPreempted,
+				nil,
+				nil,
+			)
+			state.DefaultState.SetChannelState(
+				f.ChannelID,
+				state.DownloadStatePreempted,
+				state.WithLabels(f.Params.Labels),
+				state.WithExtra(map[string]any{
+					"metadata": res.Meta,
+				}),
+			)
+			if err := notifier.NotifyPreempted(ctx, f.ChannelID, f.Params.Labels, res.Meta); err != nil {
+				log.Err(err).Msg("notify failed")
+			}
+			continue
+		} else if stoppedByUser && ctx.Err() == nil {
+			log.Info().Msg("recording stopped, the stream won't be recorded again")
+			state.DefaultState.FinishRecording(
+				recordingID,
+				state.RecordingStatusCanceled,
+				nil,
+				nil,
+			)
+			f.mu.Lock()
+			f.stoppedStream = res.Meta.ChannelData.Start.String()
+			f.mu.Unlock()
+			continue
+		} else if errors.Is(err, context.Canceled) {
 			log.Info().Msg("abort watching channel")
+			state.DefaultState.FinishRecording(
+				recordingID,
+				state.RecordingStatusCanceled,
+				nil,
+				nil,
+			)
 			if state.DefaultState.GetChannelState(
 				f.ChannelID,
 			) != state.DownloadStateIdle {
@@ -131,7 +351,14 @@ func (f *FC2) Watch(ctx context.Context) error {
 			}
 			return nil
 		} else if err != nil {
-			log.Err(err).Msg("failed to download")
+			if errors.Is(err, hls.ErrStreamStalled) {
+				// The stream may still be live, the channel is checked again
+				// immediately.
+				log.Warn().Err(err).Msg("the stream stalled, checking if it is still live")
+			} else {
+				log.Err(err).Msg("failed to download")
+			}
+			state.DefaultState.FinishRecording(recordingID, state.RecordingStatusFailed, nil, err)
 			state.DefaultState.SetChannelError(f.ChannelID, err)
 			if err := notifier.NotifyError(
 				context.Background(),
@@ -149,19 +376,297 @@ func (f *FC2) Watch(ctx context.Context) error {
 				}
 			}
 		} else {
+			state.DefaultState.FinishRecording(
+				recordingID,
+				state.RecordingStatusFinished,
+				nil,
+				nil,
+			)
 			state.DefaultState.SetChannelState(
 				f.ChannelID,
 				state.DownloadStateFinished,
 				state.WithLabels(f.Params.Labels),
 			)
-			if err := notifier.NotifyFinished(ctx, f.ChannelID, f.Params.Labels, res.Meta); err != nil {
-				log.Err(err).Msg("notify failed")
-			}
 			delayIndex = 0
 		}
 	}
 }
 
+// Reload replaces the parameters and the options of the watcher.
+//
+// The new values take effect before the next stream. If the watcher is waiting
+// for a stream, the wait is restarted with the new values. The current
+// recording, if any, is not affected.
+func (f *FC2) Reload(params Params, opts ...Option) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = &reload{
+		params: params,
+		opts:   applyOptions(opts),
+	}
+	if f.interrupt != nil {
+		f.interrupt()
+	}
+}
+
+// Stop stops the watcher after the current recording, if any.
+//
+// Watch returns nil once stopped.
+func (f *FC2) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	if f.interrupt != nil {
+		f.interrupt()
+	}
+}
+
+func (f *FC2) isStopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopped
+}
+
+// Pause pauses the watcher after the current recording, if any.
+func (f *FC2) Pause() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = true
+	f.wakeLocked()
+}
+
+// Resume resumes the paused watcher.
+func (f *FC2) Resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = false
+	f.wakeLocked()
+}
+
+// Paused returns true if the watcher is paused.
+func (f *FC2) Paused() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paused
+}
+
+// Check makes the watcher check immediately if the channel is online, instead
+// of waiting for the next poll.
+//
+// It has no effect on the current recording, if any.
+func (f *FC2) Check() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.wakeLocked()
+}
+
+// StopRecording stops the current recording, which is then post-processed.
+// The live stream is not recorded again.
+//
+// It returns false if there is no recording.
+func (f *FC2) StopRecording() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopRecording == nil {
+		return false
+	}
+	f.stopRecording(ErrRecordingStopped)
+	return true
+}
+
+// Recording returns true if the watcher is recording.
+func (f *FC2) Recording() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopRecording != nil
+}
+
+func (f *FC2) setStopRecording(cancel context.CancelCauseFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopRecording = cancel
+}
+
+// wakeLocked interrupts the current wait, or the next one if the watcher is
+// not waiting.
+func (f *FC2) wakeLocked() {
+	if f.interrupt != nil {
+		f.interrupt()
+		return
+	}
+	f.wake = true
+}
+
+// applyReload applies the pending reload, if any. It returns false if the
+// watcher is stopped.
+func (f *FC2) applyReload(ctx context.Context) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return false
+	}
+	if f.pending != nil {
+		f.Params = f.pending.params
+		f.opts = f.pending.opts
+		f.pending = nil
+		log.Ctx(ctx).Info().Any("params", f.Params).Msg("reloaded params")
+	}
+	return true
+}
+
+// waitContext returns a context which is canceled by Reload and Stop.
+func (f *FC2) waitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped || f.pending != nil || f.wake {
+		f.wake = false
+		cancel()
+	}
+	f.interrupt = cancel
+	return ctx, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.interrupt = nil
+		cancel()
+	}
+}
+
+// skipReason returns the reason why the live stream must not be recorded, or an
+// empty string if it must be recorded.
+func (f *FC2) skipReason(meta api.GetMetaData, now time.Time) string {
+	f.mu.Lock()
+	stopped := f.stoppedStream != "" && f.stoppedStream == meta.ChannelData.Start.String()
+	f.mu.Unlock()
+	if stopped {
+		return "recording stopped"
+	}
+	if !f.Params.Schedule.Contains(now) {
+		return "outside of the schedule"
+	}
+	if rule := f.Params.Filters.Reject(meta.ChannelData); rule != "" {
+		return "rejected by filter: " + rule
+	}
+	return ""
+}
+
+// setIdle sets the channel idle. The channel is only notified if it was not
+// idle already, since the waits are restarted on each interrupt.
+func (f *FC2) setIdle(ctx context.Context) {
+	prev := state.DefaultState.GetChannelState(f.ChannelID)
+	state.DefaultState.SetChannelState(
+		f.ChannelID,
+		state.DownloadStateIdle,
+		state.WithLabels(f.Params.Labels),
+	)
+	if prev == state.DownloadStateIdle {
+		return
+	}
+	if err := notifier.NotifyIdle(ctx, f.ChannelID, f.Params.Labels); err != nil {
+		log.Ctx(ctx).Err(err).Msg("notify failed")
+	}
+}
+
+// waitWhileSkipped waits until the skipped live stream ends or must be recorded.
+//
+// The channel is only notified if it was not skipped already.
+func (f *FC2) waitWhileSkipped(ctx context.Context, res IsOnlineResult, reason string) error {
+	log := log.Ctx(ctx)
+	log.Info().
+		Str("title", res.Meta.ChannelData.Title).
+		Str("category", res.Meta.ChannelData.CategoryName).
+		Str("reason", reason).
+		Msg("stream is live but skipped")
+	prev := state.DefaultState.GetChannelState(f.ChannelID)
+	state.DefaultState.SetChannelState(
+		f.ChannelID,
+		state.DownloadStateSkipped,
+		state.WithLabels(f.Params.Labels),
+		state.WithExtra(map[string]any{
+			"metadata": res.Meta,
+			"reason":   reason,
+		}),
+	)
+	if prev != state.DownloadStateSkipped {
+		if err := notifier.NotifySkipped(ctx, f.ChannelID, f.Params.Labels, res.Meta, reason); err != nil {
+			log.Err(err).Msg("notify failed")
+		}
+	}
+
+	ticker := time.NewTicker(skippedPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		res, err := f.IsOnline(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Err(err).Msg("failed to check if online")
+			continue
+		}
+		if res.Meta.ChannelData.IsPublish == 0 {
+			log.Info().Msg("skipped stream ended")
+			return nil
+		}
+		if f.skipReason(res.Meta, time.Now()) == "" {
+			log.Info().Msg("stream is no longer skipped")
+			return nil
+		}
+	}
+}
+
+// acquireSlot waits for a download slot.
+//
+// If the channel had to wait, the metadata is fetched again since the stream
+// may have ended and the websocket URL may have expired.
+func (f *FC2) acquireSlot(
+	ctx context.Context,
+	res IsOnlineResult,
+) (*limiter.Slot, IsOnlineResult, error) {
+	log := log.Ctx(ctx)
+	queued := false
+	slot, err := f.opts.limiter.Acquire(ctx, f.ChannelID, f.Params.Priority, func() {
+		queued = true
+		log.Info().Int("priority", f.Params.Priority).Msg("all download slots are taken, queued")
+		state.DefaultState.SetChannelState(
+			f.ChannelID,
+			state.DownloadStateQueued,
+			state.WithLabels(f.Params.Labels),
+			state.WithExtra(map[string]any{
+				"metadata": res.Meta,
+				"priority": f.Params.Priority,
+			}),
+		)
+		if err := notifier.NotifyQueued(ctx, f.ChannelID, f.Params.Labels, res.Meta); err != nil {
+			log.Err(err).Msg("notify failed")
+		}
+	})
+	if err != nil {
+		return nil, res, err
+	}
+	if !queued {
+		return slot, res, nil
+	}
+
+	log.Info().Msg("download slot acquired")
+	res, err = f.IsOnline(ctx)
+	if err != nil {
+		slot.Release()
+		return nil, res, err
+	}
+	if res.Meta.ChannelData.IsPublish == 0 {
+		slot.Release()
+		return nil, res, ErrLiveStreamNotOnline
+	}
+	return slot, res, nil
+}
+
 // WaitForOnline waits for the live stream to be online.
 func (f *FC2) WaitForOnline(ctx context.Context, interval time.Duration) (IsOnlineResult, error) {
 	log := log.Ctx(ctx)
@@ -174,7 +679,51 @@ func (f *FC2) WaitForOnline(ctx context.Context, interval time.Duration) (IsOnli
 		if res.Meta.ChannelData.IsPublish > 0 {
 			return res, nil
 		}
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			return IsOnlineResult{}, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// WaitForPresence waits for the live stream to be online by listening to the
+// presence poller.
+//
+// The metadata is only fetched to confirm that the channel is online, or
+// periodically at the fallback interval of the poller.
+func (f *FC2) WaitForPresence(ctx context.Context, p *presence.Poller) (IsOnlineResult, error) {
+	log := log.Ctx(ctx)
+	log.Info().
+		Stringer("fallback-interval", p.FallbackInterval()).
+		Msg("waiting for stream via presence poller")
+
+	online, unsubscribe := p.Subscribe(f.ChannelID)
+	defer unsubscribe()
+
+	var fallback <-chan time.Time
+	if p.FallbackInterval() > 0 {
+		ticker := time.NewTicker(p.FallbackInterval())
+		defer ticker.Stop()
+		fallback = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return IsOnlineResult{}, ctx.Err()
+		case <-online:
+			log.Debug().Msg("presence poller reported the channel online, confirming")
+		case <-fallback:
+		}
+
+		res, err := f.IsOnline(ctx)
+		if err != nil {
+			return IsOnlineResult{}, err
+		}
+		if res.Meta.ChannelData.IsPublish > 0 {
+			return res, nil
+		}
 	}
 }
 
@@ -228,6 +777,20 @@ func (f *FC2) Process(
 	ctx context.Context,
 	meta api.GetMetaData,
 	wsURL string,
+) error {
+	return f.process(ctx, meta, wsURL, "")
+}
+
+// process downloads the live stream, then post-processes the recording.
+//
+// With a post-processing queue, the recording is post-processed in the
+// background. The files of the recording recordingID, if not empty, are set in
+// the history once post-processed.
+func (f *FC2) process(
+	ctx context.Context,
+	meta api.GetMetaData,
+	wsURL string,
+	recordingID string,
 ) error {
 	log := log.Ctx(ctx)
 	ctx, span := otel.Tracer(tracerName).
@@ -248,7 +811,8 @@ func (f *FC2) Process(
 		log.Err(err).Msg("notify failed")
 	}
 
-	fnameInfo, err := PrepareFileAutoRename(f.Params.OutFormat, meta, f.Params.Labels, "info.json")
+	scratchDir := f.Params.ScratchDirectory
+	fnameInfo, err := PrepareScratchFileAutoRename(f.Params.OutFormat, meta, f.Params.Labels, "info.json", scratchDir)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -258,30 +822,86 @@ func (f *FC2) Process(
 	if f.Params.Concat {
 		fnameThumb, err = PrepareFile(f.Params.OutFormat, meta, f.Params.Labels, "png")
 	} else {
-		fnameThumb, err = PrepareFileAutoRename(f.Params.OutFormat, meta, f.Params.Labels, "png")
+		fnameThumb, err = PrepareScratchFileAutoRename(f.Params.OutFormat, meta, f.Params.Labels, "png", scratchDir)
 	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	fnameStream, err := PrepareFileAutoRename(f.Params.OutFormat, meta, f.Params.Labels, "ts")
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
+	var resumed *StreamCheckpoint
+	if f.Params.CheckpointDirectory != "" {
+		resumed = loadResumableCheckpoint(ctx, f.Params.CheckpointDirectory, meta)
+	}
+	// fnameStreamFinal is the name of the recording once moved out of the
+	// scratch directory.
+	var fnameStream, fnameStreamFinal string
+	if resumed != nil {
+		fnameStream = resumed.OutputFileName
+		fnameStreamFinal = resumed.FinalFileName
+		if fnameStreamFinal == "" {
+			fnameStreamFinal = fnameStream
+		}
+		log.Info().
+			Str("fnameStream", fnameStream).
+			Str("lastFragment", resumed.Checkpoint.LastFragmentName).
+			Msg("resuming download from checkpoint")
+	} else {
+		fnameStreamFinal, err = PrepareScratchFileAutoRename(f.Params.OutFormat, meta, f.Params.Labels, "ts", scratchDir)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+	fnameReport := strings.TrimSuffix(fnameStreamFinal, filepath.Ext(fnameStreamFinal)) + ".report.json"
+	fnameTimeline := strings.TrimSuffix(fnameStreamFinal, filepath.Ext(fnameStreamFinal)) + ".timeline.json"
+	// The chat of the resumed download is continued.
+	resumedChat := resumed != nil && resumed.ChatFileName != ""
+	var fnameChat string
+	if resumedChat {
+		fnameChat = resumed.ChatFileName
+	} else {
+		fnameChat, err = PrepareScratchFileAutoRename(
+			f.Params.OutFormat,
+			meta,
+			f.Params.Labels,
+			"fc2chat.json",
+			scratchDir,
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
 	}
-	fnameChat, err := PrepareFileAutoRename(
+	fnameEvents, err := PrepareScratchFileAutoRename(
 		f.Params.OutFormat,
 		meta,
 		f.Params.Labels,
-		"fc2chat.json",
+		"fc2events.json",
+		scratchDir,
 	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
+	var subtitleFormat subtitle.Format
+	var fnameSubtitle string
+	if f.Params.WriteChat && f.Params.ConvertChat != "" {
+		subtitleFormat, err = subtitle.ParseFormat(f.Params.ConvertChat)
+		if err != nil {
+			log.Err(err).Msg("the chat won't be converted")
+		} else {
+			fnameSubtitle, err = PrepareFile(f.Params.OutFormat, meta, f.Params.Labels, string(subtitleFormat))
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+		}
+	}
 	fnameMuxedExt := strings.ToLower(f.Params.RemuxFormat)
 	fnameMuxed, err := PrepareFile(f.Params.OutFormat, meta, f.Params.Labels, fnameMuxedExt)
 	if err != nil {
@@ -306,10 +926,6 @@ func (f *FC2) Process(
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	nameConcatenatedPrefix := strings.TrimSuffix(
-		nameConcatenated,
-		".combined."+fnameMuxedExt,
-	)
 	nameAudioConcatenated, err := FormatOutput(
 		f.Params.OutFormat,
 		meta,
@@ -321,6 +937,48 @@ func (f *FC2) Process(
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
+
+	// The files are written and post-processed in the scratch directory, then
+	// moved to their final name.
+	finalNames := make(map[string]string)
+	inScratch := func(name string) string {
+		if scratchDir == "" {
+			return name
+		}
+		path := ScratchPath(scratchDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Err(err).Str("path", path).Msg("failed to create the scratch directory")
+		}
+		finalNames[path] = name
+		return path
+	}
+	fnameInfo = inScratch(fnameInfo)
+	fnameThumb = inScratch(fnameThumb)
+	if resumed == nil {
+		fnameStream = inScratch(fnameStreamFinal)
+	}
+	fnameReport = inScratch(fnameReport)
+	fnameTimeline = inScratch(fnameTimeline)
+	if !resumedChat {
+		fnameChat = inScratch(fnameChat)
+	} else if resumed.FinalChatFileName != "" {
+		finalNames[fnameChat] = resumed.FinalChatFileName
+	}
+	fnameEvents = inScratch(fnameEvents)
+	if fnameSubtitle != "" {
+		fnameSubtitle = inScratch(fnameSubtitle)
+	}
+	fnameMuxed = inScratch(fnameMuxed)
+	fnameAudio = inScratch(fnameAudio)
+	nameConcatenated = inScratch(nameConcatenated)
+	nameAudioConcatenated = inScratch(nameAudioConcatenated)
+	// The recording is only moved once it is finished, see below.
+	delete(finalNames, fnameStream)
+
+	nameConcatenatedPrefix := strings.TrimSuffix(
+		nameConcatenated,
+		".combined."+fnameMuxedExt,
+	)
 	nameAudioConcatenatedPrefix := strings.TrimSuffix(
 		nameAudioConcatenated,
 		".combined.m4a",
@@ -328,20 +986,9 @@ func (f *FC2) Process(
 
 	if f.Params.WriteInfoJSON {
 		log.Info().Str("fnameInfo", fnameInfo).Msg("writing info json")
-		func() {
-			f, err := os.OpenFile(fnameInfo, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to open info json")
-				return
-			}
-			defer f.Close()
-			enc := json.NewEncoder(f)
-			enc.SetIndent("", "  ")
-			if err := enc.Encode(meta); err != nil {
-				log.Error().Err(err).Msg("failed to encode meta in info json")
-				return
-			}
-		}()
+		if err := writeJSON(fnameInfo, meta); err != nil {
+			log.Error().Err(err).Msg("failed to write info json")
+		}
 	}
 
 	if f.Params.WriteThumbnail {
@@ -354,17 +1001,20 @@ func (f *FC2) Process(
 				return
 			}
 			defer resp.Body.Close()
-			out, err := os.Create(fnameThumb)
+			out, err := os.Create(utils.PartName(fnameThumb))
 			if err != nil {
 				log.Error().Err(err).Msg("failed to open thumbnail file")
 				return
 			}
-			defer out.Close()
 			_, err = io.Copy(out, resp.Body)
+			_ = out.Close()
 			if err != nil {
 				log.Error().Err(err).Msg("failed to download thumbnail file")
 				return
 			}
+			if err := utils.FinalizePart(utils.PartName(fnameThumb), fnameThumb); err != nil {
+				log.Error().Err(err).Msg("failed to finalize thumbnail file")
+			}
 		}()
 	}
 
@@ -386,29 +1036,141 @@ func (f *FC2) Process(
 		log.Err(err).Msg("notify failed")
 	}
 
-	errWs := DownloadLiveStream(ctx, f.Client.Client, LiveStream{
+	report := hls.NewReport()
+	// recordingStart is the start of the video timeline, used to align the
+	// chat.
+	recordingStart := time.Now()
+	if resumed != nil {
+		// The report of the resumed download is continued.
+		loaded, err := hls.LoadReport(utils.PartName(fnameReport))
+		if err == nil {
+			report = loaded
+		} else if !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Msg("failed to load integrity report, a new one is written")
+		}
+		if !resumed.RecordingStart.IsZero() {
+			recordingStart = resumed.RecordingStart
+			report.StartTime = recordingStart.UTC()
+		}
+	}
+	// The files are written under their .part name until the download ends.
+	ls := LiveStream{
 		WebsocketURL:   wsURL,
-		OutputFileName: fnameStream,
-		ChatFileName:   fnameChat,
+		OutputFileName: utils.PartName(fnameStream),
+		ChatFileName:   utils.PartName(fnameChat),
+		EventsFileName: utils.PartName(fnameEvents),
 		Meta:           meta,
 		Params:         f.Params,
-	})
+		Report:         report,
+	}
+	if dir := f.Params.CheckpointDirectory; dir != "" {
+		sc := NewStreamCheckpoint(meta, fnameStream)
+		sc.RecordingStart = recordingStart
+		if fnameStreamFinal != fnameStream {
+			sc.FinalFileName = fnameStreamFinal
+		}
+		if resumed != nil {
+			sc = *resumed
+			cp := resumed.Checkpoint
+			ls.Checkpoint = &cp
+		}
+		if f.Params.WriteChat {
+			sc.ChatFileName = fnameChat
+			sc.FinalChatFileName = finalNames[fnameChat]
+		}
+		if err := sc.Save(dir); err != nil {
+			log.Err(err).Msg("failed to save checkpoint")
+		}
+		ls.OnCheckpoint = func(cp hls.Checkpoint) {
+			sc.Checkpoint = cp
+			if err := sc.Save(dir); err != nil {
+				log.Err(err).Msg("failed to save checkpoint")
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	if f.Params.PollMetadataInterval > 0 {
+		var fname string
+		if f.Params.WriteTimeline {
+			fname = utils.PartName(fnameTimeline)
+		}
+		wg.Go(func() {
+			f.watchMetadata(watchCtx, meta, fname)
+		})
+	}
+	errWs := DownloadLiveStream(ctx, f.Client.Client, ls)
+	stopWatch()
+	wg.Wait()
 	if errWs != nil && !errors.Is(errWs, context.Canceled) {
 		span.RecordError(errWs)
 		span.SetStatus(codes.Error, errWs.Error())
 		log.Error().Err(errWs).Msg("fc2 finished with error")
 	}
 
+	report.Finish()
+	if report.HasGaps() {
+		log.Warn().Str("report", report.Summary()).Msg("the recording has gaps")
+	}
+
+	// A canceled download is resumed from the checkpoint if the stream is still
+	// live on the next run.
+	keepCheckpoint := f.Params.CheckpointDirectory != "" && errors.Is(errWs, context.Canceled) &&
+		!errors.Is(context.Cause(ctx), ErrRecordingStopped)
+	if f.Params.CheckpointDirectory != "" && !keepCheckpoint {
+		if err := RemoveStreamCheckpoint(f.Params.CheckpointDirectory, meta.ChannelData.ChannelID); err != nil {
+			log.Err(err).Msg("failed to remove checkpoint")
+		}
+	}
+
+	// The report keeps its .part name to be continued.
+	if f.Params.WriteReport {
+		log.Info().Str("fnameReport", fnameReport).Msg("writing integrity report")
+		write := writeJSON
+		if keepCheckpoint {
+			write = writePartJSON
+		}
+		if err := write(fnameReport, report); err != nil {
+			log.Err(err).Msg("failed to write integrity report")
+		}
+	}
+
+	// The chat keeps its .part name to be continued.
+	if f.Params.WriteChat && !keepCheckpoint {
+		if err := finalizeFile(fnameChat); err != nil {
+			log.Err(err).Msg("failed to finalize chat file")
+		}
+	}
+	if f.Params.WriteEvents {
+		if err := finalizeFile(fnameEvents); err != nil {
+			log.Err(err).Msg("failed to finalize events file")
+		}
+	}
+	// The timeline keeps its .part name to be continued.
+	if f.Params.WriteTimeline && !keepCheckpoint {
+		if err := finalizeFile(fnameTimeline); err != nil {
+			log.Err(err).Msg("failed to finalize timeline file")
+		}
+	}
+	if fnameSubtitle != "" && !keepCheckpoint {
+		log.Info().
+			Str("output", fnameSubtitle).
+			Str("input", fnameChat).
+			Msg("converting chat to subtitles...")
+		if err := subtitle.ConvertFile(fnameSubtitle, fnameChat, recordingStart, subtitleFormat); err != nil {
+			log.Err(err).Msg("failed to convert chat to subtitles")
+		}
+	}
+	// The recording keeps its .part name to be resumed.
+	if keepCheckpoint {
+		fnameStream = utils.PartName(fnameStream)
+	} else if err := finalizeFile(fnameStream); err != nil {
+		log.Err(err).Msg("failed to finalize the recording")
+		fnameStream = utils.PartName(fnameStream)
+	}
+
 	span.AddEvent("post-processing")
-	end := metrics.TimeStartRecording(
-		ctx,
-		metrics.PostProcessing.CompletionTime,
-		time.Second,
-		metric.WithAttributes(
-			attribute.String("channel_id", f.ChannelID),
-		),
-	)
-	defer end()
 	metrics.PostProcessing.Runs.Add(ctx, 1, metric.WithAttributes(
 		attribute.String("channel_id", f.ChannelID),
 	))
@@ -430,8 +1192,6 @@ func (f *FC2) Process(
 	}
 	log.Info().Msg("post-processing...")
 
-	var remuxErr error
-
 	probeErr := probe.Do([]string{fnameStream}, probe.WithQuiet())
 	if probeErr != nil {
 		log.Error().Err(probeErr).Msg("ts is unreadable by ffmpeg")
@@ -444,81 +1204,208 @@ func (f *FC2) Process(
 			}
 		}
 	}
-	if f.Params.Remux && probeErr == nil {
-		log.Info().Str("output", fnameMuxed).Str("input", fnameStream).Msg(
-			"remuxing stream...",
-		)
-		remuxErr = remux.Do(ctx, fnameMuxed, fnameStream)
-		if remuxErr != nil {
-			log.Error().Err(remuxErr).Msg("ffmpeg remux finished with error")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", f.ChannelID),
-			))
-		}
+	// The recording is post-processed once the download is resumed and
+	// finished.
+	postProcess := probeErr == nil && !keepCheckpoint
+	embedChat := f.Params.WriteChat && f.Params.EmbedChat
+	// The jobs run one after the other: the intermediates are deleted once
+	// every job is done.
+	var jobs []state.Job
+	if f.Params.Remux && postProcess {
+		jobs = append(jobs, state.Job{
+			ChannelID:      f.ChannelID,
+			Kind:           state.JobKindRemux,
+			Input:          fnameStream,
+			Output:         fnameMuxed,
+			EmbedChat:      embedChat,
+			Chapters:       f.Params.WriteChapters,
+			Recording:      fnameStream,
+			RecordingStart: recordingStart,
+			Destination:    finalNames[fnameMuxed],
+		})
 	}
-	var extractAudioErr error
 	// Extract audio if remux on, or when concat is off.
-	if f.Params.ExtractAudio && (!f.Params.Concat || f.Params.Remux) && probeErr == nil {
-		log.Info().Str("output", fnameAudio).Str("input", fnameStream).Msg(
-			"extrating audio...",
-		)
-		extractAudioErr = remux.Do(ctx, fnameAudio, fnameStream, remux.WithAudioOnly())
-		if extractAudioErr != nil {
-			log.Error().Err(extractAudioErr).Msg("ffmpeg audio extract finished with error")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", f.ChannelID),
-			))
-		}
+	if f.Params.ExtractAudio && (!f.Params.Concat || f.Params.Remux) && postProcess {
+		jobs = append(jobs, state.Job{
+			ChannelID:   f.ChannelID,
+			Kind:        state.JobKindExtractAudio,
+			Input:       fnameStream,
+			Output:      fnameAudio,
+			Destination: finalNames[fnameAudio],
+		})
 	}
 
 	// Concat
-	if f.Params.Concat {
-		log.Info().Str("output", nameConcatenated).Str("prefix", nameConcatenatedPrefix).Msg(
-			"concatenating stream...",
-		)
-		concatOpts := []concat.Option{
-			concat.IgnoreExtension(),
-		}
-		if concatErr := concat.WithPrefix(ctx, f.Params.RemuxFormat, nameConcatenatedPrefix, concatOpts...); concatErr != nil {
-			log.Error().Err(concatErr).Msg("ffmpeg concat finished with error")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", f.ChannelID),
-			))
+	if f.Params.Concat && !keepCheckpoint {
+		jobs = append(jobs, state.Job{
+			ChannelID:      f.ChannelID,
+			Kind:           state.JobKindConcat,
+			Input:          nameConcatenatedPrefix,
+			Output:         nameConcatenated,
+			Format:         f.Params.RemuxFormat,
+			EmbedChat:      embedChat,
+			Chapters:       f.Params.WriteChapters,
+			Recording:      fnameStream,
+			RecordingStart: recordingStart,
+			Destination:    finalNames[nameConcatenated],
+		})
+		if f.Params.ExtractAudio {
+			jobs = append(jobs, state.Job{
+				ChannelID:   f.ChannelID,
+				Kind:        state.JobKindConcat,
+				Input:       nameAudioConcatenatedPrefix,
+				Output:      nameAudioConcatenated,
+				Format:      "m4a",
+				AudioOnly:   true,
+				Destination: finalNames[nameAudioConcatenated],
+			})
 		}
+	}
+
+	finish := state.Job{
+		ChannelID:   f.ChannelID,
+		Kind:        state.JobKindFinish,
+		RecordingID: recordingID,
+		Files:       []string{fnameStream},
+	}
+
+	// Delete intermediates
+	if keepCheckpoint {
+		log.Info().Str("file", fnameStream).Msg("keeping intermediate file to resume the download")
+	} else if !f.Params.KeepIntermediates && f.Params.Remux && postProcess {
+		finish.Intermediates = []string{fnameStream}
+	}
 
+	if f.Params.WriteInfoJSON {
+		finish.Files = append(finish.Files, fnameInfo)
+	}
+	if f.Params.WriteThumbnail {
+		finish.Files = append(finish.Files, fnameThumb)
+	}
+	if f.Params.WriteChat {
+		finish.Files = append(finish.Files, fnameChat)
+	}
+	if f.Params.WriteEvents {
+		finish.Files = append(finish.Files, fnameEvents)
+	}
+	if fnameSubtitle != "" {
+		finish.Files = append(finish.Files, fnameSubtitle)
+	}
+	if f.Params.WriteReport {
+		finish.Files = append(finish.Files, fnameReport)
+	}
+	if f.Params.WriteTimeline {
+		finish.Files = append(finish.Files, fnameTimeline)
+	}
+	if f.Params.Remux {
+		finish.Files = append(finish.Files, fnameMuxed, finalNames[fnameMuxed])
+	}
+	if f.Params.ExtractAudio {
+		finish.Files = append(finish.Files, fnameAudio, finalNames[fnameAudio])
+	}
+	if f.Params.Concat {
+		finish.Files = append(finish.Files, nameConcatenated, finalNames[nameConcatenated])
 		if f.Params.ExtractAudio {
-			log.Info().
-				Str("output", nameAudioConcatenated).
-				Str("prefix", nameAudioConcatenatedPrefix).
-				Msg(
-					"concatenating audio stream...",
-				)
-			concatOpts = append(concatOpts, concat.WithAudioOnly())
-			if concatErr := concat.WithPrefix(ctx, "m4a", nameAudioConcatenatedPrefix, concatOpts...); concatErr != nil {
-				log.Error().Err(concatErr).Msg("ffmpeg concat finished with error")
-				metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-					attribute.String("channel_id", f.ChannelID),
-				))
-			}
+			finish.Files = append(finish.Files, nameAudioConcatenated, finalNames[nameAudioConcatenated])
 		}
 	}
 
-	// Delete intermediates
-	if !f.Params.KeepIntermediates && f.Params.Remux &&
-		probeErr == nil &&
-		remuxErr == nil &&
-		extractAudioErr == nil {
-		log.Info().Str("file", fnameStream).Msg("delete intermediate files")
-		if err := os.Remove(fnameStream); err != nil {
-			log.Error().Err(err).Msg("couldn't delete intermediate file")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", f.ChannelID),
-			))
+	if scratchDir != "" {
+		// The recording is kept in the scratch directory to be resumed or
+		// concatenated with the next recordings.
+		if !keepCheckpoint && !f.Params.Concat {
+			finalNames[fnameStream] = fnameStreamFinal
+		}
+		finish.FinalNames = finalNames
+	}
+
+	if errWs == nil {
+		finish.Labels = f.Params.Labels
+		if finish.Metadata, err = json.Marshal(meta); err != nil {
+			log.Err(err).Msg("failed to encode metadata")
+		}
+		if finish.Report, err = json.Marshal(report); err != nil {
+			log.Err(err).Msg("failed to encode integrity report")
 		}
 	}
 
+	// The jobs outlive the recording: a canceled recording is still
+	// post-processed.
+	f.runJobs(context.WithoutCancel(ctx), append(jobs, finish))
+
 	span.AddEvent("done")
-	log.Info().Msg("done")
 
 	return errWs
 }
+
+// writeJSON writes the value in a JSON file, under its .part name until
+// complete.
+func writeJSON(name string, v any) error {
+	if err := writePartJSON(name, v); err != nil {
+		return err
+	}
+	return utils.FinalizePart(utils.PartName(name), name)
+}
+
+// writePartJSON writes the value in the JSON file under its .part name.
+func writePartJSON(name string, v any) error {
+	f, err := os.OpenFile(utils.PartName(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// finalizeFile renames the file written under its .part name, if any.
+func finalizeFile(name string) error {
+	part := utils.PartName(name)
+	if _, err := os.Stat(part); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return utils.FinalizePart(part, name)
+}
+
+// archiveFiles moves the files out of the scratch directory and returns their
+// final paths.
+//
+// The files without final name, or which failed to be moved, are kept in the
+// scratch directory.
+func archiveFiles(ctx context.Context, files []string, finalNames map[string]string) []string {
+	log := log.Ctx(ctx)
+	archived := make([]string, 0, len(files))
+	for _, file := range files {
+		final, ok := finalNames[file]
+		if !ok || final == file {
+			archived = append(archived, file)
+			continue
+		}
+		log.Info().Str("file", file).Str("to", final).Msg("moving file out of the scratch directory")
+		if err := utils.MoveFile(file, final); err != nil {
+			log.Err(err).
+				Str("file", file).
+				Str("to", final).
+				Msg("failed to move file, keeping it in the scratch directory")
+			archived = append(archived, file)
+			continue
+		}
+		archived = append(archived, final)
+	}
+	return archived
+}
+
+// existingFiles returns the files which exist.
+func existingFiles(names ...string) []string {
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, err := os.Stat(name); err == nil {
+			files = append(files, name)
+		}
+	}
+	return files
+}
@@ -12,16 +12,24 @@ import (
 )
 
 // DownloadChat downloads chat messages to a file.
+//
+// If resume is true, the messages are appended to the file.
 func DownloadChat(
 	ctx context.Context,
 	commentChan <-chan *api.Comment,
 	fName string,
+	resume bool,
 ) error {
 	log := log.Ctx(ctx)
-	file, err := os.Create(fName)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(fName, flag, 0o644)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	filteredCommentChannel := removeDuplicatesComment(commentChan)
 
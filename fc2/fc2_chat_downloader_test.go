@@ -0,0 +1,56 @@
+package fc2_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadChat(t *testing.T) {
+	tests := []struct {
+		title    string
+		resume   bool
+		expected []string
+	}{
+		{
+			title:    "New chat",
+			expected: []string{"after"},
+		},
+		{
+			title:    "Resumed chat",
+			resume:   true,
+			expected: []string{"before", "after"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			fName := filepath.Join(t.TempDir(), "name.fc2chat.json")
+			require.NoError(t, os.WriteFile(fName, []byte(`{"comment":"before"}`+"\n"), 0o644))
+			commentChan := make(chan *api.Comment, 1)
+			commentChan <- &api.Comment{Comment: "after"}
+			close(commentChan)
+
+			// Act
+			err := fc2.DownloadChat(context.Background(), commentChan, fName, tt.resume)
+
+			// Assert
+			require.ErrorIs(t, err, io.EOF)
+			b, err := os.ReadFile(fName)
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			require.Len(t, lines, len(tt.expected))
+			for i, comment := range tt.expected {
+				require.Contains(t, lines[i], `"comment":"`+comment+`"`)
+			}
+		})
+	}
+}
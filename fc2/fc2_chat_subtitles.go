@@ -0,0 +1,137 @@
+package fc2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/subtitle"
+	"github.com/Darkness4/fc2-live-dl-go/hls"
+	"github.com/Darkness4/fc2-live-dl-go/video/concat"
+)
+
+// ChatSubtitles returns a loader of the chat of the recordings, to be muxed
+// as a subtitle track.
+//
+// The chat of "name.ts" is "name.fc2chat.json", searched in the directory of
+// the recording, then in dirs. The comments of the recording are aligned with
+// start, if not zero. The comments of the other recordings are aligned with
+// their start read from "name.report.json", or with the first comment if
+// there is no report.
+func ChatSubtitles(recording string, start time.Time, dirs ...string) concat.SubtitleLoader {
+	return func(input string, codec concat.SubtitleCodec) (*concat.Subtitles, error) {
+		chat := findSidecar(input, ".fc2chat.json", dirs)
+		if chat == "" {
+			return nil, nil
+		}
+		f, err := os.Open(chat)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		comments, err := subtitle.ReadComments(f)
+		if err != nil {
+			return nil, err
+		}
+
+		start, err := startOf(input, recording, start, sidecarOf(chat, ".fc2chat.json", ".report.json"))
+		if err != nil {
+			return nil, err
+		}
+		if start.IsZero() {
+			start = firstCommentTime(comments)
+		}
+
+		format := subtitle.FormatSRT
+		if codec == concat.SubtitleCodecASS {
+			format = subtitle.FormatASS
+		}
+		header, events, err := subtitle.Track(subtitle.Cues(comments, start), format)
+		if err != nil {
+			return nil, err
+		}
+		subs := &concat.Subtitles{
+			Header: header,
+			Events: make([]concat.SubtitleEvent, 0, len(events)),
+		}
+		for _, e := range events {
+			subs.Events = append(subs.Events, concat.SubtitleEvent{
+				Start:    e.Start,
+				End:      e.End,
+				Dialogue: fmt.Sprintf("0,%s,,0,0,0,,%s", e.Style, e.Text),
+			})
+		}
+		return subs, nil
+	}
+}
+
+// findSidecar returns the sidecar file of the recording with the suffix,
+// searched in the directory of the recording, then in dirs. Empty means not
+// found.
+func findSidecar(input string, suffix string, dirs []string) string {
+	base := baseName(input)
+	for _, dir := range append([]string{filepath.Dir(input)}, dirs...) {
+		name := filepath.Join(dir, base+suffix)
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// baseName returns the name of the file without directory and extension.
+func baseName(name string) string {
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+}
+
+// sidecarOf returns the sidecar file with the suffix next to the sidecar file
+// name with the suffix from.
+func sidecarOf(name string, from string, suffix string) string {
+	return strings.TrimSuffix(name, from) + suffix
+}
+
+// startOf returns the start of the video timeline of the input: start if the
+// input is the recording, whatever its directory and extension, otherwise the
+// start read from the report. Zero means unknown.
+func startOf(input string, recording string, start time.Time, report string) (time.Time, error) {
+	if !start.IsZero() && recording != "" && baseName(input) == baseName(recording) {
+		return start, nil
+	}
+	return RecordingStart(report)
+}
+
+// RecordingStart returns the start of the recording from its report. Zero
+// means there is no report.
+func RecordingStart(report string) (time.Time, error) {
+	b, err := os.ReadFile(report)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	var r hls.Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		return time.Time{}, fmt.Errorf("cannot decode %s: %w", report, err)
+	}
+	return r.StartTime, nil
+}
+
+// firstCommentTime returns the time of the first comment.
+func firstCommentTime(comments []api.Comment) time.Time {
+	var first time.Time
+	for _, c := range comments {
+		t, err := subtitle.CommentTime(c)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	return first
+}
@@ -0,0 +1,85 @@
+package fc2_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/video/concat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatSubtitles(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	dest := t.TempDir()
+	start := time.Unix(1700000000, 0).UTC()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name.ts"), []byte("data"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name.1.ts"), []byte("data"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name.2.ts"), []byte("data"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name.3.ts"), []byte("data"), 0o644))
+	// The chat of the first recording was moved to the destination.
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dest, "name.fc2chat.json"),
+		[]byte(`{"comment":"hello","timestamp":1700000010}`+"\n"),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dest, "name.report.json"),
+		[]byte(`{"startTime":"`+start.Format(time.RFC3339)+`"}`),
+		0o644,
+	))
+	// Without report, the first comment is the start.
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "name.1.fc2chat.json"),
+		[]byte(`{"comment":"second","timestamp":1700000105}`+"\n"+
+			`{"comment":"first","timestamp":1700000100}`+"\n"),
+		0o644,
+	))
+	// The recording was resumed: the chat of both runs is in the same file, and
+	// the report of an older version only covers the last run.
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "name.2.fc2chat.json"),
+		[]byte(`{"comment":"before","timestamp":1700000210}`+"\n"+
+			`{"comment":"after","timestamp":1700000310}`+"\n"),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "name.2.report.json"),
+		[]byte(`{"startTime":"`+time.Unix(1700000300, 0).UTC().Format(time.RFC3339)+`"}`),
+		0o644,
+	))
+	loader := fc2.ChatSubtitles(filepath.Join(dir, "name.2.ts"), time.Unix(1700000200, 0), dest)
+
+	// Act
+	first, err1 := loader(filepath.Join(dir, "name.ts"), concat.SubtitleCodecMovText)
+	second, err2 := loader(filepath.Join(dir, "name.1.ts"), concat.SubtitleCodecASS)
+	resumed, err3 := loader(filepath.Join(dir, "name.2.ts"), concat.SubtitleCodecASS)
+	none, err4 := loader(filepath.Join(dir, "name.3.ts"), concat.SubtitleCodecASS)
+
+	// Assert
+	require.NoError(t, err1)
+	require.NotNil(t, first)
+	require.Equal(t, []concat.SubtitleEvent{
+		{
+			Start:    10 * time.Second,
+			End:      14 * time.Second,
+			Dialogue: "0,Default,,0,0,0,,hello",
+		},
+	}, first.Events)
+	require.NoError(t, err2)
+	require.NotNil(t, second)
+	require.Contains(t, second.Header, "Style: Danmaku,")
+	require.Len(t, second.Events, 2)
+	require.Equal(t, time.Duration(0), second.Events[0].Start)
+	require.Equal(t, 5*time.Second, second.Events[1].Start)
+	require.NoError(t, err3)
+	require.NotNil(t, resumed)
+	require.Len(t, resumed.Events, 2)
+	require.Equal(t, 10*time.Second, resumed.Events[0].Start)
+	require.Equal(t, 110*time.Second, resumed.Events[1].Start)
+	require.NoError(t, err4)
+	require.Nil(t, none)
+}
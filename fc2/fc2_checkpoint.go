@@ -0,0 +1,143 @@
+package fc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/hls"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// StreamCheckpoint is persisted while downloading a live stream to resume it
+// after a restart.
+type StreamCheckpoint struct {
+	ChannelID string `json:"channelId"`
+	// StreamStart is the start time of the live stream, as returned by FC2.
+	StreamStart    string `json:"streamStart"`
+	OutputFileName string `json:"outputFileName"`
+	// FinalFileName is the name of the recording once moved out of the scratch
+	// directory. Empty if there is no scratch directory.
+	FinalFileName string `json:"finalFileName,omitempty"`
+	// ChatFileName is the chat of the recording, continued when the download
+	// is resumed. Empty if the chat is not written.
+	ChatFileName string `json:"chatFileName,omitempty"`
+	// FinalChatFileName is the name of the chat once moved out of the scratch
+	// directory. Empty if there is no scratch directory.
+	FinalChatFileName string `json:"finalChatFileName,omitempty"`
+	// RecordingStart is the start of the video timeline, used to align the
+	// chat of the resumed download.
+	RecordingStart time.Time      `json:"recordingStart,omitzero"`
+	Checkpoint     hls.Checkpoint `json:"checkpoint"`
+}
+
+// NewStreamCheckpoint creates a checkpoint at the beginning of the live stream.
+func NewStreamCheckpoint(meta api.GetMetaData, outputFileName string) StreamCheckpoint {
+	return StreamCheckpoint{
+		ChannelID:      meta.ChannelData.ChannelID,
+		StreamStart:    meta.ChannelData.Start.String(),
+		OutputFileName: outputFileName,
+		Checkpoint:     hls.DefaultCheckpoint(),
+	}
+}
+
+// CanResume returns true if the checkpoint belongs to the live stream and its
+// output file, still under its .part name, exists.
+func (c StreamCheckpoint) CanResume(meta api.GetMetaData) bool {
+	if c.StreamStart == "" || c.OutputFileName == "" ||
+		c.ChannelID != meta.ChannelData.ChannelID ||
+		c.StreamStart != meta.ChannelData.Start.String() {
+		return false
+	}
+	_, err := os.Stat(utils.PartName(c.OutputFileName))
+	return err == nil
+}
+
+func streamCheckpointPath(dir string, channelID string) string {
+	return filepath.Join(dir, utils.SanitizeFilename(channelID)+".checkpoint.json")
+}
+
+// LoadStreamCheckpoint loads the checkpoint of the channel from the directory.
+//
+// It returns os.ErrNotExist if there is no checkpoint.
+func LoadStreamCheckpoint(dir string, channelID string) (StreamCheckpoint, error) {
+	var c StreamCheckpoint
+	b, err := os.ReadFile(streamCheckpointPath(dir, channelID))
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// LoadStreamCheckpoints loads the checkpoints of all the channels from the
+// directory. The invalid checkpoints are skipped.
+func LoadStreamCheckpoints(dir string) ([]StreamCheckpoint, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.checkpoint.json"))
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make([]StreamCheckpoint, 0, len(paths))
+	for _, path := range paths {
+		var c StreamCheckpoint
+		b, err := os.ReadFile(path)
+		if err != nil {
+			log.Err(err).Str("path", path).Msg("failed to read checkpoint, skipping")
+			continue
+		}
+		if err := json.Unmarshal(b, &c); err != nil {
+			log.Err(err).Str("path", path).Msg("failed to decode checkpoint, skipping")
+			continue
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, nil
+}
+
+// Save writes the checkpoint in the directory.
+//
+// The file is replaced atomically so that a crash cannot leave a truncated
+// checkpoint.
+func (c StreamCheckpoint) Save(dir string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(streamCheckpointPath(dir, c.ChannelID), b)
+}
+
+// RemoveStreamCheckpoint removes the checkpoint of the channel from the
+// directory, if any.
+func RemoveStreamCheckpoint(dir string, channelID string) error {
+	err := os.Remove(streamCheckpointPath(dir, channelID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// loadResumableCheckpoint returns the checkpoint of the live stream if the
+// download can be resumed, or nil.
+func loadResumableCheckpoint(ctx context.Context, dir string, meta api.GetMetaData) *StreamCheckpoint {
+	log := log.Ctx(ctx)
+	c, err := LoadStreamCheckpoint(dir, meta.ChannelData.ChannelID)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		log.Err(err).Msg("failed to load checkpoint, ignoring")
+		return nil
+	}
+	if !c.CanResume(meta) {
+		log.Info().
+			Str("streamStart", c.StreamStart).
+			Str("output", c.OutputFileName).
+			Msg("checkpoint is from another stream, ignoring")
+		return nil
+	}
+	return &c
+}
@@ -0,0 +1,58 @@
+package fc2_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/hls"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "stream.ts")
+	require.NoError(t, os.WriteFile(utils.PartName(output), []byte("data"), 0o644))
+	meta := api.GetMetaData{
+		ChannelData: api.ChannelData{
+			ChannelID: "12345",
+			Start:     "1699894000",
+		},
+	}
+
+	_, err := fc2.LoadStreamCheckpoint(dir, "12345")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	c := fc2.NewStreamCheckpoint(meta, output)
+	c.ChatFileName = filepath.Join(dir, "stream.fc2chat.json")
+	c.Checkpoint = hls.Checkpoint{
+		LastFragmentName:    "118618.ts",
+		LastFragmentTime:    time.Unix(1699894113, 0),
+		UseTimeBasedSorting: true,
+	}
+	require.NoError(t, c.Save(dir))
+
+	loaded, err := fc2.LoadStreamCheckpoint(dir, "12345")
+	require.NoError(t, err)
+	require.Equal(t, c.OutputFileName, loaded.OutputFileName)
+	require.Equal(t, c.ChatFileName, loaded.ChatFileName)
+	require.Equal(t, c.Checkpoint.LastFragmentName, loaded.Checkpoint.LastFragmentName)
+	require.True(t, c.Checkpoint.LastFragmentTime.Equal(loaded.Checkpoint.LastFragmentTime))
+	require.True(t, loaded.CanResume(meta))
+
+	otherStream := meta
+	otherStream.ChannelData.Start = "1699899999"
+	require.False(t, loaded.CanResume(otherStream))
+
+	require.NoError(t, os.Rename(utils.PartName(output), output))
+	require.False(t, loaded.CanResume(meta), "output file is finalized")
+
+	require.NoError(t, fc2.RemoveStreamCheckpoint(dir, "12345"))
+	require.NoError(t, fc2.RemoveStreamCheckpoint(dir, "12345"))
+	_, err = fc2.LoadStreamCheckpoint(dir, "12345")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
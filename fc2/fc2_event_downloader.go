@@ -0,0 +1,47 @@
+package fc2
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/rs/zerolog/log"
+)
+
+// DownloadEvents writes the websocket events to a file, one JSON object per
+// line.
+func DownloadEvents(
+	ctx context.Context,
+	eventChan <-chan *api.WSEvent,
+	fName string,
+) error {
+	log := log.Ctx(ctx)
+	file, err := os.Create(fName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Each event is written in one call, so that a crash cannot truncate more
+	// than the last line.
+	enc := json.NewEncoder(file)
+	for {
+		select {
+		case data, ok := <-eventChan:
+			if !ok {
+				log.Error().Msg("writing events failed, channel was closed")
+				return io.EOF
+			}
+			if data == nil {
+				continue
+			}
+			if err := enc.Encode(data); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
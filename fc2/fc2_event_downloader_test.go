@@ -0,0 +1,54 @@
+package fc2_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadEvents(t *testing.T) {
+	// Arrange
+	fName := filepath.Join(t.TempDir(), "name.fc2events.json")
+	receivedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	eventChan := make(chan *api.WSEvent, 3)
+	eventChan <- &api.WSEvent{
+		ReceivedAt: receivedAt,
+		Name:       "user_count",
+		Arguments:  json.RawMessage(`{"count":42}`),
+	}
+	eventChan <- nil
+	eventChan <- &api.WSEvent{
+		ReceivedAt: receivedAt.Add(time.Second),
+		Name:       "unknown_event",
+	}
+	close(eventChan)
+
+	// Act
+	err := fc2.DownloadEvents(context.Background(), eventChan, fName)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	b, err := os.ReadFile(fName)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	require.JSONEq(
+		t,
+		`{"received_at":"2024-01-02T03:04:05Z","name":"user_count","arguments":{"count":42}}`,
+		lines[0],
+	)
+	require.JSONEq(
+		t,
+		`{"received_at":"2024-01-02T03:04:06Z","name":"unknown_event"}`,
+		lines[1],
+	)
+}
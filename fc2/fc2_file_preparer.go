@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
 	"github.com/rs/zerolog/log"
 )
 
@@ -16,6 +18,21 @@ func PrepareFileAutoRename(
 	meta api.GetMetaData,
 	labels map[string]string,
 	ext string,
+) (fName string, err error) {
+	return PrepareScratchFileAutoRename(outFormat, meta, labels, ext, "")
+}
+
+// PrepareScratchFileAutoRename prepares a file with a unique name, both at its
+// final location and in the scratch directory.
+//
+// The returned name is the final name. See ScratchPath for the name in the
+// scratch directory.
+func PrepareScratchFileAutoRename(
+	outFormat string,
+	meta api.GetMetaData,
+	labels map[string]string,
+	ext string,
+	scratchDirectory string,
 ) (fName string, err error) {
 	n := 0
 	// Find unique name
@@ -31,7 +48,9 @@ func PrepareFileAutoRename(
 			log.Error().Err(err).Msg("failed to format output")
 			return "", err
 		}
-		if _, err := os.Stat(fName); errors.Is(err, os.ErrNotExist) {
+		scratchName := ScratchPath(scratchDirectory, fName)
+		if !fileExists(fName) && !fileExists(utils.PartName(fName)) &&
+			!fileExists(scratchName) && !fileExists(utils.PartName(scratchName)) {
 			break
 		}
 		n++
@@ -63,3 +82,21 @@ func PrepareFile(
 	}
 	return fName, nil
 }
+
+// fileExists returns true if the file exists or cannot be checked.
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// ScratchPath returns the path of the file in the scratch directory.
+//
+// The directories of the output format are kept: "out/name.ts" becomes
+// "<scratchDirectory>/out/name.ts". If scratchDirectory is empty, the name is
+// returned as is.
+func ScratchPath(scratchDirectory string, name string) string {
+	if scratchDirectory == "" {
+		return name
+	}
+	return filepath.Join(scratchDirectory, strings.TrimPrefix(name, filepath.VolumeName(name)))
+}
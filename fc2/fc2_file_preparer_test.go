@@ -3,6 +3,7 @@ package fc2_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Darkness4/fc2-live-dl-go/fc2"
@@ -36,3 +37,30 @@ func TestPrepareFile(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, fmt.Sprintf("%s/test.1.mp4", dir), fName)
 }
+
+func TestPrepareScratchFile(t *testing.T) {
+	dir := t.TempDir()
+	scratchDir := t.TempDir()
+
+	format := fmt.Sprintf("%s/{{ .Title }}.{{ .Ext }}", dir)
+	fName, err := fc2.PrepareScratchFileAutoRename(format, api.GetMetaData{
+		ChannelData: api.ChannelData{
+			Title: "test",
+		},
+	}, fc2.DefaultParams.Labels, "ts", scratchDir)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%s/test.ts", dir), fName)
+
+	scratchName := fc2.ScratchPath(scratchDir, fName)
+	require.Equal(t, filepath.Join(scratchDir, dir, "test.ts"), scratchName)
+	require.NoError(t, os.MkdirAll(filepath.Dir(scratchName), 0o700))
+	require.NoError(t, os.WriteFile(scratchName, []byte("test"), 0o600))
+
+	fName, err = fc2.PrepareScratchFileAutoRename(format, api.GetMetaData{
+		ChannelData: api.ChannelData{
+			Title: "test",
+		},
+	}, fc2.DefaultParams.Labels, "ts", scratchDir)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%s/test.1.ts", dir), fName, "the file exists in the scratch directory")
+}
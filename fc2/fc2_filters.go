@@ -0,0 +1,104 @@
+package fc2
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+)
+
+// Filters decides whether a live stream must be recorded based on its
+// metadata.
+//
+// The zero value records every live stream.
+type Filters struct {
+	// TitleInclude records the stream only if the title matches one of the
+	// regular expressions.
+	TitleInclude []Regexp `yaml:"titleInclude,omitempty"`
+	// TitleExclude skips the stream if the title matches one of the regular
+	// expressions.
+	TitleExclude []Regexp `yaml:"titleExclude,omitempty"`
+	// Categories records the stream only if its category is in the list.
+	Categories []string `yaml:"categories,omitempty"`
+	// SkipTicketOnly skips the streams which requires a ticket.
+	SkipTicketOnly bool `yaml:"skipTicketOnly,omitempty"`
+	// SkipTwoshot skips the twoshot (private) streams.
+	SkipTwoshot bool `yaml:"skipTwoshot,omitempty"`
+}
+
+// IsZero returns true if no filter is set.
+func (f Filters) IsZero() bool {
+	return len(f.TitleInclude) == 0 &&
+		len(f.TitleExclude) == 0 &&
+		len(f.Categories) == 0 &&
+		!f.SkipTicketOnly &&
+		!f.SkipTwoshot
+}
+
+// Reject returns the rule rejecting the live stream, or an empty string if the
+// live stream must be recorded.
+func (f Filters) Reject(data api.ChannelData) string {
+	if f.SkipTicketOnly && isSet(data.TicketOnly) {
+		return "skipTicketOnly"
+	}
+	if f.SkipTwoshot && isSet(data.Twoshot) {
+		return "skipTwoshot"
+	}
+	if len(f.Categories) > 0 && !slices.ContainsFunc(f.Categories, func(c string) bool {
+		return strings.EqualFold(c, data.CategoryName)
+	}) {
+		return fmt.Sprintf("categories (category %q is not allowed)", data.CategoryName)
+	}
+	for _, re := range f.TitleExclude {
+		if re.MatchString(data.Title) {
+			return fmt.Sprintf("titleExclude %q", re.String())
+		}
+	}
+	if len(f.TitleInclude) > 0 && !slices.ContainsFunc(f.TitleInclude, func(re Regexp) bool {
+		return re.MatchString(data.Title)
+	}) {
+		return "titleInclude (no match)"
+	}
+	return ""
+}
+
+// Clone creates a deep copy of the Filters.
+func (f Filters) Clone() Filters {
+	return Filters{
+		TitleInclude:   slices.Clone(f.TitleInclude),
+		TitleExclude:   slices.Clone(f.TitleExclude),
+		Categories:     slices.Clone(f.Categories),
+		SkipTicketOnly: f.SkipTicketOnly,
+		SkipTwoshot:    f.SkipTwoshot,
+	}
+}
+
+func isSet(n json.Number) bool {
+	return n != "" && n != "0"
+}
+
+// Regexp is a regular expression which can be decoded from a string.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// MarshalText formats the regular expression.
+func (re Regexp) MarshalText() ([]byte, error) {
+	if re.Regexp == nil {
+		return nil, nil
+	}
+	return []byte(re.String()), nil
+}
+
+// UnmarshalText compiles the regular expression.
+func (re *Regexp) UnmarshalText(b []byte) error {
+	compiled, err := regexp.Compile(string(b))
+	if err != nil {
+		return fmt.Errorf("invalid regular expression %q: %w", string(b), err)
+	}
+	re.Regexp = compiled
+	return nil
+}
@@ -0,0 +1,94 @@
+package fc2_test
+
+import (
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFiltersReject(t *testing.T) {
+	var filters fc2.Filters
+	require.NoError(t, yaml.Unmarshal([]byte(`
+titleInclude: ['(?i)karaoke', '歌枠']
+titleExclude: ['(?i)rerun']
+categories: ['雑談', 'Music']
+skipTicketOnly: true
+skipTwoshot: true
+`), &filters))
+
+	tests := []struct {
+		title    string
+		data     api.ChannelData
+		expected string
+	}{
+		{
+			title: "Accepted",
+			data: api.ChannelData{
+				Title:        "Karaoke night",
+				CategoryName: "music",
+				TicketOnly:   "0",
+			},
+			expected: "",
+		},
+		{
+			title: "Ticket only",
+			data: api.ChannelData{
+				Title:        "Karaoke night",
+				CategoryName: "Music",
+				TicketOnly:   "1",
+			},
+			expected: "skipTicketOnly",
+		},
+		{
+			title: "Twoshot",
+			data: api.ChannelData{
+				Title:        "Karaoke night",
+				CategoryName: "Music",
+				Twoshot:      "1",
+			},
+			expected: "skipTwoshot",
+		},
+		{
+			title: "Category not allowed",
+			data: api.ChannelData{
+				Title:        "Karaoke night",
+				CategoryName: "Game",
+			},
+			expected: `categories (category "Game" is not allowed)`,
+		},
+		{
+			title: "Title excluded",
+			data: api.ChannelData{
+				Title:        "Karaoke night (RERUN)",
+				CategoryName: "Music",
+			},
+			expected: `titleExclude "(?i)rerun"`,
+		},
+		{
+			title: "Title not included",
+			data: api.ChannelData{
+				Title:        "Talk",
+				CategoryName: "雑談",
+			},
+			expected: "titleInclude (no match)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			require.Equal(t, tt.expected, filters.Reject(tt.data))
+		})
+	}
+}
+
+func TestFiltersEmpty(t *testing.T) {
+	filters := fc2.Filters{}
+	require.True(t, filters.IsZero())
+	require.Empty(t, filters.Reject(api.ChannelData{
+		Title:      "Anything",
+		TicketOnly: "1",
+	}))
+}
@@ -3,6 +3,7 @@ package fc2
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -30,7 +31,20 @@ type LiveStream struct {
 	WebsocketURL   string
 	OutputFileName string
 	ChatFileName   string
+	// EventsFileName is the file of the websocket events, written if
+	// Params.WriteEvents is true.
+	EventsFileName string
 	Params         Params
+
+	// Checkpoint resumes the download by appending to OutputFileName.
+	//
+	// If nil, OutputFileName is truncated and the download starts from the
+	// beginning of the playlist.
+	Checkpoint *hls.Checkpoint
+	// OnCheckpoint is called after each fragment written to OutputFileName.
+	OnCheckpoint func(hls.Checkpoint)
+	// Report records the integrity of the recording, if not nil.
+	Report *hls.Report
 }
 
 // DownloadLiveStream downloads the FC2 live stream.
@@ -48,6 +62,10 @@ func DownloadLiveStream(ctx context.Context, client *http.Client, ls LiveStream)
 	if ls.Params.WriteChat {
 		commentChan = make(chan *api.Comment, commentBufMax)
 	}
+	var eventChan chan *api.WSEvent
+	if ls.Params.WriteEvents {
+		eventChan = make(chan *api.WSEvent, eventBufMax)
+	}
 
 	ws := api.NewWebSocket(client, ls.WebsocketURL, 30*time.Second)
 	conn, err := ws.Dial(ctx)
@@ -86,7 +104,7 @@ func DownloadLiveStream(ctx context.Context, client *http.Client, ls LiveStream)
 	})
 
 	g.Go(func() error {
-		err := ws.Listen(ctx, conn, msgChan, commentChan)
+		err := ws.Listen(ctx, conn, msgChan, commentChan, eventChan)
 
 		if err == nil {
 			log.Panic().Msg(
@@ -98,6 +116,9 @@ func DownloadLiveStream(ctx context.Context, client *http.Client, ls LiveStream)
 		if commentChan != nil {
 			close(commentChan)
 		}
+		if eventChan != nil {
+			close(eventChan)
+		}
 		if errors.Is(err, io.EOF) || errors.Is(err, api.ErrWebSocketStreamEnded) {
 			log.Info().Msg("ws listen finished")
 			return io.EOF
@@ -197,7 +218,7 @@ func DownloadLiveStream(ctx context.Context, client *http.Client, ls LiveStream)
 
 	if ls.Params.WriteChat {
 		g.Go(func() error {
-			err := DownloadChat(ctx, commentChan, ls.ChatFileName)
+			err := DownloadChat(ctx, commentChan, ls.ChatFileName, ls.Checkpoint != nil)
 			if err == nil {
 				log.Panic().Msg(
 					"undefined behavior, chat downloader finished with nil, the chat downloader MUST finish with io.EOF",
@@ -216,6 +237,27 @@ func DownloadLiveStream(ctx context.Context, client *http.Client, ls LiveStream)
 		})
 	}
 
+	if ls.Params.WriteEvents {
+		g.Go(func() error {
+			err := DownloadEvents(ctx, eventChan, ls.EventsFileName)
+			if err == nil {
+				log.Panic().Msg(
+					"undefined behavior, events downloader finished with nil, the events downloader MUST finish with io.EOF",
+				)
+			}
+
+			if errors.Is(err, io.EOF) {
+				log.Info().Msg("download events finished")
+			} else if errors.Is(err, context.Canceled) {
+				log.Info().Msg("download events canceled")
+			} else {
+				log.Error().Err(err).Msg("download events failed")
+			}
+			appendErr(err)
+			return err
+		})
+	}
+
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
@@ -233,6 +275,12 @@ func DownloadLiveStream(ctx context.Context, client *http.Client, ls LiveStream)
 					utils.Flush(commentChan)
 				}
 			}
+			if ls.Params.WriteEvents {
+				if len(eventChan) == eventBufMax-1 {
+					log.Error().Msg("eventChan overflow, flushing...")
+					utils.Flush(eventChan)
+				}
+			}
 
 		// Stop at the first error
 		case <-ctx.Done():
@@ -265,11 +313,16 @@ func downloadStream(
 	))
 	defer span.End()
 
-	file, err := os.Create(ls.OutputFileName)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if ls.Checkpoint != nil {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(ls.OutputFileName, flag, 0o644)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer f.Close()
+	file := &syncWriter{File: f, interval: syncInterval, lastSync: time.Now()}
 
 	errChan := make(chan error, errBufMax)
 
@@ -283,6 +336,26 @@ func downloadStream(
 		checkpoint   = hls.DefaultCheckpoint()
 		checkpointMu sync.Mutex
 	)
+	if ls.Checkpoint != nil {
+		checkpoint = *ls.Checkpoint
+	}
+
+	downloaderOpts := []hls.Option{
+		hls.WithConcurrency(ls.Params.FragmentConcurrency),
+		hls.WithFragmentRetries(ls.Params.FragmentRetries),
+		hls.WithStallTimeout(ls.Params.StallTimeout),
+	}
+	if ls.OnCheckpoint != nil {
+		downloaderOpts = append(downloaderOpts, hls.WithCheckpointHandler(ls.OnCheckpoint))
+	}
+	if ls.Report != nil {
+		downloaderOpts = append(downloaderOpts, hls.WithReport(ls.Report))
+	}
+	if ls.Params.ValidateFragments {
+		downloaderOpts = append(downloaderOpts, hls.WithFragmentValidation())
+	}
+	// Playlist being downloaded, used to report the quality switches.
+	var currentPlaylist api.Playlist
 
 playlistLoop:
 	for {
@@ -319,6 +392,7 @@ playlistLoop:
 				log,
 				ls.Params.PacketLossMax,
 				playlist.URL,
+				downloaderOpts...,
 			)
 
 			// Is there a downloader running?
@@ -356,7 +430,11 @@ playlistLoop:
 					log.Fatal().Msg("couldn't cancel downloader because of a deadlock")
 				}
 				log.Info().Msg("old downloader cancelled, switching downloader seamlessly...")
+				if ls.Report != nil {
+					ls.Report.AddQualitySwitch(playlistName(currentPlaylist), playlistName(playlist))
+				}
 			}
+			currentPlaylist = playlist
 
 			currentCtx, currentCancel = context.WithCancel(ctx)
 			doneChan = make(chan struct{}, 1)
@@ -431,6 +509,15 @@ playlistLoop:
 	return io.EOF
 }
 
+// playlistName returns a human-readable name of the playlist.
+func playlistName(playlist api.Playlist) string {
+	return fmt.Sprintf(
+		"%s (%s)",
+		api.QualityFromMode(playlist.Mode),
+		api.LatencyFromMode(playlist.Mode),
+	)
+}
+
 func fetchPlaylist(
 	ctx context.Context,
 	ls LiveStream,
@@ -503,3 +590,29 @@ func playlistsSummary(pp []api.Playlist) []struct {
 	}
 	return summary
 }
+
+// syncWriter flushes the file to the disk periodically, so that a crash loses
+// at most the last interval of the recording.
+type syncWriter struct {
+	*os.File
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastSync time.Time
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	n, err := w.File.Write(p)
+	if err != nil {
+		return n, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.lastSync) >= w.interval {
+		w.lastSync = time.Now()
+		if err := w.Sync(); err != nil {
+			log.Err(err).Str("file", w.Name()).Msg("failed to sync the recording")
+		}
+	}
+	return n, nil
+}
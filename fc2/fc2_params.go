@@ -13,14 +13,26 @@ type Params struct {
 	Quality                    api.Quality       `yaml:"quality,omitempty"`
 	Latency                    api.Latency       `yaml:"latency,omitempty"`
 	PacketLossMax              int               `yaml:"packetLossMax,omitempty"`
+	FragmentConcurrency        int               `yaml:"fragmentConcurrency,omitempty"`
+	FragmentRetries            int               `yaml:"fragmentRetries,omitempty"`
+	ValidateFragments          bool              `yaml:"validateFragments,omitempty"`
+	StallTimeout               time.Duration     `yaml:"stallTimeout,omitempty"`
 	OutFormat                  string            `yaml:"outFormat,omitempty"`
+	ScratchDirectory           string            `yaml:"scratchDirectory,omitempty"`
 	WriteChat                  bool              `yaml:"writeChat,omitempty"`
+	ConvertChat                string            `yaml:"convertChat,omitempty"`
+	EmbedChat                  bool              `yaml:"embedChat,omitempty"`
+	WriteChapters              bool              `yaml:"writeChapters,omitempty"`
+	WriteEvents                bool              `yaml:"writeEvents,omitempty"`
+	WriteTimeline              bool              `yaml:"writeTimeline,omitempty"`
 	WriteInfoJSON              bool              `yaml:"writeInfoJson,omitempty"`
 	WriteThumbnail             bool              `yaml:"writeThumbnail,omitempty"`
+	WriteReport                bool              `yaml:"writeReport,omitempty"`
 	WaitForLive                bool              `yaml:"waitForLive,omitempty"`
 	WaitForQualityMaxTries     int               `yaml:"waitForQualityMaxTries,omitempty"`
 	AllowQualityUpgrade        bool              `yaml:"allowQualityUpgrade,omitempty"`
 	PollQualityUpgradeInterval time.Duration     `yaml:"pollQualityUpgradeInterval,omitempty"`
+	PollMetadataInterval       time.Duration     `yaml:"pollMetadataInterval,omitempty"`
 	WaitPollInterval           time.Duration     `yaml:"waitPollInterval,omitempty"`
 	CookiesFile                string            `yaml:"cookiesFile,omitempty"`
 	CookiesRefreshDuration     time.Duration     `yaml:"cookiesRefreshDuration,omitempty"`
@@ -32,6 +44,10 @@ type Params struct {
 	EligibleForCleaningAge     time.Duration     `yaml:"eligibleForCleaningAge,omitempty"`
 	DeleteCorrupted            bool              `yaml:"deleteCorrupted,omitempty"`
 	ExtractAudio               bool              `yaml:"extractAudio,omitempty"`
+	CheckpointDirectory        string            `yaml:"checkpointDirectory,omitempty"`
+	Priority                   int               `yaml:"priority,omitempty"`
+	Schedule                   Schedule          `yaml:"schedule,omitempty"`
+	Filters                    Filters           `yaml:"filters,omitempty"`
 	Labels                     map[string]string `yaml:"labels,omitempty"`
 }
 
@@ -45,14 +61,26 @@ type OptionalParams struct {
 	Quality                    *api.Quality      `yaml:"quality,omitempty"`
 	Latency                    *api.Latency      `yaml:"latency,omitempty"`
 	PacketLossMax              *int              `yaml:"packetLossMax,omitempty"`
+	FragmentConcurrency        *int              `yaml:"fragmentConcurrency,omitempty"`
+	FragmentRetries            *int              `yaml:"fragmentRetries,omitempty"`
+	ValidateFragments          *bool             `yaml:"validateFragments,omitempty"`
+	StallTimeout               *time.Duration    `yaml:"stallTimeout,omitempty"`
 	OutFormat                  *string           `yaml:"outFormat,omitempty"`
+	ScratchDirectory           *string           `yaml:"scratchDirectory,omitempty"`
 	WriteChat                  *bool             `yaml:"writeChat,omitempty"`
+	ConvertChat                *string           `yaml:"convertChat,omitempty"`
+	EmbedChat                  *bool             `yaml:"embedChat,omitempty"`
+	WriteChapters              *bool             `yaml:"writeChapters,omitempty"`
+	WriteEvents                *bool             `yaml:"writeEvents,omitempty"`
+	WriteTimeline              *bool             `yaml:"writeTimeline,omitempty"`
 	WriteInfoJSON              *bool             `yaml:"writeInfoJson,omitempty"`
 	WriteThumbnail             *bool             `yaml:"writeThumbnail,omitempty"`
+	WriteReport                *bool             `yaml:"writeReport,omitempty"`
 	WaitForLive                *bool             `yaml:"waitForLive,omitempty"`
 	WaitForQualityMaxTries     *int              `yaml:"waitForQualityMaxTries,omitempty"`
 	AllowQualityUpgrade        *bool             `yaml:"allowQualityUpgrade,omitempty"`
 	PollQualityUpgradeInterval *time.Duration    `yaml:"pollQualityUpgradeInterval,omitempty"`
+	PollMetadataInterval       *time.Duration    `yaml:"pollMetadataInterval,omitempty"`
 	WaitPollInterval           *time.Duration    `yaml:"waitPollInterval,omitempty"`
 	CookiesFile                *string           `yaml:"cookiesFile,omitempty"`
 	CookiesRefreshDuration     *time.Duration    `yaml:"cookiesRefreshDuration,omitempty"`
@@ -64,6 +92,10 @@ type OptionalParams struct {
 	EligibleForCleaningAge     *time.Duration    `yaml:"eligibleForCleaningAge,omitempty"`
 	DeleteCorrupted            *bool             `yaml:"deleteCorrupted,omitempty"`
 	ExtractAudio               *bool             `yaml:"extractAudio,omitempty"`
+	CheckpointDirectory        *string           `yaml:"checkpointDirectory,omitempty"`
+	Priority                   *int              `yaml:"priority,omitempty"`
+	Schedule                   *Schedule         `yaml:"schedule,omitempty"`
+	Filters                    *Filters          `yaml:"filters,omitempty"`
 	Labels                     map[string]string `yaml:"labels,omitempty"`
 }
 
@@ -72,14 +104,26 @@ var DefaultParams = Params{
 	Quality:                    api.Quality3MBps,
 	Latency:                    api.LatencyMid,
 	PacketLossMax:              20,
+	FragmentConcurrency:        1,
+	FragmentRetries:            2,
+	ValidateFragments:          true,
+	StallTimeout:               30 * time.Second,
 	OutFormat:                  "{{ .Date }} {{ .Title }} ({{ .ChannelName }}).{{ .Ext }}",
+	ScratchDirectory:           "",
 	WriteChat:                  false,
+	ConvertChat:                "",
+	EmbedChat:                  false,
+	WriteChapters:              true,
+	WriteEvents:                false,
+	WriteTimeline:              false,
 	WriteInfoJSON:              false,
 	WriteThumbnail:             false,
+	WriteReport:                true,
 	WaitForLive:                true,
 	WaitForQualityMaxTries:     60,
 	AllowQualityUpgrade:        false,
 	PollQualityUpgradeInterval: 10 * time.Second,
+	PollMetadataInterval:       time.Minute,
 	WaitPollInterval:           5 * time.Second,
 	CookiesFile:                "",
 	CookiesRefreshDuration:     24 * time.Hour,
@@ -91,6 +135,10 @@ var DefaultParams = Params{
 	EligibleForCleaningAge:     48 * time.Hour,
 	DeleteCorrupted:            true,
 	ExtractAudio:               false,
+	CheckpointDirectory:        "",
+	Priority:                   0,
+	Schedule:                   Schedule{},
+	Filters:                    Filters{},
 	Labels:                     nil,
 }
 
@@ -105,18 +153,51 @@ func (override *OptionalParams) Override(params *Params) {
 	if override.PacketLossMax != nil {
 		params.PacketLossMax = *override.PacketLossMax
 	}
+	if override.FragmentConcurrency != nil {
+		params.FragmentConcurrency = *override.FragmentConcurrency
+	}
+	if override.FragmentRetries != nil {
+		params.FragmentRetries = *override.FragmentRetries
+	}
+	if override.ValidateFragments != nil {
+		params.ValidateFragments = *override.ValidateFragments
+	}
+	if override.StallTimeout != nil {
+		params.StallTimeout = *override.StallTimeout
+	}
 	if override.OutFormat != nil {
 		params.OutFormat = *override.OutFormat
 	}
+	if override.ScratchDirectory != nil {
+		params.ScratchDirectory = *override.ScratchDirectory
+	}
 	if override.WriteChat != nil {
 		params.WriteChat = *override.WriteChat
 	}
+	if override.ConvertChat != nil {
+		params.ConvertChat = *override.ConvertChat
+	}
+	if override.EmbedChat != nil {
+		params.EmbedChat = *override.EmbedChat
+	}
+	if override.WriteChapters != nil {
+		params.WriteChapters = *override.WriteChapters
+	}
+	if override.WriteEvents != nil {
+		params.WriteEvents = *override.WriteEvents
+	}
+	if override.WriteTimeline != nil {
+		params.WriteTimeline = *override.WriteTimeline
+	}
 	if override.WriteInfoJSON != nil {
 		params.WriteInfoJSON = *override.WriteInfoJSON
 	}
 	if override.WriteThumbnail != nil {
 		params.WriteThumbnail = *override.WriteThumbnail
 	}
+	if override.WriteReport != nil {
+		params.WriteReport = *override.WriteReport
+	}
 	if override.WaitForLive != nil {
 		params.WaitForLive = *override.WaitForLive
 	}
@@ -135,6 +216,9 @@ func (override *OptionalParams) Override(params *Params) {
 	if override.PollQualityUpgradeInterval != nil {
 		params.PollQualityUpgradeInterval = *override.PollQualityUpgradeInterval
 	}
+	if override.PollMetadataInterval != nil {
+		params.PollMetadataInterval = *override.PollMetadataInterval
+	}
 	if override.WaitPollInterval != nil {
 		params.WaitPollInterval = *override.WaitPollInterval
 	}
@@ -162,6 +246,18 @@ func (override *OptionalParams) Override(params *Params) {
 	if override.ExtractAudio != nil {
 		params.ExtractAudio = *override.ExtractAudio
 	}
+	if override.CheckpointDirectory != nil {
+		params.CheckpointDirectory = *override.CheckpointDirectory
+	}
+	if override.Priority != nil {
+		params.Priority = *override.Priority
+	}
+	if override.Schedule != nil {
+		params.Schedule = override.Schedule.Clone()
+	}
+	if override.Filters != nil {
+		params.Filters = override.Filters.Clone()
+	}
 	if override.Labels != nil {
 		if params.Labels == nil {
 			params.Labels = make(map[string]string)
@@ -177,14 +273,26 @@ func (p Params) Clone() Params {
 		Quality:                    p.Quality,
 		Latency:                    p.Latency,
 		PacketLossMax:              p.PacketLossMax,
+		FragmentConcurrency:        p.FragmentConcurrency,
+		FragmentRetries:            p.FragmentRetries,
+		ValidateFragments:          p.ValidateFragments,
+		StallTimeout:               p.StallTimeout,
 		OutFormat:                  p.OutFormat,
+		ScratchDirectory:           p.ScratchDirectory,
 		WriteChat:                  p.WriteChat,
+		ConvertChat:                p.ConvertChat,
+		EmbedChat:                  p.EmbedChat,
+		WriteChapters:              p.WriteChapters,
+		WriteEvents:                p.WriteEvents,
+		WriteTimeline:              p.WriteTimeline,
 		WriteInfoJSON:              p.WriteInfoJSON,
 		WriteThumbnail:             p.WriteThumbnail,
+		WriteReport:                p.WriteReport,
 		WaitForLive:                p.WaitForLive,
 		WaitForQualityMaxTries:     p.WaitForQualityMaxTries,
 		AllowQualityUpgrade:        p.AllowQualityUpgrade,
 		PollQualityUpgradeInterval: p.PollQualityUpgradeInterval,
+		PollMetadataInterval:       p.PollMetadataInterval,
 		WaitPollInterval:           p.WaitPollInterval,
 		CookiesFile:                p.CookiesFile,
 		CookiesRefreshDuration:     p.CookiesRefreshDuration,
@@ -196,6 +304,10 @@ func (p Params) Clone() Params {
 		EligibleForCleaningAge:     p.EligibleForCleaningAge,
 		DeleteCorrupted:            p.DeleteCorrupted,
 		ExtractAudio:               p.ExtractAudio,
+		CheckpointDirectory:        p.CheckpointDirectory,
+		Priority:                   p.Priority,
+		Schedule:                   p.Schedule.Clone(),
+		Filters:                    p.Filters.Clone(),
 	}
 
 	// Clone the labels map if it exists
@@ -0,0 +1,177 @@
+package fc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/postprocess"
+	"github.com/Darkness4/fc2-live-dl-go/hls"
+	"github.com/Darkness4/fc2-live-dl-go/notify/notifier"
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/Darkness4/fc2-live-dl-go/telemetry/metrics"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/Darkness4/fc2-live-dl-go/video/concat"
+	"github.com/Darkness4/fc2-live-dl-go/video/remux"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RunJob runs a post-processing job, then moves the output to its destination,
+// if any.
+func RunJob(ctx context.Context, job state.Job) error {
+	if job.Kind == state.JobKindFinish {
+		finishRecording(ctx, job)
+		return nil
+	}
+	attrs := metric.WithAttributes(attribute.String("channel_id", job.ChannelID))
+	defer metrics.TimeStartRecording(ctx, metrics.PostProcessing.CompletionTime, time.Second, attrs)()
+
+	// The chat and timeline files may have been moved to the destination
+	// already.
+	sidecarDirs := []string{filepath.Dir(job.Input)}
+	if job.Destination != "" {
+		sidecarDirs = append(sidecarDirs, filepath.Dir(job.Destination))
+	}
+
+	var err error
+	switch job.Kind {
+	case state.JobKindRemux:
+		var opts []remux.Option
+		if job.EmbedChat {
+			opts = append(opts, remux.WithSubtitles(ChatSubtitles(job.Recording, job.RecordingStart, sidecarDirs...)))
+		}
+		if job.Chapters {
+			opts = append(opts, remux.WithChapters(TimelineChapters(job.Recording, job.RecordingStart, sidecarDirs...)))
+		}
+		err = remux.Do(ctx, job.Output, job.Input, opts...)
+	case state.JobKindExtractAudio:
+		err = remux.Do(ctx, job.Output, job.Input, remux.WithAudioOnly())
+	case state.JobKindConcat:
+		opts := []concat.Option{
+			concat.IgnoreExtension(),
+		}
+		// The previous recordings may have been moved to the destination
+		// already.
+		if job.Destination != "" {
+			opts = append(opts, concat.WithDirectories(filepath.Dir(job.Destination)))
+		}
+		if job.AudioOnly {
+			opts = append(opts, concat.WithAudioOnly())
+		} else {
+			if job.EmbedChat {
+				opts = append(opts, concat.WithSubtitles(ChatSubtitles(job.Recording, job.RecordingStart, sidecarDirs...)))
+			}
+			if job.Chapters {
+				opts = append(opts, concat.WithChapters(TimelineChapters(job.Recording, job.RecordingStart, sidecarDirs...)))
+			}
+		}
+		err = concat.WithPrefix(ctx, job.Format, job.Input, opts...)
+	default:
+		return fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	if err != nil {
+		metrics.PostProcessing.Errors.Add(ctx, 1, attrs)
+		return err
+	}
+
+	if job.Destination == "" || job.Destination == job.Output {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(job.Destination), 0o755); err != nil {
+		return err
+	}
+	return utils.MoveFile(job.Output, job.Destination)
+}
+
+// finishRecording deletes the intermediates of the recording, moves its files
+// out of the scratch directory, then notifies that the recording is finished.
+//
+// The job can be run again: the files which were already deleted or moved are
+// skipped.
+func finishRecording(ctx context.Context, job state.Job) {
+	log := log.With().Str("channelID", job.ChannelID).Logger()
+	ctx = log.WithContext(ctx)
+	for _, file := range job.Intermediates {
+		log.Info().Str("file", file).Msg("delete intermediate files")
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Msg("couldn't delete intermediate file")
+			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("channel_id", job.ChannelID),
+			))
+		}
+	}
+
+	// The files moved by a previous run are listed by their final name.
+	names := make([]string, 0, len(job.Files))
+	for _, file := range job.Files {
+		if final, ok := job.FinalNames[file]; ok {
+			if _, err := os.Stat(file); err != nil {
+				file = final
+			}
+		}
+		if !slices.Contains(names, file) {
+			names = append(names, file)
+		}
+	}
+	files := archiveFiles(ctx, existingFiles(names...), job.FinalNames)
+	if job.RecordingID != "" {
+		state.DefaultState.SetRecordingFiles(job.RecordingID, files)
+	}
+	log.Info().Strs("files", files).Msg("done")
+
+	if len(job.Metadata) == 0 {
+		return
+	}
+	var meta api.GetMetaData
+	if err := json.Unmarshal(job.Metadata, &meta); err != nil {
+		log.Err(err).Msg("failed to decode metadata")
+		return
+	}
+	var report *hls.Report
+	if len(job.Report) > 0 {
+		report = &hls.Report{}
+		if err := json.Unmarshal(job.Report, report); err != nil {
+			log.Err(err).Msg("failed to decode integrity report")
+			report = nil
+		}
+	}
+	if err := notifier.NotifyFinished(ctx, job.ChannelID, job.Labels, meta, report); err != nil {
+		log.Err(err).Msg("notify failed")
+	}
+}
+
+// runJobs runs the chain of post-processing jobs in the queue, if any, without
+// waiting for them. Otherwise, the jobs run immediately, one after the other.
+func (f *FC2) runJobs(ctx context.Context, jobs []state.Job) {
+	if len(jobs) == 0 {
+		return
+	}
+	job := jobs[0]
+	job.Then = jobs[1:]
+	if f.opts.postProcessor != nil {
+		f.opts.postProcessor.Submit(job)
+		return
+	}
+	for {
+		err := RunJob(ctx, job)
+		if err != nil {
+			log.Ctx(ctx).Err(err).
+				Str("kind", string(job.Kind)).
+				Str("output", job.Output).
+				Msg("post-processing job failed")
+		}
+		next, ok := postprocess.Next(job, err)
+		if !ok {
+			return
+		}
+		job = next
+	}
+}
@@ -0,0 +1,57 @@
+package fc2_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunJobFinish(t *testing.T) {
+	// Arrange
+	scratch := t.TempDir()
+	dest := t.TempDir()
+	stream := filepath.Join(scratch, "name.ts")
+	chat := filepath.Join(scratch, "name.fc2chat.json")
+	muxed := filepath.Join(dest, "name.mp4")
+	for _, file := range []string{stream, chat, muxed} {
+		require.NoError(t, os.WriteFile(file, []byte("data"), 0o644))
+	}
+	recordingID := state.DefaultState.StartRecording("test", "title", nil)
+	job := state.Job{
+		ChannelID:     "test",
+		Kind:          state.JobKindFinish,
+		RecordingID:   recordingID,
+		Intermediates: []string{stream},
+		Files: []string{
+			stream,
+			chat,
+			filepath.Join(scratch, "name.mp4"),
+			muxed,
+		},
+		FinalNames: map[string]string{
+			chat:                               filepath.Join(dest, "name.fc2chat.json"),
+			filepath.Join(scratch, "name.mp4"): muxed,
+		},
+	}
+
+	// Act
+	err := fc2.RunJob(context.Background(), job)
+	// Run again, as when the job is interrupted.
+	errAgain := fc2.RunJob(context.Background(), job)
+
+	// Assert
+	require.NoError(t, err)
+	require.NoError(t, errAgain)
+	require.NoFileExists(t, stream)
+	require.NoFileExists(t, chat)
+	require.FileExists(t, filepath.Join(dest, "name.fc2chat.json"))
+	history := state.DefaultState.History(state.HistoryQuery{ChannelID: "test", Limit: 1})
+	require.Len(t, history, 1)
+	require.Equal(t, recordingID, history[0].ID)
+	require.Equal(t, []string{filepath.Join(dest, "name.fc2chat.json"), muxed}, history[0].Files)
+}
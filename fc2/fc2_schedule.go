@@ -0,0 +1,170 @@
+package fc2
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	// Embed the timezone database for minimal images.
+	_ "time/tzdata"
+)
+
+// Schedule restricts the recordings to a set of time windows.
+//
+// An empty schedule allows recording at any time.
+type Schedule struct {
+	Timezone Timezone         `yaml:"timezone,omitempty"`
+	Windows  []ScheduleWindow `yaml:"windows,omitempty"`
+}
+
+// ScheduleWindow is a time range repeated on some weekdays.
+//
+// If End is before Start, the window ends on the next day. If End equals Start,
+// the window lasts the whole day. An empty list of days means every day.
+type ScheduleWindow struct {
+	Days  []Weekday `yaml:"days,omitempty"`
+	Start TimeOfDay `yaml:"start"`
+	End   TimeOfDay `yaml:"end"`
+}
+
+// IsZero returns true if the schedule has no window.
+func (s Schedule) IsZero() bool {
+	return len(s.Windows) == 0
+}
+
+// Contains returns true if t is inside one of the windows of the schedule.
+func (s Schedule) Contains(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	t = t.In(s.Timezone.Location())
+	for _, w := range s.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone creates a deep copy of the Schedule.
+func (s Schedule) Clone() Schedule {
+	clone := Schedule{
+		Timezone: s.Timezone,
+	}
+	if s.Windows != nil {
+		clone.Windows = make([]ScheduleWindow, 0, len(s.Windows))
+		for _, w := range s.Windows {
+			clone.Windows = append(clone.Windows, ScheduleWindow{
+				Days:  slices.Clone(w.Days),
+				Start: w.Start,
+				End:   w.End,
+			})
+		}
+	}
+	return clone
+}
+
+func (w ScheduleWindow) hasDay(d time.Weekday) bool {
+	return len(w.Days) == 0 || slices.Contains(w.Days, Weekday(d))
+}
+
+func (w ScheduleWindow) contains(t time.Time) bool {
+	now := TimeOfDay(t.Hour()*60 + t.Minute())
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	switch {
+	case w.Start == w.End:
+		return w.hasDay(today)
+	case w.Start < w.End:
+		return w.hasDay(today) && w.Start <= now && now < w.End
+	default:
+		// The window crosses midnight.
+		return (w.hasDay(today) && now >= w.Start) || (w.hasDay(yesterday) && now < w.End)
+	}
+}
+
+// TimeOfDay is a number of minutes since midnight, formatted as HH:MM.
+type TimeOfDay int
+
+// MarshalText formats the time of day as HH:MM.
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "%02d:%02d", int(t)/60, int(t)%60), nil
+}
+
+// UnmarshalText parses a time of day formatted as HH:MM.
+func (t *TimeOfDay) UnmarshalText(b []byte) error {
+	var hour, minute int
+	if _, err := fmt.Sscanf(string(b), "%d:%d", &hour, &minute); err != nil {
+		return fmt.Errorf("invalid time of day %q, expected HH:MM: %w", string(b), err)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return fmt.Errorf("invalid time of day %q, expected HH:MM", string(b))
+	}
+	*t = TimeOfDay((hour*60 + minute) % (24 * 60))
+	return nil
+}
+
+// Weekday is a day of the week, formatted as its English name or abbreviation.
+type Weekday time.Weekday
+
+// MarshalText formats the weekday as its three-letter abbreviation.
+func (d Weekday) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(time.Weekday(d).String()[:3])), nil
+}
+
+// UnmarshalText parses a weekday, like "monday" or "mon".
+func (d *Weekday) UnmarshalText(b []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(b)))
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s == name || s == name[:3] {
+			*d = Weekday(wd)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid weekday %q", string(b))
+}
+
+// Timezone is a IANA timezone, like "Asia/Tokyo".
+//
+// The zero value is the local timezone.
+type Timezone struct {
+	loc *time.Location
+}
+
+// Location returns the location of the timezone.
+func (tz Timezone) Location() *time.Location {
+	if tz.loc == nil {
+		return time.Local
+	}
+	return tz.loc
+}
+
+// IsZero returns true if the timezone is the local timezone.
+func (tz Timezone) IsZero() bool {
+	return tz.loc == nil
+}
+
+// MarshalText formats the timezone as its name.
+func (tz Timezone) MarshalText() ([]byte, error) {
+	if tz.loc == nil {
+		return nil, nil
+	}
+	return []byte(tz.loc.String()), nil
+}
+
+// UnmarshalText parses a IANA timezone.
+func (tz *Timezone) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		tz.loc = nil
+		return nil
+	}
+	loc, err := time.LoadLocation(string(b))
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", string(b), err)
+	}
+	tz.loc = loc
+	return nil
+}
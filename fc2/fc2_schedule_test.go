@@ -0,0 +1,96 @@
+package fc2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestScheduleContains(t *testing.T) {
+	var schedule fc2.Schedule
+	require.NoError(t, yaml.Unmarshal([]byte(`
+timezone: Asia/Tokyo
+windows:
+  - days: [fri, saturday]
+    start: '22:00'
+    end: '02:00'
+  - days: [sun]
+    start: '12:00'
+    end: '13:30'
+`), &schedule))
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	tests := []struct {
+		title    string
+		t        time.Time
+		expected bool
+	}{
+		{
+			title:    "Friday night",
+			t:        time.Date(2024, time.January, 5, 23, 0, 0, 0, tokyo),
+			expected: true,
+		},
+		{
+			title:    "Saturday early morning, window started on Friday",
+			t:        time.Date(2024, time.January, 6, 1, 59, 0, 0, tokyo),
+			expected: true,
+		},
+		{
+			title:    "Saturday end of window",
+			t:        time.Date(2024, time.January, 6, 2, 0, 0, 0, tokyo),
+			expected: false,
+		},
+		{
+			title:    "Friday early morning, Thursday is not scheduled",
+			t:        time.Date(2024, time.January, 5, 1, 0, 0, 0, tokyo),
+			expected: false,
+		},
+		{
+			title:    "Sunday noon",
+			t:        time.Date(2024, time.January, 7, 13, 0, 0, 0, tokyo),
+			expected: true,
+		},
+		{
+			title:    "Sunday noon in UTC is converted to the schedule timezone",
+			t:        time.Date(2024, time.January, 7, 13, 0, 0, 0, time.UTC),
+			expected: false,
+		},
+		{
+			title:    "Monday night",
+			t:        time.Date(2024, time.January, 8, 23, 0, 0, 0, tokyo),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			require.Equal(t, tt.expected, schedule.Contains(tt.t))
+		})
+	}
+}
+
+func TestScheduleEmpty(t *testing.T) {
+	require.True(t, fc2.Schedule{}.Contains(time.Now()))
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	var schedule fc2.Schedule
+	require.Error(t, yaml.Unmarshal([]byte(`
+windows:
+  - days: [someday]
+    start: '22:00'
+    end: '02:00'
+`), &schedule))
+	require.Error(t, yaml.Unmarshal([]byte(`
+windows:
+  - start: '25:00'
+    end: '02:00'
+`), &schedule))
+	require.Error(t, yaml.Unmarshal([]byte(`
+timezone: Nowhere/Town
+`), &schedule))
+}
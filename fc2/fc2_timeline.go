@@ -0,0 +1,182 @@
+package fc2
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/notify/notifier"
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/Darkness4/fc2-live-dl-go/video/concat"
+	"github.com/rs/zerolog/log"
+)
+
+// TimelineEntry is a snapshot of the metadata of a live stream.
+type TimelineEntry struct {
+	Time     time.Time `json:"time"`
+	Title    string    `json:"title"`
+	Category string    `json:"category,omitempty"`
+	Viewers  int64     `json:"viewers"`
+}
+
+// NewTimelineEntry creates a snapshot of the metadata at the time t.
+func NewTimelineEntry(t time.Time, meta api.GetMetaData) TimelineEntry {
+	viewers, _ := meta.ChannelData.Count.Int64()
+	return TimelineEntry{
+		Time:     t,
+		Title:    meta.ChannelData.Title,
+		Category: meta.ChannelData.CategoryName,
+		Viewers:  viewers,
+	}
+}
+
+// SameAs returns true if both snapshots hold the same metadata.
+func (e TimelineEntry) SameAs(o TimelineEntry) bool {
+	return e.Title == o.Title && e.Category == o.Category && e.Viewers == o.Viewers
+}
+
+// ReadTimeline reads a timeline file, one entry per line.
+//
+// A truncated last line is ignored.
+func ReadTimeline(name string) ([]TimelineEntry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []TimelineEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e TimelineEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// TimelineChapters returns a loader of the title changes of the recordings,
+// to be written as chapters.
+//
+// The timeline of "name.ts" is "name.timeline.json", searched in the
+// directory of the recording, then in dirs. The changes of the recording are
+// aligned with start, if not zero. The changes of the other recordings are
+// aligned with their start read from "name.report.json", or with the first
+// entry if there is no report. The first entry of the timeline is the title at
+// the start of the recording.
+func TimelineChapters(recording string, start time.Time, dirs ...string) concat.ChapterLoader {
+	return func(input string) ([]concat.Chapter, error) {
+		timeline := findSidecar(input, ".timeline.json", dirs)
+		if timeline == "" {
+			return nil, nil
+		}
+		entries, err := ReadTimeline(timeline)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, nil
+		}
+
+		start, err := startOf(input, recording, start, sidecarOf(timeline, ".timeline.json", ".report.json"))
+		if err != nil {
+			return nil, err
+		}
+		if start.IsZero() {
+			start = entries[0].Time
+		}
+
+		chapters := make([]concat.Chapter, 0, len(entries))
+		for _, e := range entries {
+			chapters = append(chapters, concat.Chapter{
+				Start: e.Time.Sub(start),
+				Title: e.Title,
+			})
+		}
+		// The metadata is polled once the recording started.
+		chapters[0].Start = 0
+		return chapters, nil
+	}
+}
+
+// watchMetadata polls the metadata of the live stream until the context is
+// canceled.
+//
+// The title and the number of viewers are exposed in the state, and a
+// notification is sent when the title changes. The changes are appended to
+// the timeline file fName, if not empty.
+func (f *FC2) watchMetadata(ctx context.Context, meta api.GetMetaData, fName string) {
+	log := log.Ctx(ctx).With().Str("fnameTimeline", fName).Logger()
+
+	var enc *json.Encoder
+	if fName != "" {
+		// The file is appended to, so that a resumed download continues the
+		// timeline.
+		file, err := os.OpenFile(fName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Err(err).Msg("failed to open timeline file")
+		} else {
+			defer file.Close()
+			enc = json.NewEncoder(file)
+		}
+	}
+	record := func(e TimelineEntry) {
+		state.DefaultState.SetChannelLive(f.ChannelID, e.Title, e.Viewers)
+		if enc == nil {
+			return
+		}
+		if err := enc.Encode(e); err != nil {
+			log.Err(err).Msg("failed to write timeline")
+		}
+	}
+
+	last := NewTimelineEntry(time.Now().UTC(), meta)
+	record(last)
+
+	ticker := time.NewTicker(f.Params.PollMetadataInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		meta, err := f.GetMeta(ctx, f.ChannelID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Msg("failed to poll metadata")
+			continue
+		}
+		// The metadata of an offline channel is not relevant.
+		if meta.ChannelData.IsPublish == 0 {
+			continue
+		}
+
+		e := NewTimelineEntry(time.Now().UTC(), meta)
+		if e.SameAs(last) {
+			continue
+		}
+		record(e)
+		if e.Title != last.Title {
+			log.Info().Str("oldTitle", last.Title).Str("title", e.Title).Msg("title changed")
+			if err := notifier.NotifyTitleChanged(
+				ctx,
+				f.ChannelID,
+				f.Params.Labels,
+				meta,
+				last.Title,
+			); err != nil {
+				log.Err(err).Msg("notify failed")
+			}
+		}
+		last = e
+	}
+}
@@ -0,0 +1,139 @@
+package fc2_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/video/concat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimelineEntry(t *testing.T) {
+	// Arrange
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	meta := api.GetMetaData{
+		ChannelData: api.ChannelData{
+			Title:        "title",
+			CategoryName: "category",
+			Count:        json.Number("42"),
+		},
+	}
+
+	// Act
+	e := fc2.NewTimelineEntry(now, meta)
+
+	// Assert
+	require.Equal(t, fc2.TimelineEntry{
+		Time:     now,
+		Title:    "title",
+		Category: "category",
+		Viewers:  42,
+	}, e)
+	require.True(t, e.SameAs(fc2.NewTimelineEntry(now.Add(time.Minute), meta)))
+	meta.ChannelData.Count = json.Number("43")
+	require.False(t, e.SameAs(fc2.NewTimelineEntry(now, meta)))
+}
+
+func TestReadTimeline(t *testing.T) {
+	// Arrange
+	fName := filepath.Join(t.TempDir(), "name.timeline.json")
+	err := os.WriteFile(fName, []byte(
+		`{"time":"2024-01-02T03:04:05Z","title":"a","viewers":1}
+{"time":"2024-01-02T03:05:05Z","title":"b","category":"c","viewers":2}
+{"time":"2024-01-02T03:0`,
+	), 0o644)
+	require.NoError(t, err)
+
+	// Act
+	entries, err := fc2.ReadTimeline(fName)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []fc2.TimelineEntry{
+		{
+			Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Title:   "a",
+			Viewers: 1,
+		},
+		{
+			Time:     time.Date(2024, 1, 2, 3, 5, 5, 0, time.UTC),
+			Title:    "b",
+			Category: "c",
+			Viewers:  2,
+		},
+	}, entries)
+}
+
+func TestTimelineChapters(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	dest := t.TempDir()
+	start := time.Unix(1700000000, 0).UTC()
+	// The timeline of the first recording was moved to the destination. The
+	// metadata is polled after the start of the recording.
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dest, "name.timeline.json"),
+		[]byte(`{"time":"2023-11-14T22:13:21Z","title":"a","viewers":1}`+"\n"+
+			`{"time":"2023-11-14T22:14:20Z","title":"b","viewers":1}`+"\n"),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dest, "name.report.json"),
+		[]byte(`{"startTime":"`+start.Format(time.RFC3339)+`"}`),
+		0o644,
+	))
+	// Without report, the first entry is the start.
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "name.1.timeline.json"),
+		[]byte(`{"time":"2023-11-14T23:00:00Z","title":"c","viewers":1}`+"\n"+
+			`{"time":"2023-11-14T23:00:30Z","title":"d","viewers":1}`+"\n"),
+		0o644,
+	))
+	// The recording was resumed: the report only covers the last run.
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "name.2.timeline.json"),
+		[]byte(`{"time":"2023-11-15T00:00:01Z","title":"e","viewers":1}`+"\n"+
+			`{"time":"2023-11-15T00:10:00Z","title":"f","viewers":1}`+"\n"),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "name.2.report.json"),
+		[]byte(`{"startTime":"2023-11-15T00:09:00Z"}`),
+		0o644,
+	))
+	loader := fc2.TimelineChapters(
+		filepath.Join(dir, "name.2.ts"),
+		time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC),
+		dest,
+	)
+
+	// Act
+	first, err1 := loader(filepath.Join(dir, "name.ts"))
+	second, err2 := loader(filepath.Join(dir, "name.1.ts"))
+	resumed, err3 := loader(filepath.Join(dir, "name.2.ts"))
+	none, err4 := loader(filepath.Join(dir, "name.3.ts"))
+
+	// Assert
+	require.NoError(t, err1)
+	require.Equal(t, []concat.Chapter{
+		{Start: 0, Title: "a"},
+		{Start: time.Minute, Title: "b"},
+	}, first)
+	require.NoError(t, err2)
+	require.Equal(t, []concat.Chapter{
+		{Start: 0, Title: "c"},
+		{Start: 30 * time.Second, Title: "d"},
+	}, second)
+	require.NoError(t, err3)
+	require.Equal(t, []concat.Chapter{
+		{Start: 0, Title: "e"},
+		{Start: 10 * time.Minute, Title: "f"},
+	}, resumed)
+	require.NoError(t, err4)
+	require.Nil(t, none)
+}
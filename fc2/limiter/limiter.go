@@ -0,0 +1,255 @@
+// Package limiter provides a limiter for the number of concurrent downloads.
+//
+// Downloads waiting for a slot are served by decreasing priority, then by
+// arrival order. A download with a higher priority can also preempt a running
+// download with a lower priority.
+package limiter
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Option is the option for the limiter.
+type Option func(*Options)
+
+// Options are the options for the limiter.
+type Options struct {
+	preempt bool
+}
+
+// WithPreemption allows a download to preempt a running download with a lower
+// priority when all the slots are taken, if enabled.
+func WithPreemption(enabled bool) Option {
+	return func(o *Options) {
+		o.preempt = enabled
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Limiter limits the number of concurrent downloads.
+type Limiter struct {
+	max  int
+	opts *Options
+
+	mu      sync.Mutex
+	seq     uint64
+	running map[*Slot]struct{}
+	waiting []*request
+}
+
+type request struct {
+	ctx       context.Context
+	channelID string
+	priority  int
+	seq       uint64
+	granted   chan *Slot
+}
+
+// Slot is a download slot.
+type Slot struct {
+	ChannelID string
+	Priority  int
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	preempted atomic.Bool
+	limiter   *Limiter
+}
+
+// New creates a new limiter.
+//
+// A maxDownloads lower or equal to zero means no limit.
+func New(maxDownloads int, opts ...Option) *Limiter {
+	return &Limiter{
+		max:     maxDownloads,
+		opts:    applyOptions(opts),
+		running: make(map[*Slot]struct{}),
+	}
+}
+
+// Acquire blocks until a download slot is available.
+//
+// onQueued is called if all the slots are taken and the download has to wait.
+// The ctx only bounds the wait: the context of the returned slot is canceled
+// when the slot is preempted or released.
+func (l *Limiter) Acquire(
+	ctx context.Context,
+	channelID string,
+	priority int,
+	onQueued func(),
+) (*Slot, error) {
+	l.mu.Lock()
+	if l.max <= 0 || len(l.running) < l.max {
+		s := l.newSlotLocked(ctx, channelID, priority)
+		l.mu.Unlock()
+		return s, nil
+	}
+
+	r := &request{
+		ctx:       ctx,
+		channelID: channelID,
+		priority:  priority,
+		seq:       l.seq,
+		granted:   make(chan *Slot, 1),
+	}
+	l.seq++
+	l.waiting = append(l.waiting, r)
+	slices.SortStableFunc(l.waiting, func(a, b *request) int {
+		if a.priority != b.priority {
+			return cmp.Compare(b.priority, a.priority)
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	if l.opts.preempt {
+		l.preemptLocked(priority)
+	}
+	l.mu.Unlock()
+
+	if onQueued != nil {
+		select {
+		case s := <-r.granted:
+			// Granted by the preemption.
+			return s, nil
+		default:
+			onQueued()
+		}
+	}
+
+	select {
+	case s := <-r.granted:
+		return s, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		idx := slices.Index(l.waiting, r)
+		if idx >= 0 {
+			l.waiting = slices.Delete(l.waiting, idx, idx+1)
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		l.mu.Unlock()
+		// The slot was granted concurrently.
+		(<-r.granted).Release()
+		return nil, ctx.Err()
+	}
+}
+
+// SetMax changes the maximum number of concurrent downloads. A maxDownloads
+// lower or equal to zero means no limit.
+//
+// The free slots are granted to the waiting downloads. The running downloads
+// above the new maximum are not interrupted.
+func (l *Limiter) SetMax(maxDownloads int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = maxDownloads
+	l.grantLocked()
+}
+
+// SetPreemption enables or disables the preemption of the running downloads
+// with a lower priority.
+func (l *Limiter) SetPreemption(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.opts.preempt = enabled
+}
+
+// Running returns the number of running downloads.
+func (l *Limiter) Running() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.running)
+}
+
+// Waiting returns the number of queued downloads.
+func (l *Limiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiting)
+}
+
+func (l *Limiter) newSlotLocked(ctx context.Context, channelID string, priority int) *Slot {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s := &Slot{
+		ChannelID: channelID,
+		Priority:  priority,
+		ctx:       ctx,
+		cancel:    cancel,
+		limiter:   l,
+	}
+	l.running[s] = struct{}{}
+	return s
+}
+
+// grantLocked grants the free slots to the waiting downloads.
+func (l *Limiter) grantLocked() {
+	for len(l.waiting) > 0 && (l.max <= 0 || len(l.running) < l.max) {
+		r := l.waiting[0]
+		l.waiting = l.waiting[1:]
+		r.granted <- l.newSlotLocked(r.ctx, r.channelID, r.priority)
+	}
+}
+
+// preemptLocked preempts the running download with the lowest priority if it
+// is lower than the given priority.
+func (l *Limiter) preemptLocked(priority int) {
+	var victim *Slot
+	for s := range l.running {
+		if s.Priority >= priority {
+			continue
+		}
+		if victim == nil || s.Priority < victim.Priority {
+			victim = s
+		}
+	}
+	if victim == nil {
+		return
+	}
+
+	log.Warn().
+		Str("channelID", victim.ChannelID).
+		Int("priority", victim.Priority).
+		Int("preemptedBy", priority).
+		Msg("preempting download")
+	victim.preempted.Store(true)
+	victim.cancel()
+	delete(l.running, victim)
+	l.grantLocked()
+}
+
+// Context returns the context of the slot, which is canceled when the slot is
+// preempted or released.
+func (s *Slot) Context() context.Context {
+	return s.ctx
+}
+
+// Preempted returns true if the slot was preempted by a download with a higher
+// priority.
+func (s *Slot) Preempted() bool {
+	return s.preempted.Load()
+}
+
+// Release releases the slot.
+func (s *Slot) Release() {
+	s.cancel()
+	l := s.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.running[s]; !ok {
+		return
+	}
+	delete(l.running, s)
+	l.grantLocked()
+}
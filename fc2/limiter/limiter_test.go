@@ -0,0 +1,164 @@
+package limiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/limiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireUnlimited(t *testing.T) {
+	// Arrange
+	l := limiter.New(0)
+
+	// Act
+	a, errA := l.Acquire(context.Background(), "a", 0, nil)
+	b, errB := l.Acquire(context.Background(), "b", 0, nil)
+
+	// Assert
+	require.NoError(t, errA)
+	require.NoError(t, errB)
+	require.Equal(t, 2, l.Running())
+	a.Release()
+	b.Release()
+	require.Equal(t, 0, l.Running())
+}
+
+func TestAcquireQueueByPriority(t *testing.T) {
+	// Arrange
+	l := limiter.New(1)
+	running, err := l.Acquire(context.Background(), "running", 0, nil)
+	require.NoError(t, err)
+
+	granted := make(chan string, 2)
+	acquire := func(channelID string, priority int) {
+		queued := make(chan struct{})
+		go func() {
+			s, err := l.Acquire(context.Background(), channelID, priority, func() {
+				close(queued)
+			})
+			assert.NoError(t, err)
+			granted <- channelID
+			s.Release()
+		}()
+		<-queued
+	}
+	acquire("low", 1)
+	acquire("high", 2)
+	require.Equal(t, 2, l.Waiting())
+
+	// Act
+	running.Release()
+
+	// Assert
+	require.Equal(t, "high", <-granted)
+	require.Equal(t, "low", <-granted)
+	require.False(t, running.Preempted())
+}
+
+func TestAcquirePreempt(t *testing.T) {
+	// Arrange
+	l := limiter.New(1, limiter.WithPreemption(true))
+	low, err := l.Acquire(context.Background(), "low", 0, nil)
+	require.NoError(t, err)
+
+	// Act
+	queued := false
+	high, err := l.Acquire(context.Background(), "high", 1, func() {
+		queued = true
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.False(t, queued)
+	require.True(t, low.Preempted())
+	require.ErrorIs(t, low.Context().Err(), context.Canceled)
+	require.NoError(t, high.Context().Err())
+	low.Release()
+	require.Equal(t, 1, l.Running())
+	high.Release()
+	require.Equal(t, 0, l.Running())
+}
+
+func TestAcquireNoPreemptSamePriority(t *testing.T) {
+	// Arrange
+	l := limiter.New(1, limiter.WithPreemption(true))
+	running, err := l.Acquire(context.Background(), "running", 1, nil)
+	require.NoError(t, err)
+	defer running.Release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Act
+	queued := false
+	_, err = l.Acquire(ctx, "other", 1, func() {
+		queued = true
+	})
+
+	// Assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, queued)
+	require.False(t, running.Preempted())
+	require.Equal(t, 0, l.Waiting())
+}
+
+func TestSetMax(t *testing.T) {
+	// Arrange
+	l := limiter.New(1)
+	running, err := l.Acquire(context.Background(), "running", 0, nil)
+	require.NoError(t, err)
+	queued := make(chan struct{})
+	granted := make(chan *limiter.Slot, 1)
+	go func() {
+		s, err := l.Acquire(context.Background(), "waiting", 0, func() {
+			close(queued)
+		})
+		assert.NoError(t, err)
+		granted <- s
+	}()
+	<-queued
+
+	// Act
+	l.SetMax(2)
+
+	// Assert
+	s := <-granted
+	require.Equal(t, 2, l.Running())
+	require.Equal(t, 0, l.Waiting())
+	l.SetMax(1)
+	require.Equal(t, 2, l.Running(), "the running downloads are not interrupted")
+	require.False(t, running.Preempted())
+	s.Release()
+	running.Release()
+	require.Equal(t, 0, l.Running())
+}
+
+func TestAcquireContextBoundsWait(t *testing.T) {
+	// Arrange
+	l := limiter.New(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	running, err := l.Acquire(ctx, "running", 0, nil)
+	require.NoError(t, err)
+	queued := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, "waiting", 0, func() {
+			close(queued)
+		})
+		errc <- err
+	}()
+	<-queued
+
+	// Act
+	cancel()
+
+	// Assert
+	require.ErrorIs(t, <-errc, context.Canceled)
+	require.Equal(t, 0, l.Waiting())
+	require.NoError(t, running.Context().Err(), "the slot outlives the wait")
+	running.Release()
+	require.ErrorIs(t, running.Context().Err(), context.Canceled)
+}
@@ -0,0 +1,378 @@
+// Package postprocess provides a queue of post-processing jobs (remux, audio
+// extraction and concatenation) run by a bounded pool of workers.
+//
+// The jobs of a recording are chained: each job is queued once the previous one
+// is done.
+//
+// The queue can be persisted in a file: the jobs which were queued or running
+// when the program stopped are run again on the next start, with the rest of
+// their chain, and the failed jobs are kept until they are retried or removed.
+package postprocess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrJobNotFound is returned when the job is not in the queue.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobRunning is returned when the job cannot be changed while running.
+	ErrJobRunning = errors.New("job is running")
+	// ErrJobNotFailed is returned when retrying a job which did not fail.
+	ErrJobNotFailed = errors.New("job did not fail")
+)
+
+// Runner runs a job.
+type Runner func(ctx context.Context, job state.Job) error
+
+// Option is the option for the queue.
+type Option func(*Options)
+
+// Options are the options for the queue.
+type Options struct {
+	filename string
+}
+
+// WithPersistence persists the queue in the file. The jobs of the file are
+// loaded by New.
+func WithPersistence(filename string) Option {
+	return func(o *Options) {
+		o.filename = filename
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Queue is a queue of post-processing jobs.
+type Queue struct {
+	workers int
+	run     Runner
+	opts    *Options
+
+	mu      sync.Mutex
+	entries []*entry
+	wake    chan struct{}
+}
+
+type entry struct {
+	job state.Job
+}
+
+// New creates a queue running at most workers jobs concurrently.
+//
+// A workers lower or equal to zero means one worker.
+func New(workers int, run Runner, opts ...Option) (*Queue, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	q := &Queue{
+		workers: workers,
+		run:     run,
+		opts:    applyOptions(opts),
+		wake:    make(chan struct{}, 1),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load reads the persisted jobs. The running jobs are queued again.
+func (q *Queue) load() error {
+	if q.opts.filename == "" {
+		return nil
+	}
+	b, err := os.ReadFile(q.opts.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot read %s: %w", q.opts.filename, err)
+	}
+	var jobs []state.Job
+	if err := json.Unmarshal(b, &jobs); err != nil {
+		return fmt.Errorf("cannot decode %s: %w", q.opts.filename, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range jobs {
+		if job.Status != state.JobStatusFailed {
+			job.Status = state.JobStatusQueued
+		}
+		q.entries = append(q.entries, &entry{job: job})
+	}
+	if len(jobs) > 0 {
+		log.Info().Int("jobs", len(jobs)).Msg("loaded persisted post-processing jobs")
+	}
+	q.publishLocked()
+	return nil
+}
+
+// Run starts the workers and blocks until the context is canceled.
+//
+// The jobs interrupted by the cancellation are queued again.
+func (q *Queue) Run(ctx context.Context) {
+	q.signal()
+	var wg sync.WaitGroup
+	for range q.workers {
+		wg.Go(func() {
+			for {
+				e, ok := q.next(ctx)
+				if !ok {
+					return
+				}
+				q.runEntry(ctx, e)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// Submit adds the job to the queue and returns its ID, without waiting for the
+// job to run.
+//
+// The jobs of job.Then are queued one after the other once the job is done.
+func (q *Queue) Submit(job state.Job) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id := q.addLocked(job)
+	q.saveLocked()
+	q.signal()
+	return id
+}
+
+// Next returns the job following job in its chain, once job is done with err.
+//
+// If job failed, the intermediates of the rest of the chain are kept, so that
+// job can be retried.
+func Next(job state.Job, err error) (state.Job, bool) {
+	if len(job.Then) == 0 {
+		return state.Job{}, false
+	}
+	next := job.Then[0]
+	next.Then = slices.Clone(job.Then[1:])
+	if err != nil {
+		next.Intermediates = nil
+		for i := range next.Then {
+			next.Then[i].Intermediates = nil
+		}
+	}
+	return next, true
+}
+
+// Retry queues a failed job again.
+func (q *Queue) Retry(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e := q.findLocked(id)
+	if e == nil {
+		return ErrJobNotFound
+	}
+	if e.job.Status != state.JobStatusFailed {
+		return ErrJobNotFailed
+	}
+	e.job.Status = state.JobStatusQueued
+	e.job.Error = ""
+	e.job.UpdatedAt = time.Now().UTC()
+	q.saveLocked()
+	q.signal()
+	return nil
+}
+
+// Remove removes a job which is not running.
+func (q *Queue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e := q.findLocked(id)
+	if e == nil {
+		return ErrJobNotFound
+	}
+	if e.job.Status == state.JobStatusRunning {
+		return ErrJobRunning
+	}
+	q.deleteLocked(e)
+	q.saveLocked()
+	return nil
+}
+
+// Jobs returns the jobs of the queue, by submission order.
+func (q *Queue) Jobs() []state.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.jobsLocked()
+}
+
+// next blocks until a job is queued and marks it as running.
+//
+// A job is not run while another job of the same channel or with the same
+// output is running, as they may work on the same files.
+func (q *Queue) next(ctx context.Context) (*entry, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		q.mu.Lock()
+		var next *entry
+		queued := 0
+		for _, e := range q.entries {
+			if e.job.Status != state.JobStatusQueued {
+				continue
+			}
+			if next == nil && !q.conflictsLocked(e.job) {
+				next = e
+			}
+			queued++
+		}
+		if next != nil {
+			next.job.Status = state.JobStatusRunning
+			next.job.Attempts++
+			next.job.UpdatedAt = time.Now().UTC()
+			q.saveLocked()
+			q.mu.Unlock()
+			if queued > 1 {
+				// Wake another worker.
+				q.signal()
+			}
+			return next, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (q *Queue) runEntry(ctx context.Context, e *entry) {
+	log := log.With().
+		Str("jobID", e.job.ID).
+		Str("channelID", e.job.ChannelID).
+		Str("kind", string(e.job.Kind)).
+		Logger()
+	log.Info().Str("input", e.job.Input).Str("output", e.job.Output).Msg("running post-processing job")
+	err := q.run(ctx, e.job)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e.job.UpdatedAt = time.Now().UTC()
+	switch {
+	case ctx.Err() != nil:
+		log.Warn().Err(err).Msg("post-processing job interrupted, it will be run again on the next start")
+		e.job.Status = state.JobStatusQueued
+		q.saveLocked()
+		return
+	case err != nil:
+		log.Err(err).Msg("post-processing job failed")
+		e.job.Status = state.JobStatusFailed
+		e.job.Error = err.Error()
+	default:
+		log.Info().Msg("post-processing job done")
+		q.deleteLocked(e)
+	}
+	// The chain goes on, the failed job is retried alone.
+	if next, ok := Next(e.job, err); ok {
+		q.addLocked(next)
+	}
+	e.job.Then = nil
+	q.saveLocked()
+	// The jobs waiting for this one can run.
+	q.signal()
+}
+
+// conflictsLocked reports whether a running job has the same channel or the
+// same output as job.
+func (q *Queue) conflictsLocked(job state.Job) bool {
+	return slices.ContainsFunc(q.entries, func(e *entry) bool {
+		if e.job.Status != state.JobStatusRunning {
+			return false
+		}
+		return e.job.ChannelID == job.ChannelID ||
+			(job.Output != "" && e.job.Output == job.Output)
+	})
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// addLocked adds the job to the queue and returns its ID.
+func (q *Queue) addLocked(job state.Job) string {
+	now := time.Now().UTC()
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("%s-%s-%d", job.ChannelID, job.Kind, now.UnixNano())
+	}
+	job.Status = state.JobStatusQueued
+	job.Attempts = 0
+	job.Error = ""
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	q.entries = append(q.entries, &entry{job: job})
+	return job.ID
+}
+
+func (q *Queue) findLocked(id string) *entry {
+	idx := slices.IndexFunc(q.entries, func(e *entry) bool {
+		return e.job.ID == id
+	})
+	if idx < 0 {
+		return nil
+	}
+	return q.entries[idx]
+}
+
+func (q *Queue) deleteLocked(e *entry) {
+	q.entries = slices.DeleteFunc(q.entries, func(other *entry) bool {
+		return other == e
+	})
+}
+
+func (q *Queue) jobsLocked() []state.Job {
+	jobs := make([]state.Job, 0, len(q.entries))
+	for _, e := range q.entries {
+		jobs = append(jobs, e.job)
+	}
+	return jobs
+}
+
+// publishLocked exposes the jobs in the state.
+func (q *Queue) publishLocked() {
+	state.DefaultState.SetJobs(q.jobsLocked())
+}
+
+// saveLocked publishes and writes the jobs in the file, if persisted.
+func (q *Queue) saveLocked() {
+	q.publishLocked()
+	if q.opts.filename == "" {
+		return
+	}
+	b, err := json.Marshal(q.jobsLocked())
+	if err != nil {
+		log.Err(err).Msg("failed to encode post-processing jobs")
+		return
+	}
+	if err := utils.WriteFileAtomic(q.opts.filename, b); err != nil {
+		log.Err(err).Str("file", q.opts.filename).Msg("failed to save post-processing jobs")
+	}
+}
@@ -0,0 +1,253 @@
+package postprocess_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/postprocess"
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitBounded(t *testing.T) {
+	// Arrange
+	var running, maxRunning atomic.Int32
+	q, err := postprocess.New(2, func(_ context.Context, _ state.Job) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	// Act
+	for i := range 5 {
+		q.Submit(state.Job{ChannelID: strconv.Itoa(i), Kind: state.JobKindRemux})
+	}
+
+	// Assert
+	require.Eventually(t, func() bool {
+		return len(q.Jobs()) == 0
+	}, time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 2, maxRunning.Load())
+}
+
+func TestSubmitExclusive(t *testing.T) {
+	tests := []struct {
+		title string
+		jobs  []state.Job
+	}{
+		{
+			title: "Same channel",
+			jobs: []state.Job{
+				{ChannelID: "test", Kind: state.JobKindRemux, Output: "a.mp4"},
+				{ChannelID: "test", Kind: state.JobKindConcat, Output: "b.mp4"},
+				{ChannelID: "test", Kind: state.JobKindFinish},
+			},
+		},
+		{
+			title: "Same output",
+			jobs: []state.Job{
+				{ChannelID: "1", Kind: state.JobKindRemux, Output: "a.mp4"},
+				{ChannelID: "2", Kind: state.JobKindRemux, Output: "a.mp4"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			var running, maxRunning atomic.Int32
+			q, err := postprocess.New(len(tt.jobs), func(_ context.Context, _ state.Job) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			})
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go q.Run(ctx)
+
+			// Act
+			for _, job := range tt.jobs {
+				q.Submit(job)
+			}
+
+			// Assert
+			require.Eventually(t, func() bool {
+				return len(q.Jobs()) == 0
+			}, time.Second, 10*time.Millisecond)
+			require.EqualValues(t, 1, maxRunning.Load())
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	// Arrange
+	var attempts atomic.Int32
+	q, err := postprocess.New(1, func(_ context.Context, _ state.Job) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("remux failed")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	// Act
+	id := q.Submit(state.Job{ChannelID: "test", Kind: state.JobKindRemux})
+	require.Eventually(t, func() bool {
+		jobs := q.Jobs()
+		return len(jobs) == 1 && jobs[0].Status == state.JobStatusFailed
+	}, time.Second, 10*time.Millisecond)
+	failed := q.Jobs()
+	errRetry := q.Retry(id)
+
+	// Assert
+	require.Equal(t, id, failed[0].ID)
+	require.Equal(t, "remux failed", failed[0].Error)
+	require.NoError(t, errRetry)
+	require.Eventually(t, func() bool {
+		return len(q.Jobs()) == 0
+	}, time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, q.Retry(failed[0].ID), postprocess.ErrJobNotFound)
+}
+
+func TestPersistence(t *testing.T) {
+	// Arrange
+	filename := filepath.Join(t.TempDir(), "jobs.json")
+	block := make(chan struct{})
+	q, err := postprocess.New(1, func(ctx context.Context, _ state.Job) error {
+		close(block)
+		<-ctx.Done()
+		return ctx.Err()
+	}, postprocess.WithPersistence(filename))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+	q.Submit(state.Job{
+		ChannelID: "test",
+		Kind:      state.JobKindConcat,
+		Input:     "prefix",
+		Then:      []state.Job{{ChannelID: "test", Kind: state.JobKindFinish}},
+	})
+	<-block
+	cancel()
+	<-stopped
+
+	// Act
+	var mu sync.Mutex
+	var ran []state.Job
+	reloaded, err := postprocess.New(1, func(_ context.Context, job state.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, job)
+		return nil
+	}, postprocess.WithPersistence(filename))
+	require.NoError(t, err)
+	jobs := reloaded.Jobs()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go reloaded.Run(ctx)
+
+	// Assert
+	require.Len(t, jobs, 1)
+	require.Equal(t, state.JobStatusQueued, jobs[0].Status)
+	require.Equal(t, "prefix", jobs[0].Input)
+	require.Eventually(t, func() bool {
+		return len(reloaded.Jobs()) == 0
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, ran, 2)
+	require.Equal(t, 2, ran[0].Attempts)
+	require.Equal(t, state.JobKindFinish, ran[1].Kind)
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		title         string
+		err           error
+		intermediates []string
+		failed        int
+	}{
+		{
+			title:         "Delete the intermediates once done",
+			intermediates: []string{"a.ts"},
+		},
+		{
+			title:  "Keep the intermediates if a job failed",
+			err:    errors.New("remux failed"),
+			failed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			finished := make(chan state.Job, 1)
+			q, err := postprocess.New(2, func(_ context.Context, job state.Job) error {
+				switch job.Kind {
+				case state.JobKindRemux:
+					return tt.err
+				case state.JobKindFinish:
+					finished <- job
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go q.Run(ctx)
+
+			// Act
+			q.Submit(state.Job{
+				ChannelID: "test",
+				Kind:      state.JobKindRemux,
+				Then: []state.Job{
+					{ChannelID: "test", Kind: state.JobKindConcat},
+					{ChannelID: "test", Kind: state.JobKindFinish, Intermediates: []string{"a.ts"}},
+				},
+			})
+
+			// Assert
+			finish := <-finished
+			require.Equal(t, tt.intermediates, finish.Intermediates)
+			require.Eventually(t, func() bool {
+				return len(q.Jobs()) == tt.failed
+			}, time.Second, 10*time.Millisecond)
+			for _, job := range q.Jobs() {
+				require.Equal(t, state.JobStatusFailed, job.Status)
+				require.Empty(t, job.Then)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Package presence provides a shared poller detecting which channels are online.
+//
+// Instead of polling the metadata of each channel, the poller fetches the public
+// channel list once per interval and wakes up the watchers of the channels that
+// appear in the list.
+package presence
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "fc2/presence"
+
+// ChannelLister fetches the list of the channels currently live.
+type ChannelLister interface {
+	GetChannelList(ctx context.Context) (api.GetChannelListResponse, error)
+}
+
+// Option is the option for the poller.
+type Option func(*Options)
+
+// Options are the options for the poller.
+type Options struct {
+	fallbackInterval time.Duration
+}
+
+// WithFallbackInterval sets the interval at which watchers should still check
+// the metadata of their channel, in case the channel is missing from the
+// channel list (adult or hidden channels for example).
+//
+// A zero value disables the fallback.
+func WithFallbackInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.fallbackInterval = d
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{
+		fallbackInterval: 5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Poller polls the channel list and notifies the subscribers when their
+// channel is online.
+type Poller struct {
+	lister   ChannelLister
+	interval time.Duration
+	opts     *Options
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+// New creates a new presence poller.
+func New(lister ChannelLister, interval time.Duration, opts ...Option) *Poller {
+	if lister == nil {
+		log.Panic().Msg("lister is nil")
+	}
+	return &Poller{
+		lister:      lister,
+		interval:    interval,
+		opts:        applyOptions(opts),
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// FallbackInterval returns the interval at which watchers should check their
+// channel without waiting for the poller.
+func (p *Poller) FallbackInterval() time.Duration {
+	return p.opts.fallbackInterval
+}
+
+// Subscribe returns a channel which receives a signal each time the channel is
+// seen online.
+//
+// The signal is dropped if the previous one was not consumed. The returned
+// function must be called to unsubscribe.
+func (p *Poller) Subscribe(channelID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.subscribers[channelID]; !ok {
+		p.subscribers[channelID] = make(map[chan struct{}]struct{})
+	}
+	p.subscribers[channelID][ch] = struct{}{}
+
+	return ch, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.subscribers[channelID], ch)
+		if len(p.subscribers[channelID]) == 0 {
+			delete(p.subscribers, channelID)
+		}
+	}
+}
+
+// Run polls the channel list until the context is canceled.
+func (p *Poller) Run(ctx context.Context) error {
+	log.Info().Stringer("interval", p.interval).Msg("presence poller started")
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Err(err).Msg("failed to poll the channel list")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("presence poller stopped")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the channel list once and notifies the subscribers of the
+// online channels.
+//
+// The channel list is not fetched if there is no subscriber.
+func (p *Poller) Poll(ctx context.Context) error {
+	p.mu.Lock()
+	n := len(p.subscribers)
+	p.mu.Unlock()
+	if n == 0 {
+		return nil
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "presence.Poll", trace.WithAttributes(
+		attribute.Int("subscribers", n),
+	))
+	defer span.End()
+
+	list, err := p.lister.GetChannelList(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	online := make(map[string]bool, len(list.Channel))
+	for _, channel := range list.Channel {
+		online[channel.ID] = true
+	}
+	p.notify(online)
+	return nil
+}
+
+func (p *Poller) notify(online map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for channelID, subs := range p.subscribers {
+		if !online[channelID] {
+			continue
+		}
+		log.Debug().Str("channelID", channelID).Msg("channel seen in the channel list")
+		for ch := range subs {
+			select {
+			case ch <- struct{}{}:
+			default:
+				// A signal is already pending.
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package presence_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/fc2/presence"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLister struct {
+	calls int
+	resp  api.GetChannelListResponse
+	err   error
+}
+
+func (l *fakeLister) GetChannelList(_ context.Context) (api.GetChannelListResponse, error) {
+	l.calls++
+	return l.resp, l.err
+}
+
+func TestPoll(t *testing.T) {
+	// Arrange
+	lister := &fakeLister{
+		resp: api.GetChannelListResponse{
+			Channel: []api.GetChannelListChannel{
+				{ID: "1"},
+				{ID: "3"},
+			},
+		},
+	}
+	p := presence.New(lister, 0)
+	online, unsubscribeOnline := p.Subscribe("1")
+	defer unsubscribeOnline()
+	offline, unsubscribeOffline := p.Subscribe("2")
+	defer unsubscribeOffline()
+
+	// Act
+	err := p.Poll(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, 1, lister.calls)
+	require.Len(t, online, 1)
+	require.Empty(t, offline)
+}
+
+func TestPollSignalIsNotBlocking(t *testing.T) {
+	// Arrange
+	lister := &fakeLister{
+		resp: api.GetChannelListResponse{
+			Channel: []api.GetChannelListChannel{{ID: "1"}},
+		},
+	}
+	p := presence.New(lister, 0)
+	ch, unsubscribe := p.Subscribe("1")
+	defer unsubscribe()
+
+	// Act
+	require.NoError(t, p.Poll(context.Background()))
+	require.NoError(t, p.Poll(context.Background()))
+
+	// Assert
+	require.Len(t, ch, 1)
+}
+
+func TestPollWithoutSubscribers(t *testing.T) {
+	// Arrange
+	lister := &fakeLister{}
+	p := presence.New(lister, 0)
+	_, unsubscribe := p.Subscribe("1")
+	unsubscribe()
+
+	// Act
+	err := p.Poll(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, 0, lister.calls)
+}
+
+func TestPollError(t *testing.T) {
+	// Arrange
+	lister := &fakeLister{err: api.ErrRateLimit}
+	p := presence.New(lister, 0)
+	ch, unsubscribe := p.Subscribe("1")
+	defer unsubscribe()
+
+	// Act
+	err := p.Poll(context.Background())
+
+	// Assert
+	require.True(t, errors.Is(err, api.ErrRateLimit))
+	require.Empty(t, ch)
+}
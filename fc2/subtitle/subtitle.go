@@ -0,0 +1,280 @@
+// Package subtitle converts the chat of a live stream into subtitles.
+//
+// The comments are placed on the timeline of the video with their timestamp
+// relative to the start of the recording. They are rendered as scrolling
+// danmaku in ASS, or as plain SRT.
+package subtitle
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+)
+
+// Format is the format of the subtitles.
+type Format string
+
+const (
+	// FormatASS renders the comments as scrolling danmaku.
+	FormatASS Format = "ass"
+	// FormatSRT renders the comments as plain subtitles.
+	FormatSRT Format = "srt"
+)
+
+// ParseFormat returns the format from its name, which is also its extension.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatASS, FormatSRT:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown subtitle format %q, expected ass or srt", s)
+}
+
+// Option is the option for the conversion.
+type Option func(*Options)
+
+// Options are the options for the conversion.
+type Options struct {
+	duration time.Duration
+	width    int
+	height   int
+	fontSize int
+}
+
+// WithDuration sets how long each comment is displayed. (default: 8s for ASS,
+// 4s for SRT)
+func WithDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.duration = d
+	}
+}
+
+// WithResolution sets the resolution of the ASS canvas. (default: 1280x720)
+func WithResolution(width, height int) Option {
+	return func(o *Options) {
+		o.width = width
+		o.height = height
+	}
+}
+
+// WithFontSize sets the font size of the ASS comments, relative to the
+// resolution. (default: 36)
+func WithFontSize(size int) Option {
+	return func(o *Options) {
+		o.fontSize = size
+	}
+}
+
+func applyOptions(format Format, opts []Option) *Options {
+	o := &Options{
+		duration: 8 * time.Second,
+		width:    1280,
+		height:   720,
+		fontSize: 36,
+	}
+	if format == FormatSRT {
+		o.duration = 4 * time.Second
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Cue is a comment placed on the timeline of the video.
+type Cue struct {
+	// Offset is the time of the comment since the start of the video.
+	Offset time.Duration
+	Text   string
+	// Color is the color of the comment in RRGGBB hexadecimal. Empty means the
+	// default color.
+	Color string
+	// Scale is the size of the comment relative to the default size.
+	Scale float64
+}
+
+// ReadComments reads the comments of a chat file written by the downloader,
+// one JSON object per line.
+//
+// The invalid lines, e.g. a line truncated by a crash, are skipped.
+func ReadComments(r io.Reader) ([]api.Comment, error) {
+	var comments []api.Comment
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var c api.Comment
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	return comments, scanner.Err()
+}
+
+// CommentTime returns the time at which the comment was posted.
+//
+// The timestamp is in seconds, or in milliseconds for large values.
+func CommentTime(c api.Comment) (time.Time, error) {
+	ts, err := c.Timestamp.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", c.Timestamp, err)
+	}
+	if ts > 1e11 {
+		return time.UnixMilli(int64(ts)), nil
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+// Cues places the comments on the timeline of a video started at start.
+//
+// The comments posted before the start or without timestamp are dropped. The
+// cues are sorted by offset.
+func Cues(comments []api.Comment, start time.Time) []Cue {
+	cues := make([]Cue, 0, len(comments))
+	for _, c := range comments {
+		text := strings.Join(strings.Fields(c.Comment), " ")
+		if text == "" {
+			continue
+		}
+		t, err := CommentTime(c)
+		if err != nil {
+			continue
+		}
+		offset := t.Sub(start)
+		if offset < 0 {
+			continue
+		}
+		cues = append(cues, Cue{
+			Offset: offset,
+			Text:   text,
+			Color:  parseColor(c.Color),
+			Scale:  parseScale(c.Size),
+		})
+	}
+	slices.SortStableFunc(cues, func(a, b Cue) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	return cues
+}
+
+// parseColor returns the color in RRGGBB hexadecimal. It accepts "#RRGGBB",
+// "RRGGBB" and decimal RGB values. Zero and unknown values mean the default
+// color.
+func parseColor(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) == 6 {
+		if _, err := strconv.ParseUint(s, 16, 32); err == nil {
+			return strings.ToLower(s)
+		}
+	}
+	if v, err := strconv.ParseUint(s, 10, 32); err == nil && v > 0 && v <= 0xffffff {
+		return fmt.Sprintf("%06x", v)
+	}
+	return ""
+}
+
+// parseScale returns the scale of the comment size.
+func parseScale(s string) float64 {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "big", "large":
+		return 1.5
+	case "small":
+		return 0.75
+	}
+	return 1
+}
+
+// Event is a dialogue of an ASS track.
+type Event struct {
+	Start time.Duration
+	End   time.Duration
+	// Style is the name of the style of the dialogue, defined in the header.
+	Style string
+	// Text is the text of the dialogue, with its override tags.
+	Text string
+}
+
+// Track renders the cues as the header and the dialogues of an ASS track, for
+// embedding the comments in a video.
+//
+// ASS renders the cues as scrolling danmaku. SRT renders them as plain
+// subtitles at the bottom of the video, for the players which do not support
+// the ASS positioning such as timed text in MP4.
+func Track(cues []Cue, format Format, opts ...Option) (header string, events []Event, err error) {
+	o := applyOptions(format, opts)
+	switch format {
+	case FormatASS:
+		return danmakuHeader(o), danmakuEvents(cues, o), nil
+	case FormatSRT:
+		return plainHeader(o), plainEvents(cues, o), nil
+	}
+	return "", nil, fmt.Errorf("unknown subtitle format %q", format)
+}
+
+// Write renders the cues in the format.
+func Write(w io.Writer, cues []Cue, format Format, opts ...Option) error {
+	o := applyOptions(format, opts)
+	switch format {
+	case FormatASS:
+		return writeASS(w, cues, o)
+	case FormatSRT:
+		return writeSRT(w, cues, o)
+	}
+	return fmt.Errorf("unknown subtitle format %q", format)
+}
+
+// ConvertFile converts the chat file into subtitles, aligned on a video
+// started at start.
+//
+// The output is written under its .part name until complete.
+func ConvertFile(
+	output string,
+	input string,
+	start time.Time,
+	format Format,
+	opts ...Option,
+) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	comments, err := ReadComments(in)
+	if err != nil {
+		return err
+	}
+
+	part := utils.PartName(output)
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(out)
+	if err := Write(bw, Cues(comments, start), format, opts...); err != nil {
+		_ = out.Close()
+		_ = os.Remove(part)
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(part)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(part)
+		return err
+	}
+	return utils.FinalizePart(part, output)
+}
@@ -0,0 +1,182 @@
+package subtitle
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: %[1]d
+PlayResY: %[2]d
+WrapStyle: 2
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: %[4]s,sans-serif,%[3]d,&H00FFFFFF,&H00FFFFFF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,1.5,0,%[5]d,0,0,0,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+// lane is a row of the danmaku.
+type lane struct {
+	start time.Duration
+	width float64
+	used  bool
+}
+
+func writeASS(w io.Writer, cues []Cue, o *Options) error {
+	if _, err := io.WriteString(w, danmakuHeader(o)); err != nil {
+		return err
+	}
+	for _, e := range danmakuEvents(cues, o) {
+		if _, err := fmt.Fprintf(
+			w,
+			"Dialogue: 0,%s,%s,%s,,0,0,0,,%s\n",
+			formatASSTime(e.Start),
+			formatASSTime(e.End),
+			e.Style,
+			e.Text,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func danmakuHeader(o *Options) string {
+	return fmt.Sprintf(assHeader, o.width, o.height, o.fontSize, "Danmaku", 7)
+}
+
+// danmakuEvents places the cues in lanes scrolling from right to left.
+func danmakuEvents(cues []Cue, o *Options) []Event {
+	events := make([]Event, 0, len(cues))
+	lineHeight := float64(o.fontSize) * 1.2
+	lanes := make([]lane, max(1, int(float64(o.height)/lineHeight)))
+	for _, c := range cues {
+		size := float64(o.fontSize) * c.Scale
+		width := textWidth(c.Text, size)
+		idx := pickLane(lanes, c.Offset, width, float64(o.width), o.duration)
+		lanes[idx] = lane{start: c.Offset, width: width, used: true}
+
+		var tags strings.Builder
+		fmt.Fprintf(
+			&tags,
+			`\move(%d,%d,%d,%d)`,
+			o.width,
+			int(float64(idx)*lineHeight),
+			-int(width),
+			int(float64(idx)*lineHeight),
+		)
+		writeStyleTags(&tags, c, size)
+		events = append(events, Event{
+			Start: c.Offset,
+			End:   c.Offset + o.duration,
+			Style: "Danmaku",
+			Text:  "{" + tags.String() + "}" + escapeASS(c.Text),
+		})
+	}
+	return events
+}
+
+// plainHeader is the header of the plain subtitles, at the bottom of the
+// video.
+func plainHeader(o *Options) string {
+	return fmt.Sprintf(assHeader, o.width, o.height, o.fontSize, "Default", 2)
+}
+
+// plainEvents displays the cues at the bottom of the video, without motion.
+func plainEvents(cues []Cue, o *Options) []Event {
+	events := make([]Event, 0, len(cues))
+	for _, c := range cues {
+		var tags strings.Builder
+		writeStyleTags(&tags, c, float64(o.fontSize)*c.Scale)
+		text := escapeASS(c.Text)
+		if tags.Len() > 0 {
+			text = "{" + tags.String() + "}" + text
+		}
+		events = append(events, Event{
+			Start: c.Offset,
+			End:   c.Offset + o.duration,
+			Style: "Default",
+			Text:  text,
+		})
+	}
+	return events
+}
+
+// writeStyleTags writes the override tags of the color and the size of the
+// cue.
+func writeStyleTags(tags *strings.Builder, c Cue, size float64) {
+	if c.Color != "" {
+		// ASS colors are in BGR.
+		fmt.Fprintf(tags, `\c&H%s%s%s&`, c.Color[4:6], c.Color[2:4], c.Color[0:2])
+	}
+	if c.Scale != 1 {
+		fmt.Fprintf(tags, `\fs%d`, int(size))
+	}
+}
+
+// pickLane returns the first lane where the comment does not overlap the
+// previous one. The comments cross the screen in the same duration, so the
+// longer comments are faster.
+//
+// If every lane is taken, the lane of the oldest comment is returned.
+func pickLane(
+	lanes []lane,
+	offset time.Duration,
+	width float64,
+	screenWidth float64,
+	duration time.Duration,
+) int {
+	oldest := 0
+	for i, l := range lanes {
+		if !l.used {
+			return i
+		}
+		elapsed := (offset - l.start).Seconds()
+		speed := (screenWidth + l.width) / duration.Seconds()
+		newSpeed := (screenWidth + width) / duration.Seconds()
+		// The previous comment has fully entered the screen, and is out of the
+		// screen before the new comment reaches the left side.
+		if elapsed*speed >= l.width &&
+			speed*(elapsed+screenWidth/newSpeed) >= screenWidth+l.width {
+			return i
+		}
+		if l.start < lanes[oldest].start {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
+// textWidth estimates the width of the text: the wide characters (CJK,
+// kana...) are as wide as the font size, the others half as wide.
+func textWidth(text string, size float64) float64 {
+	var width float64
+	for _, r := range text {
+		if r >= 0x1100 {
+			width += size
+		} else {
+			width += size * 0.55
+		}
+	}
+	return width
+}
+
+// formatASSTime formats the offset as H:MM:SS.cc.
+func formatASSTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// escapeASS prevents the comment from being interpreted as override tags.
+var escapeASS = strings.NewReplacer(
+	`{`, `｛`,
+	`}`, `｝`,
+	`\`, `＼`,
+).Replace
@@ -0,0 +1,33 @@
+package subtitle
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+func writeSRT(w io.Writer, cues []Cue, o *Options) error {
+	for i, c := range cues {
+		text := c.Text
+		if c.Color != "" {
+			text = fmt.Sprintf(`<font color="#%s">%s</font>`, c.Color, text)
+		}
+		if _, err := fmt.Fprintf(
+			w,
+			"%d\n%s --> %s\n%s\n\n",
+			i+1,
+			formatSRTTime(c.Offset),
+			formatSRTTime(c.Offset+o.duration),
+			text,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatSRTTime formats the offset as HH:MM:SS,mmm.
+func formatSRTTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,159 @@
+package subtitle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/fc2/api"
+	"github.com/stretchr/testify/require"
+)
+
+const fixtureChat = `{"user_name":"a","comment":"hello","timestamp":1700000010,"color":"#FF0000","size":"big"}
+{"user_name":"b","comment":"before the start","timestamp":1699999990}
+{"user_name":"c","comment":"  ","timestamp":1700000011}
+{"user_name":"d","comment":"{\\pos(0,0)}world","timestamp":1700000001500}
+{"user_name":"e","comment":"trunc
+`
+
+func TestCues(t *testing.T) {
+	// Arrange
+	comments, err := ReadComments(strings.NewReader(fixtureChat))
+	require.NoError(t, err)
+
+	// Act
+	cues := Cues(comments, time.Unix(1700000000, 0))
+
+	// Assert
+	require.Equal(t, []Cue{
+		{Offset: 1500 * time.Millisecond, Text: `{\pos(0,0)}world`, Scale: 1},
+		{Offset: 10 * time.Second, Text: "hello", Color: "ff0000", Scale: 1.5},
+	}, cues)
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		title    string
+	}{
+		{input: "#00FF00", expected: "00ff00", title: "Hexadecimal"},
+		{input: "16711680", expected: "ff0000", title: "Decimal"},
+		{input: "0", expected: "", title: "Default"},
+		{input: "red", expected: "", title: "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			require.Equal(t, tt.expected, parseColor(tt.input))
+		})
+	}
+}
+
+func TestWriteSRT(t *testing.T) {
+	// Arrange
+	cues := []Cue{
+		{Offset: 1500 * time.Millisecond, Text: "world", Scale: 1},
+		{Offset: time.Hour + 10*time.Second, Text: "hello", Color: "ff0000", Scale: 1.5},
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := Write(&buf, cues, FormatSRT)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, `1
+00:00:01,500 --> 00:00:05,500
+world
+
+2
+01:00:10,000 --> 01:00:14,000
+<font color="#ff0000">hello</font>
+
+`, buf.String())
+}
+
+func TestTrack(t *testing.T) {
+	// Arrange
+	cues := []Cue{
+		{Offset: 1500 * time.Millisecond, Text: "world", Scale: 1},
+		{Offset: 10 * time.Second, Text: "{hello}", Color: "ff0000", Scale: 1.5},
+	}
+
+	// Act
+	header, events, err := Track(cues, FormatSRT)
+
+	// Assert
+	require.NoError(t, err)
+	require.Contains(t, header, "Style: Default,sans-serif,36,")
+	require.Equal(t, []Event{
+		{
+			Start: 1500 * time.Millisecond,
+			End:   5500 * time.Millisecond,
+			Style: "Default",
+			Text:  "world",
+		},
+		{
+			Start: 10 * time.Second,
+			End:   14 * time.Second,
+			Style: "Default",
+			Text:  `{\c&H0000ff&\fs54}｛hello｝`,
+		},
+	}, events)
+}
+
+func TestWriteASS(t *testing.T) {
+	// Arrange
+	cues := []Cue{
+		{Offset: 0, Text: "first", Scale: 1},
+		{Offset: 100 * time.Millisecond, Text: "second", Scale: 1},
+		{Offset: 10 * time.Second, Text: `{\pos(0,0)}third`, Color: "ff8000", Scale: 1},
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := Write(&buf, cues, FormatASS)
+
+	// Assert
+	require.NoError(t, err)
+	out := buf.String()
+	require.Contains(t, out, "PlayResX: 1280\n")
+	require.Contains(t, out, `Dialogue: 0,0:00:00.00,0:00:08.00,Danmaku,,0,0,0,,{\move(1280,0,-99,0)}first`)
+	// The second comment overlaps the first one, so it is in the next lane.
+	require.Contains(t, out, `Dialogue: 0,0:00:00.10,0:00:08.10,Danmaku,,0,0,0,,{\move(1280,43,-118,43)}second`)
+	// The first lane is free again. The color is in BGR and the tags are escaped.
+	require.Contains(t, out, `Dialogue: 0,0:00:10.00,0:00:18.00,Danmaku,,0,0,0,,{\move(1280,0,-316,0)\c&H0080ff&}｛＼pos(0,0)｝third`)
+}
+
+func TestConvertFile(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	input := filepath.Join(dir, "video.fc2chat.json")
+	output := filepath.Join(dir, "video.srt")
+	require.NoError(t, os.WriteFile(input, []byte(fixtureChat), 0o644))
+
+	// Act
+	err := ConvertFile(output, input, time.Unix(1700000000, 0), FormatSRT)
+
+	// Assert
+	require.NoError(t, err)
+	b, err := os.ReadFile(output)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), "1\n00:00:01,500 --> 00:00:05,500\n"))
+}
+
+func TestCommentTime(t *testing.T) {
+	// Act
+	seconds, errSeconds := CommentTime(api.Comment{Timestamp: "1700000000.5"})
+	millis, errMillis := CommentTime(api.Comment{Timestamp: "1700000000500"})
+
+	// Assert
+	require.NoError(t, errSeconds)
+	require.NoError(t, errMillis)
+	require.Equal(t, time.UnixMilli(1700000000500), seconds)
+	require.Equal(t, time.UnixMilli(1700000000500), millis)
+}
@@ -2,15 +2,16 @@
 package hls
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
@@ -23,10 +24,31 @@ import (
 
 const tracerName = "hls"
 
+const (
+	// fragmentRetryDelay is the delay between two tries of a fragment download.
+	fragmentRetryDelay = 500 * time.Millisecond
+	// defaultTargetDuration is used when the playlist has no target duration.
+	defaultTargetDuration = 2 * time.Second
+	// minPollInterval is the minimum delay between two playlist fetches.
+	minPollInterval = 500 * time.Millisecond
+	// defaultStallTimeout is the default value of WithStallTimeout.
+	defaultStallTimeout = 30 * time.Second
+)
+
 var (
 	timeZero = time.Unix(0, 0)
 	// ErrHLSForbidden is returned when the HLS download is stopped with a forbidden error.
 	ErrHLSForbidden = errors.New("hls download stopped with forbidden error")
+	// ErrStreamStalled is returned when the playlist could not be fetched for
+	// longer than the stall timeout, or failed more than the packet loss max,
+	// because of transient errors (timeouts, network errors, server errors).
+	//
+	// When the playlist is fetched but has no new fragment, the stream is
+	// considered ended and io.EOF is returned instead.
+	ErrStreamStalled = errors.New("hls stream stalled")
+
+	// errServerError is returned when the server fails with a 5xx status.
+	errServerError = errors.New("server error")
 )
 
 // Downloader is used to download HLS streams.
@@ -35,18 +57,100 @@ type Downloader struct {
 	packetLossMax int
 	log           *zerolog.Logger
 	url           string
+	opts          *Options
 
 	// ready is used to notify that the downloader is running.
 	// This is to avoid stressing the users with warning logs.
 	ready bool
 }
 
+// Option is the option for the HLS downloader.
+type Option func(*Options)
+
+// Options are the options for the HLS downloader.
+type Options struct {
+	onCheckpoint    func(Checkpoint)
+	concurrency     int
+	fragmentRetries int
+	stallTimeout    time.Duration
+	report          *Report
+	validate        bool
+}
+
+// WithCheckpointHandler calls the handler with the checkpoint of the last
+// fragment written, after each fragment.
+//
+// The handler is called from the download loop and should not block.
+func WithCheckpointHandler(handler func(Checkpoint)) Option {
+	return func(o *Options) {
+		o.onCheckpoint = handler
+	}
+}
+
+// WithConcurrency sets the number of fragments downloaded concurrently.
+//
+// The fragments are still written in the playlist order. (default: 1)
+func WithConcurrency(n int) Option {
+	return func(o *Options) {
+		o.concurrency = n
+	}
+}
+
+// WithFragmentRetries sets the number of retries of a fragment before
+// counting it as a packet loss. (default: 0)
+func WithFragmentRetries(n int) Option {
+	return func(o *Options) {
+		o.fragmentRetries = n
+	}
+}
+
+// WithStallTimeout sets the maximum duration without new fragment before
+// aborting the download. (default: 30s)
+func WithStallTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.stallTimeout = d
+	}
+}
+
+// WithReport records the written fragments and the gaps in the report.
+func WithReport(report *Report) Option {
+	return func(o *Options) {
+		o.report = report
+	}
+}
+
+// WithFragmentValidation checks that each fragment is a valid MPEG-TS stream
+// before writing it. Invalid fragments are retried, then counted as a packet
+// loss.
+func WithFragmentValidation() Option {
+	return func(o *Options) {
+		o.validate = true
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{
+		concurrency:  1,
+		stallTimeout: defaultStallTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.concurrency = max(o.concurrency, 1)
+	o.fragmentRetries = max(o.fragmentRetries, 0)
+	if o.stallTimeout <= 0 {
+		o.stallTimeout = defaultStallTimeout
+	}
+	return o
+}
+
 // NewDownloader creates a new HLS downloader.
 func NewDownloader(
 	client *http.Client,
 	log *zerolog.Logger,
 	packetLossMax int,
 	url string,
+	opts ...Option,
 ) *Downloader {
 
 	return &Downloader{
@@ -54,20 +158,32 @@ func NewDownloader(
 		packetLossMax: packetLossMax,
 		url:           url,
 		log:           log,
+		opts:          applyOptions(opts),
 	}
 }
 
 // GetFragmentURLs fetches the fragment URLs from the HLS manifest.
 func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]string, error) {
+	playlist, err := hls.GetPlaylist(ctx)
+	if err != nil {
+		return []string{}, err
+	}
+	return playlist.URLs(), nil
+}
+
+// GetPlaylist fetches and parses the HLS manifest.
+//
+// An empty playlist is returned if the stream is not ready.
+func (hls *Downloader) GetPlaylist(ctx context.Context) (*Playlist, error) {
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "GET", hls.url, nil)
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 	resp, err := hls.Do(req)
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -85,7 +201,7 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]string, error) {
 				Any("cookies", hls.Client.Jar.Cookies(url)).
 				Msg("http error")
 			metrics.Downloads.Errors.Add(ctx, 1)
-			return []string{}, ErrHLSForbidden
+			return nil, ErrHLSForbidden
 		case 404:
 			hls.log.Warn().
 				Str("url", url.String()).
@@ -94,7 +210,7 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]string, error) {
 				Str("method", "GET").
 				Any("cookies", hls.Client.Jar.Cookies(url)).
 				Msg("stream not ready")
-			return []string{}, nil
+			return &Playlist{}, nil
 		default:
 			hls.log.Error().
 				Str("url", url.String()).
@@ -104,42 +220,40 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]string, error) {
 				Any("cookies", hls.Client.Jar.Cookies(url)).
 				Msg("http error")
 			metrics.Downloads.Errors.Add(ctx, 1)
-			return []string{}, errors.New("http error")
+			if resp.StatusCode >= 500 {
+				return nil, fmt.Errorf("http error %d: %w", resp.StatusCode, errServerError)
+			}
+			return nil, fmt.Errorf("http error %d", resp.StatusCode)
 		}
 	}
 
-	scanner := bufio.NewScanner(resp.Body)
-	urls := make([]string, 0, 10)
-	exists := make(map[string]bool) // Avoid duplicates
-
-	// URLs are supposedly sorted.
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if len(line) > 0 && line[0] != '#' && !exists[line] {
-			_, err := url.Parse(line)
-			if err != nil {
-				hls.log.Warn().
-					Err(err).
-					Msg("m3u8 returned a bad url, skipping that line")
-				continue
-			}
-			urls = append(urls, line)
-			exists[line] = true
-		}
+	base, _ := url.Parse(hls.url)
+	playlist, err := ParsePlaylist(resp.Body, base)
+	if err != nil {
+		hls.log.Error().
+			Err(err).
+			Str("url", hls.url).
+			Msg("failed to parse the m3u8 playlist")
+		return nil, err
 	}
 
 	if !hls.ready {
 		hls.ready = true
 		hls.log.Info().Msg("downloading")
 	}
-	return urls, nil
+	return playlist, nil
 }
 
 // Checkpoint is used to resume the download from the last fragment.
+//
+// The download is resumed by media sequence number if the playlist has one.
+// Otherwise, the fragments are sorted by time, then by name.
 type Checkpoint struct {
 	LastFragmentName    string
 	LastFragmentTime    time.Time
 	UseTimeBasedSorting bool
+	LastMediaSequence   int64
+	UseMediaSequence    bool
 }
 
 // DefaultCheckpoint returns a default checkpoint.
@@ -148,13 +262,43 @@ func DefaultCheckpoint() Checkpoint {
 		LastFragmentName:    "",
 		LastFragmentTime:    timeZero,
 		UseTimeBasedSorting: true,
+		LastMediaSequence:   0,
+		UseMediaSequence:    false,
+	}
+}
+
+// advance returns the checkpoint after the segment.
+//
+// Like fillQueue, it falls back to name-based sorting if the time of the
+// fragment is invalid.
+func (cp Checkpoint) advance(s Segment) (Checkpoint, error) {
+	parsed, err := url.Parse(s.URL)
+	if err != nil {
+		return cp, err
+	}
+	cp.LastFragmentName = filepath.Base(parsed.Path)
+	cp.UseMediaSequence = s.SequenceNumber >= 0
+	if cp.UseMediaSequence {
+		cp.LastMediaSequence = s.SequenceNumber
+	}
+	if cp.UseTimeBasedSorting {
+		tsI, err := strconv.ParseInt(parsed.Query().Get("time"), 10, 64)
+		if err != nil {
+			cp.UseTimeBasedSorting = false
+		} else {
+			cp.LastFragmentTime = time.Unix(tsI, 0)
+		}
 	}
+	return cp, nil
 }
 
-// fillQueue continuously fetches fragments url until stream end.
+// fillQueue continuously fetches the segments until stream end.
+//
+// The SequenceNumber of the segments is -1 if the playlist has no media
+// sequence.
 func (hls *Downloader) fillQueue(
 	ctx context.Context,
-	urlChan chan<- string,
+	segmentChan chan<- Segment,
 	checkpoint Checkpoint,
 ) (newCheckpoint Checkpoint, err error) {
 	hls.log.Debug().Msg("started to fill queue")
@@ -162,6 +306,9 @@ func (hls *Downloader) fillQueue(
 		attribute.String("last_fragment_name", checkpoint.LastFragmentName),
 		attribute.String("last_fragment_time", checkpoint.LastFragmentTime.String()),
 		attribute.Bool("use_time_based_sorting", checkpoint.UseTimeBasedSorting),
+		attribute.Int64("last_media_sequence", checkpoint.LastMediaSequence),
+		attribute.Bool("use_media_sequence", checkpoint.UseMediaSequence),
+		attribute.String("stall_timeout", hls.opts.stallTimeout.String()),
 	))
 	defer span.End()
 
@@ -172,12 +319,25 @@ func (hls *Downloader) fillQueue(
 	lastFragmentName := checkpoint.LastFragmentName
 	lastFragmentTime := checkpoint.LastFragmentTime
 	useTimeBasedSorting := checkpoint.UseTimeBasedSorting
+	lastMediaSequence := checkpoint.LastMediaSequence
+	useMediaSequence := checkpoint.UseMediaSequence
+
+	currentCheckpoint := func() Checkpoint {
+		return Checkpoint{
+			LastFragmentName:    lastFragmentName,
+			LastFragmentTime:    lastFragmentTime,
+			UseTimeBasedSorting: useTimeBasedSorting,
+			LastMediaSequence:   lastMediaSequence,
+			UseMediaSequence:    useMediaSequence,
+		}
+	}
 
 	// Create a new ticker to log every 10 second
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	errorCount := 0
+	var pollInterval, targetDuration time.Duration
 
 	for {
 		select {
@@ -187,43 +347,83 @@ func (hls *Downloader) fillQueue(
 			// Do nothing if the ticker hasn't ticked yet
 		}
 
-		urls, err := hls.GetFragmentURLs(ctx)
+		playlist, err := hls.GetPlaylist(ctx)
 		if err != nil {
 			span.RecordError(err)
-			// Failed to fetch playlist in time
-			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNRESET) {
-				errorCount++
-				hls.log.Error().
-					Int("error.count", errorCount).
-					Int("error.max", hls.packetLossMax).
-					Err(err).
-					Msg("a playlist failed to be downloaded, retrying")
-				metrics.Downloads.Errors.Add(ctx, 1)
-
-				// Ignore the error if tolerated
-				if errorCount <= hls.packetLossMax {
-					time.Sleep(time.Second)
-					continue
-				}
-			}
 			// fillQueue will exits here because of a stream ended with a HLSErrorForbidden
 			// It can also exit here on context cancelled
-			return Checkpoint{
-				LastFragmentName:    lastFragmentName,
-				LastFragmentTime:    lastFragmentTime,
-				UseTimeBasedSorting: useTimeBasedSorting,
-			}, err
+			if ctx.Err() != nil || !isTransient(err) {
+				return currentCheckpoint(), err
+			}
+
+			errorCount++
+			hls.log.Error().
+				Int("error.count", errorCount).
+				Int("error.max", hls.packetLossMax).
+				Err(err).
+				Msg("a playlist failed to be downloaded, retrying")
+			metrics.Downloads.Errors.Add(ctx, 1)
+
+			if time.Since(lastFragmentReceivedTimestamp) > hls.opts.stallTimeout {
+				hls.log.Warn().
+					Time("lastTime", lastFragmentReceivedTimestamp).
+					Msg("timeout fetching the playlist, abort")
+				return currentCheckpoint(), errors.Join(ErrStreamStalled, err)
+			}
+			if errorCount > hls.packetLossMax {
+				hls.log.Warn().Msg("too many playlist errors, abort")
+				return currentCheckpoint(), errors.Join(ErrStreamStalled, err)
+			}
+
+			// Back off as if the playlist had no new fragment.
+			pollInterval = nextPollInterval(targetDuration, pollInterval, false)
+			select {
+			case <-time.After(pollInterval):
+				continue
+			case <-ctx.Done():
+				return currentCheckpoint(), ctx.Err()
+			}
 		}
+		targetDuration = playlist.TargetDuration
+		segments := playlist.Segments
 
 		newIdx := 0
+		switch {
+		// Find the last fragment by media sequence number to resume download.
+		case useMediaSequence && playlist.HasMediaSequence &&
+			playlist.LastSequenceNumber() >= lastMediaSequence:
+			newIdx = len(segments)
+			for i, s := range segments {
+				if s.SequenceNumber > lastMediaSequence {
+					newIdx = i
+					break
+				}
+			}
+			if newIdx < len(segments) && segments[newIdx].SequenceNumber > lastMediaSequence+1 {
+				first, last := lastMediaSequence+1, segments[newIdx].SequenceNumber-1
+				hls.log.Warn().
+					Int64("first", first).
+					Int64("last", last).
+					Msg("fragments left the playlist before being fetched")
+				if hls.opts.report != nil {
+					hls.opts.report.addSequenceGap(first, last)
+				}
+			}
+
 		// Find the last fragment url to resume download
-		if lastFragmentName != "" &&
-			((useTimeBasedSorting && !lastFragmentTime.Equal(timeZero)) || !useTimeBasedSorting) {
-			for i, u := range urls {
-				parsed, err := url.Parse(u)
+		case lastFragmentName != "" &&
+			((useTimeBasedSorting && !lastFragmentTime.Equal(timeZero)) || !useTimeBasedSorting):
+			if useMediaSequence && playlist.HasMediaSequence {
+				hls.log.Warn().
+					Int64("lastMediaSequence", lastMediaSequence).
+					Int64("mediaSequence", playlist.MediaSequence).
+					Msg("media sequence went backwards, fragments will be sorted by time and name")
+			}
+			for i, s := range segments {
+				parsed, err := url.Parse(s.URL)
 				if err != nil {
 					hls.log.Err(err).
-						Str("url", u).
+						Str("url", s.URL).
 						Msg("failed to parse fragment URL when checking for last fragment, skipping")
 					continue
 				}
@@ -233,7 +433,7 @@ func (hls *Downloader) fillQueue(
 					tsI, err := strconv.ParseInt(parsed.Query().Get("time"), 10, 64)
 					if err != nil {
 						hls.log.Err(err).
-							Str("url", u).
+							Str("url", s.URL).
 							Msg("failed to parse fragment URL, time is invalid, fragment will now be sorted by name")
 						useTimeBasedSorting = false
 					} else {
@@ -248,17 +448,17 @@ func (hls *Downloader) fillQueue(
 			}
 		}
 
-		nNew := len(urls) - newIdx
+		nNew := len(segments) - newIdx
 		if nNew > 0 {
 			lastFragmentReceivedTimestamp = time.Now()
-			hls.log.Trace().Strs("urls", urls[newIdx:]).Msg("found new fragments")
+			hls.log.Trace().Int("count", nNew).Msg("found new fragments")
 		}
 
-		for _, u := range urls[newIdx:] {
-			parsed, err := url.Parse(u)
+		for _, s := range segments[newIdx:] {
+			parsed, err := url.Parse(s.URL)
 			if err != nil {
 				hls.log.Err(err).
-					Str("url", u).
+					Str("url", s.URL).
 					Msg("failed to parse fragment URL, skipping")
 				continue
 			}
@@ -267,32 +467,77 @@ func (hls *Downloader) fillQueue(
 				tsI, err := strconv.ParseInt(parsed.Query().Get("time"), 10, 64)
 				if err != nil {
 					hls.log.Err(err).
-						Str("url", u).
+						Str("url", s.URL).
 						Msg("failed to parse fragment URL, time is invalid, fragment will now be sorted by name")
 					useTimeBasedSorting = false
 				} else {
 					lastFragmentTime = time.Unix(tsI, 0)
 				}
 			}
-			urlChan <- u
+			useMediaSequence = playlist.HasMediaSequence
+			if useMediaSequence {
+				lastMediaSequence = s.SequenceNumber
+			} else {
+				s.SequenceNumber = -1
+			}
+			segmentChan <- s
+		}
+
+		// fillQueue will exit here if the playlist is complete.
+		if playlist.EndList {
+			hls.log.Info().Msg("playlist has ended")
+			return currentCheckpoint(), io.EOF
 		}
 
 		// fillQueue will also exit here if the stream has ended (and do not send any fragment)
-		if time.Since(lastFragmentReceivedTimestamp) > 30*time.Second {
+		if time.Since(lastFragmentReceivedTimestamp) > hls.opts.stallTimeout {
 			hls.log.Warn().
 				Time("lastTime", lastFragmentReceivedTimestamp).
 				Msg("timeout receiving new fragments, abort")
-			return Checkpoint{
-				LastFragmentName:    lastFragmentName,
-				LastFragmentTime:    lastFragmentTime,
-				UseTimeBasedSorting: useTimeBasedSorting,
-			}, io.EOF
+			return currentCheckpoint(), io.EOF
 		}
 
-		time.Sleep(time.Second)
+		pollInterval = nextPollInterval(playlist.TargetDuration, pollInterval, nNew > 0)
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return currentCheckpoint(), ctx.Err()
+		}
 	}
 }
 
+// isTransient returns true if the playlist may be fetched on the next try: the
+// request timed out, the network failed or the server failed.
+func isTransient(err error) bool {
+	var netErr net.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrInvalidPlaylist) ||
+		errors.Is(err, errServerError) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr)
+}
+
+// nextPollInterval returns the delay before the next playlist fetch.
+//
+// The playlist is polled at half the target duration. If there was no new
+// fragment, the delay is doubled, up to twice the target duration.
+func nextPollInterval(targetDuration time.Duration, previous time.Duration, hasNew bool) time.Duration {
+	if targetDuration <= 0 {
+		targetDuration = defaultTargetDuration
+	}
+	interval := max(targetDuration/2, minPollInterval)
+	if !hasNew && previous > 0 {
+		interval = min(max(previous*2, interval), max(2*targetDuration, minPollInterval))
+	}
+	return interval
+}
+
 func (hls *Downloader) download(
 	ctx context.Context,
 	w io.Writer,
@@ -332,14 +577,93 @@ func (hls *Downloader) download(
 	return err
 }
 
+// fragment is a fragment downloaded in the background.
+type fragment struct {
+	Segment
+	buf bytes.Buffer
+	err error
+	// done is closed when the download is finished.
+	done chan struct{}
+	// acquired is true if the fragment holds a download slot.
+	acquired bool
+}
+
+// downloadFragment downloads the fragment into its buffer, with retries.
+func (hls *Downloader) downloadFragment(ctx context.Context, f *fragment) error {
+	var err error
+	for try := 0; try <= hls.opts.fragmentRetries; try++ {
+		if try > 0 {
+			hls.log.Warn().
+				Int("try", try).
+				Int("retries", hls.opts.fragmentRetries).
+				Err(err).
+				Str("url", f.URL).
+				Msg("a fragment failed to be downloaded, retrying")
+			select {
+			case <-time.After(fragmentRetryDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		f.buf.Reset()
+		err = hls.download(ctx, &f.buf, f.URL)
+		if err == nil && hls.opts.validate {
+			err = validateFragment(f.buf.Bytes())
+		}
+		if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrHLSForbidden) {
+			return err
+		}
+	}
+	return err
+}
+
+// fetchFragments starts the download of the segments from the segmentChan and
+// sends them in the playlist order.
+//
+// At most cap(slots) fragments are downloaded or waiting to be written. The
+// receiver must release the slot of each fragment. The returned channel is
+// closed when segmentChan is closed.
+func (hls *Downloader) fetchFragments(
+	ctx context.Context,
+	segmentChan <-chan Segment,
+	slots chan struct{},
+) <-chan *fragment {
+	fragments := make(chan *fragment, cap(slots))
+	go func() {
+		defer close(fragments)
+		for s := range segmentChan {
+			f := &fragment{
+				Segment: s,
+				done:    make(chan struct{}),
+			}
+			select {
+			case slots <- struct{}{}:
+				f.acquired = true
+				go func() {
+					defer close(f.done)
+					f.err = hls.downloadFragment(ctx, f)
+				}()
+			case <-ctx.Done():
+				// Keep receiving the segments until fillQueue exits.
+				f.err = ctx.Err()
+				close(f.done)
+			}
+			fragments <- f
+		}
+	}()
+	return fragments
+}
+
 // Read reads the HLS stream and sends the data to the writer.
 //
-// Read runs two threads:
+// Read runs three threads:
 //
-//  1. A goroutine will continuously fetch the fragment URLs and send them to the urlsChan.
-//  2. The main thread will download the fragments and write them to the writer.
+//  1. A goroutine will continuously fetch the playlist and send the new segments to the segmentChan.
+//  2. A goroutine will download the fragments concurrently (see WithConcurrency).
+//  3. The main thread will write the fragments to the writer, in the playlist order.
 //
-// The function will return when the context is canceled or when the stream ends.
+// The function will return when the context is canceled or when the stream ends,
+// with the checkpoint of the last fragment written.
 func (hls *Downloader) Read(
 	ctx context.Context,
 	writer io.Writer,
@@ -350,81 +674,100 @@ func (hls *Downloader) Read(
 		attribute.String("last_fragment_name", checkpoint.LastFragmentName),
 		attribute.String("last_fragment_time", checkpoint.LastFragmentTime.String()),
 		attribute.Bool("use_time_based_sorting", checkpoint.UseTimeBasedSorting),
+		attribute.Int("concurrency", hls.opts.concurrency),
 	))
 	defer span.End()
 
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	errChan := make(chan error) // Blocking channel is used to wait for fillQueue to finish.
-	defer close(errChan)
-
-	checkpointChan := make(chan Checkpoint, 1)
-	defer close(checkpointChan)
+	resultChan := make(chan error, 1)
 
-	urlsChan := make(chan string, 10)
-	defer close(urlsChan)
+	segmentChan := make(chan Segment, 10)
 
 	go func() {
-		newCheckpoint, err := hls.fillQueue(ctx, urlsChan, checkpoint)
-		errChan <- err
-		checkpointChan <- newCheckpoint
+		_, err := hls.fillQueue(ctx, segmentChan, checkpoint)
+		// fillQueue is the only sender.
+		close(segmentChan)
+		resultChan <- err
 	}()
 
+	slots := make(chan struct{}, hls.opts.concurrency)
+	fragments := hls.fetchFragments(ctx, segmentChan, slots)
+
 	errorCount := 0
 
-	for {
-		select {
-		case url := <-urlsChan:
-			err := hls.download(ctx, writer, url)
-			if err != nil {
-				if errors.Is(err, context.Canceled) {
-					hls.log.Info().Msg("skip fragment download because of context canceled")
-					continue // Continue to wait for fillQueue to finish
-				}
-				span.RecordError(err)
-				if errors.Is(err, ErrHLSForbidden) {
-					hls.log.Error().Err(err).Msg("stream was interrupted")
-					cancel()
-					continue // Continue to wait for fillQueue to finish
-				}
-				errorCount++
-				hls.log.Error().
-					Int("error.count", errorCount).
-					Int("error.max", hls.packetLossMax).
-					Err(err).
-					Msg("a packet failed to be downloaded, skipping")
-				metrics.Downloads.Errors.Add(ctx, 1)
-				if errorCount <= hls.packetLossMax {
-					continue
-				}
-				cancel()
-				continue // Continue to wait for fillQueue to finish
-			}
+	// Checkpoint of the last fragment written.
+	written := checkpoint
 
-		// fillQueue will exit here if the stream has ended or context is canceled.
-		case err := <-errChan:
-			defer cancel()
-			if err == nil {
-				hls.log.Panic().Msg("didn't expect a nil error")
-			}
+	// The fragments are received until fillQueue exits, even after cancel.
+	for f := range fragments {
+		<-f.done
+		err := f.err
+		if err == nil {
+			_, err = f.buf.WriteTo(writer)
+		}
+		if f.acquired {
+			<-slots
+		}
 
-			if errors.Is(err, io.EOF) {
-				hls.log.Info().Msg("hls downloader exited with success")
-			} else if errors.Is(err, context.Canceled) {
-				hls.log.Info().Msg("hls downloader canceled")
-			} else {
-				hls.log.Error().Err(err).Msg("hls downloader exited with error")
+		if err == nil {
+			if hls.opts.report != nil {
+				hls.opts.report.addFragment()
 			}
-
-			select {
-			case cp := <-checkpointChan:
-				return cp, err
-			case <-time.After(1 * time.Second):
-				hls.log.Error().Msg("no checkpoint")
-				return DefaultCheckpoint(), err
+			cp, err := written.advance(f.Segment)
+			if err != nil {
+				hls.log.Err(err).Str("url", f.URL).Msg("failed to compute the checkpoint of the fragment")
+				continue
 			}
+			written = cp
+			if hls.opts.onCheckpoint != nil {
+				hls.opts.onCheckpoint(written)
+			}
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			hls.log.Info().Msg("skip fragment download because of context canceled")
+			continue // Continue to wait for fillQueue to finish
 		}
+		span.RecordError(err)
+		if errors.Is(err, ErrHLSForbidden) {
+			hls.log.Error().Err(err).Msg("stream was interrupted")
+			cancel()
+			continue // Continue to wait for fillQueue to finish
+		}
+		errorCount++
+		hls.log.Error().
+			Int("error.count", errorCount).
+			Int("error.max", hls.packetLossMax).
+			Err(err).
+			Msg("a packet failed to be downloaded, skipping")
+		metrics.Downloads.Errors.Add(ctx, 1)
+		if hls.opts.report != nil {
+			hls.opts.report.addFailedFragment(f.URL, err)
+		}
+		if errorCount <= hls.packetLossMax {
+			continue
+		}
+		cancel()
+	}
+
+	// fillQueue exited because the stream has ended or context is canceled.
+	err = <-resultChan
+	if err == nil {
+		hls.log.Panic().Msg("didn't expect a nil error")
+	}
+
+	if errors.Is(err, io.EOF) {
+		hls.log.Info().Msg("hls downloader exited with success")
+	} else if errors.Is(err, context.Canceled) {
+		hls.log.Info().Msg("hls downloader canceled")
+	} else {
+		hls.log.Error().Err(err).Msg("hls downloader exited with error")
 	}
+	// The checkpoint of fillQueue includes the fragments which were queued
+	// but not written.
+	return written, err
 }
 
 // Probe checks if the stream is ready to be downloaded.
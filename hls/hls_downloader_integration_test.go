@@ -76,7 +76,7 @@ func (suite *DownloaderContractTestSuite) BeforeTest(suiteName, testName string)
 	suite.Require().NoError(err)
 
 	go func() {
-		err := suite.ws.Listen(suite.ctx, suite.conn, suite.msgChan, nil)
+		err := suite.ws.Listen(suite.ctx, suite.conn, suite.msgChan, nil, nil)
 		suite.Require().Error(err, context.Canceled.Error())
 	}()
 
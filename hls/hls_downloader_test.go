@@ -1,15 +1,25 @@
 package hls
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	_ "embed"
 
 	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -158,14 +168,14 @@ func (suite *DownloaderTestSuite) TestGetFragmentURLs() {
 func (suite *DownloaderTestSuite) TestFillQueue() {
 	// Arrange
 	urls := make([]string, 0, 11)
-	urlsChan := make(chan string)
+	segmentChan := make(chan Segment)
 	ctx, cancel := context.WithCancel(context.Background())
 	lastCheckpoint := make(chan Checkpoint, 1)
 	errChan := make(chan error, 1)
 
 	// Act
 	go func() {
-		cp, err := suite.impl.fillQueue(ctx, urlsChan, DefaultCheckpoint())
+		cp, err := suite.impl.fillQueue(ctx, segmentChan, DefaultCheckpoint())
 		lastCheckpoint <- cp
 		errChan <- err
 	}()
@@ -173,8 +183,8 @@ func (suite *DownloaderTestSuite) TestFillQueue() {
 loop:
 	for {
 		select {
-		case url := <-urlsChan:
-			urls = append(urls, url)
+		case s := <-segmentChan:
+			urls = append(urls, s.URL)
 		case <-time.After(5 * time.Second):
 			cancel()
 			break loop
@@ -189,6 +199,8 @@ loop:
 		LastFragmentName:    "118618.ts",
 		LastFragmentTime:    time.Unix(1699894113, 0),
 		UseTimeBasedSorting: true,
+		LastMediaSequence:   118618,
+		UseMediaSequence:    true,
 	}, cp)
 	suite.Equal(combinedExpectedURLs, urls)
 }
@@ -196,14 +208,14 @@ loop:
 func (suite *DownloaderTestSuite) TestFillQueueAtCheckpoint() {
 	// Arrange
 	urls := make([]string, 0, 11)
-	urlsChan := make(chan string)
+	segmentChan := make(chan Segment)
 	ctx, cancel := context.WithCancel(context.Background())
 	lastCheckpoint := make(chan Checkpoint, 1)
 	errChan := make(chan error, 1)
 
 	// Act
 	go func() {
-		cp, err := suite.impl.fillQueue(ctx, urlsChan, Checkpoint{
+		cp, err := suite.impl.fillQueue(ctx, segmentChan, Checkpoint{
 			LastFragmentName:    "118617.ts",
 			LastFragmentTime:    time.Unix(1699894112, 0),
 			UseTimeBasedSorting: true,
@@ -215,8 +227,8 @@ func (suite *DownloaderTestSuite) TestFillQueueAtCheckpoint() {
 loop:
 	for {
 		select {
-		case url := <-urlsChan:
-			urls = append(urls, url)
+		case s := <-segmentChan:
+			urls = append(urls, s.URL)
 		case <-time.After(5 * time.Second):
 			cancel()
 			break loop
@@ -231,10 +243,66 @@ loop:
 		LastFragmentName:    "118618.ts",
 		LastFragmentTime:    time.Unix(1699894113, 0),
 		UseTimeBasedSorting: true,
+		LastMediaSequence:   118618,
+		UseMediaSequence:    true,
 	}, cp)
 	suite.Equal(combinedExpectedURLs[len(combinedExpectedURLs)-1:], urls)
 }
 
+func (suite *DownloaderTestSuite) TestFillQueueAtMediaSequence() {
+	// Arrange
+	urls := make([]string, 0, 11)
+	segmentChan := make(chan Segment)
+	ctx, cancel := context.WithCancel(context.Background())
+	lastCheckpoint := make(chan Checkpoint, 1)
+	errChan := make(chan error, 1)
+
+	// Act
+	go func() {
+		cp, err := suite.impl.fillQueue(ctx, segmentChan, Checkpoint{
+			LastMediaSequence: 118616,
+			UseMediaSequence:  true,
+		})
+		lastCheckpoint <- cp
+		errChan <- err
+	}()
+
+loop:
+	for {
+		select {
+		case s := <-segmentChan:
+			urls = append(urls, s.URL)
+		case <-time.After(5 * time.Second):
+			cancel()
+			break loop
+		}
+	}
+
+	// Assert
+	cp := <-lastCheckpoint
+	err := <-errChan
+	suite.Error(context.Canceled, err)
+	suite.Equal(int64(118618), cp.LastMediaSequence)
+	suite.Equal(combinedExpectedURLs[len(combinedExpectedURLs)-2:], urls)
+}
+
+func (suite *DownloaderTestSuite) TestCheckpointAdvance() {
+	// Act
+	cp, err := DefaultCheckpoint().advance(Segment{URL: combinedExpectedURLs[0], SequenceNumber: 118606})
+	suite.Require().NoError(err)
+	cp, err = cp.advance(Segment{URL: expectedURLs1NoTS[1], SequenceNumber: -1})
+
+	// Assert
+	suite.NoError(err)
+	suite.Equal(Checkpoint{
+		LastFragmentName:    "118607.ts",
+		LastFragmentTime:    time.Unix(1699894101, 0),
+		UseTimeBasedSorting: false,
+		LastMediaSequence:   118606,
+		UseMediaSequence:    false,
+	}, cp)
+}
+
 func (suite *DownloaderTestSuite) AfterTest(_, _ string) {
 	suite.server.Close()
 }
@@ -280,14 +348,14 @@ func (suite *DownloaderTestSuiteNoTS) TestGetFragmentURLs() {
 func (suite *DownloaderTestSuiteNoTS) TestFillQueue() {
 	// Arrange
 	urls := make([]string, 0, 11)
-	urlsChan := make(chan string)
+	segmentChan := make(chan Segment)
 	ctx, cancel := context.WithCancel(context.Background())
 	checkpointChan := make(chan Checkpoint, 1)
 	errChan := make(chan error, 1)
 
 	// Act
 	go func() {
-		cp, err := suite.impl.fillQueue(ctx, urlsChan, DefaultCheckpoint())
+		cp, err := suite.impl.fillQueue(ctx, segmentChan, DefaultCheckpoint())
 		checkpointChan <- cp
 		errChan <- err
 	}()
@@ -295,8 +363,8 @@ func (suite *DownloaderTestSuiteNoTS) TestFillQueue() {
 loop:
 	for {
 		select {
-		case url := <-urlsChan:
-			urls = append(urls, url)
+		case s := <-segmentChan:
+			urls = append(urls, s.URL)
 		case <-time.After(5 * time.Second):
 			cancel()
 			break loop
@@ -311,6 +379,8 @@ loop:
 		LastFragmentName:    "118618.ts",
 		LastFragmentTime:    time.Unix(0, 0),
 		UseTimeBasedSorting: false,
+		LastMediaSequence:   118618,
+		UseMediaSequence:    true,
 	}, cp)
 	suite.Equal(combinedExpectedURLsNoTS, urls)
 }
@@ -319,6 +389,313 @@ func (suite *DownloaderTestSuiteNoTS) AfterTest(_, _ string) {
 	suite.server.Close()
 }
 
+func TestFetchFragments(t *testing.T) {
+	// Arrange
+	var mu sync.Mutex
+	tries := make(map[string]int)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			tries[req.URL.Path]++
+			try := tries[req.URL.Path]
+			mu.Unlock()
+			switch req.URL.Path {
+			case "/0.ts":
+				// The first fragment is the slowest.
+				time.Sleep(200 * time.Millisecond)
+			case "/2.ts":
+				if try <= 2 {
+					res.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+			_, _ = res.Write([]byte(req.URL.Path))
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		server.Client(),
+		&log.Logger,
+		10,
+		server.URL,
+		WithConcurrency(4),
+		WithFragmentRetries(2),
+	)
+	segmentChan := make(chan Segment, 6)
+	for i := range 6 {
+		segmentChan <- Segment{URL: fmt.Sprintf("%s/%d.ts", server.URL, i)}
+	}
+	close(segmentChan)
+	slots := make(chan struct{}, 4)
+
+	// Act
+	var got []string
+	for f := range impl.fetchFragments(context.Background(), segmentChan, slots) {
+		<-f.done
+		require.NoError(t, f.err)
+		got = append(got, f.buf.String())
+		<-slots
+	}
+
+	// Assert
+	require.Equal(t, []string{"/0.ts", "/1.ts", "/2.ts", "/3.ts", "/4.ts", "/5.ts"}, got)
+	require.Equal(t, 3, tries["/2.ts"])
+}
+
+func TestFillQueueInvalidPlaylist(t *testing.T) {
+	tests := []struct {
+		title         string
+		packetLossMax int
+		expected      error
+	}{
+		{
+			title:         "Tolerated",
+			packetLossMax: 1,
+			expected:      io.EOF,
+		},
+		{
+			title:         "Not tolerated",
+			packetLossMax: 0,
+			expected:      ErrInvalidPlaylist,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			var counter atomic.Int32
+			server := httptest.NewServer(
+				http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+					// The first response is empty.
+					if counter.Add(1) == 1 {
+						return
+					}
+					_, _ = res.Write([]byte("#EXTM3U\n#EXTINF:1,\n0.ts\n#EXT-X-ENDLIST\n"))
+				}),
+			)
+			defer server.Close()
+			impl := NewDownloader(server.Client(), &log.Logger, tt.packetLossMax, server.URL)
+			segmentChan := make(chan Segment, 1)
+
+			// Act
+			_, err := impl.fillQueue(context.Background(), segmentChan, DefaultCheckpoint())
+
+			// Assert
+			require.ErrorIs(t, err, tt.expected)
+			if tt.expected == io.EOF {
+				require.Len(t, segmentChan, 1)
+			}
+		})
+	}
+}
+
+func TestFillQueueTransientError(t *testing.T) {
+	tests := []struct {
+		title         string
+		status        int
+		packetLossMax int
+		expected      error
+		isStalled     bool
+	}{
+		{
+			title:         "Server error tolerated",
+			status:        http.StatusServiceUnavailable,
+			packetLossMax: 1,
+			expected:      io.EOF,
+		},
+		{
+			title:         "Server error not tolerated",
+			status:        http.StatusServiceUnavailable,
+			packetLossMax: 0,
+			isStalled:     true,
+		},
+		{
+			title:         "Client error",
+			status:        http.StatusBadRequest,
+			packetLossMax: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			var counter atomic.Int32
+			server := httptest.NewServer(
+				http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+					// The first request fails.
+					if counter.Add(1) == 1 {
+						res.WriteHeader(tt.status)
+						return
+					}
+					_, _ = res.Write([]byte("#EXTM3U\n#EXTINF:1,\n0.ts\n#EXT-X-ENDLIST\n"))
+				}),
+			)
+			defer server.Close()
+			client := server.Client()
+			client.Jar, _ = cookiejar.New(nil)
+			impl := NewDownloader(client, &log.Logger, tt.packetLossMax, server.URL)
+			segmentChan := make(chan Segment, 1)
+
+			// Act
+			_, err := impl.fillQueue(context.Background(), segmentChan, DefaultCheckpoint())
+
+			// Assert
+			switch {
+			case tt.expected != nil:
+				require.ErrorIs(t, err, tt.expected)
+			case tt.isStalled:
+				require.ErrorIs(t, err, ErrStreamStalled)
+			default:
+				require.Error(t, err)
+				require.NotErrorIs(t, err, ErrStreamStalled)
+				require.EqualValues(t, 1, counter.Load())
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		title    string
+		err      error
+		expected bool
+	}{
+		{
+			title:    "Timeout",
+			err:      context.DeadlineExceeded,
+			expected: true,
+		},
+		{
+			title:    "Connection refused",
+			err:      &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+			expected: true,
+		},
+		{
+			title:    "DNS error",
+			err:      &url.Error{Op: "Get", Err: &net.DNSError{Err: "no such host", IsNotFound: true}},
+			expected: true,
+		},
+		{
+			title:    "Server error",
+			err:      fmt.Errorf("http error 502: %w", errServerError),
+			expected: true,
+		},
+		{
+			title:    "Forbidden",
+			err:      ErrHLSForbidden,
+			expected: false,
+		},
+		{
+			title:    "Canceled",
+			err:      context.Canceled,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Act
+			actual := isTransient(tt.err)
+
+			// Assert
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestReadCanceledMidFetch(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/0.ts":
+				_, _ = res.Write([]byte("0"))
+			case "/1.ts", "/2.ts":
+				// The download is canceled before these fragments are fetched.
+				<-req.Context().Done()
+			default:
+				_, _ = res.Write([]byte(
+					"#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:100\n#EXTINF:1,\n0.ts\n#EXTINF:1,\n1.ts\n#EXTINF:1,\n2.ts\n",
+				))
+			}
+		}),
+	)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	impl := NewDownloader(
+		server.Client(),
+		&log.Logger,
+		10,
+		server.URL+"/playlist.m3u8",
+		WithCheckpointHandler(func(Checkpoint) { cancel() }),
+	)
+	var buf bytes.Buffer
+
+	// Act
+	cp, err := impl.Read(ctx, &buf, DefaultCheckpoint())
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, "0", buf.String())
+	require.Equal(t, "0.ts", cp.LastFragmentName)
+	require.Equal(t, int64(100), cp.LastMediaSequence)
+	require.True(t, cp.UseMediaSequence)
+}
+
+func TestNextPollInterval(t *testing.T) {
+	tests := []struct {
+		title          string
+		targetDuration time.Duration
+		previous       time.Duration
+		hasNew         bool
+		expected       time.Duration
+	}{
+		{
+			title:          "Half of the target duration",
+			targetDuration: 4 * time.Second,
+			hasNew:         true,
+			expected:       2 * time.Second,
+		},
+		{
+			title:    "No target duration",
+			hasNew:   true,
+			expected: time.Second,
+		},
+		{
+			title:          "Minimum interval",
+			targetDuration: 500 * time.Millisecond,
+			hasNew:         true,
+			expected:       minPollInterval,
+		},
+		{
+			title:          "Back off",
+			targetDuration: 4 * time.Second,
+			previous:       2 * time.Second,
+			expected:       4 * time.Second,
+		},
+		{
+			title:          "Back off is capped",
+			targetDuration: 4 * time.Second,
+			previous:       8 * time.Second,
+			expected:       8 * time.Second,
+		},
+		{
+			title:          "Reset after new fragments",
+			targetDuration: 4 * time.Second,
+			previous:       8 * time.Second,
+			hasNew:         true,
+			expected:       2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			require.Equal(t, tt.expected, nextPollInterval(tt.targetDuration, tt.previous, tt.hasNew))
+		})
+	}
+}
+
 func TestDownloaderTestSuite(t *testing.T) {
 	suite.Run(t, &DownloaderTestSuite{})
 	suite.Run(t, &DownloaderTestSuiteNoTS{})
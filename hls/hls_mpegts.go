@@ -0,0 +1,86 @@
+package hls
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// tsPacketSize is the size of a MPEG-TS packet.
+	tsPacketSize = 188
+	// tsSyncByte is the first byte of each MPEG-TS packet.
+	tsSyncByte = 0x47
+	// tsNullPID is the PID of the null packets, which have no continuity.
+	tsNullPID = 0x1fff
+)
+
+// ErrInvalidFragment is returned when a fragment is not a valid MPEG-TS
+// stream, e.g. a truncated body or an HTML error page.
+var ErrInvalidFragment = errors.New("invalid fragment")
+
+// validateFragment checks that the fragment is a MPEG-TS stream: each packet
+// starts with the sync byte, the fragment is aligned on the packet size and
+// the continuity counters are incremented.
+//
+// Audio-only fragments in ADTS format are accepted as is.
+func validateFragment(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w: empty body", ErrInvalidFragment)
+	}
+	if isADTS(b) {
+		return nil
+	}
+	if len(b)%tsPacketSize != 0 {
+		return fmt.Errorf(
+			"%w: size %d is not a multiple of %d",
+			ErrInvalidFragment,
+			len(b),
+			tsPacketSize,
+		)
+	}
+
+	// Last continuity counter per PID.
+	counters := make(map[uint16]byte)
+	for offset := 0; offset < len(b); offset += tsPacketSize {
+		p := b[offset : offset+tsPacketSize]
+		if p[0] != tsSyncByte {
+			return fmt.Errorf("%w: missing sync byte at offset %d", ErrInvalidFragment, offset)
+		}
+		pid := uint16(p[1]&0x1f)<<8 | uint16(p[2])
+		if pid == tsNullPID {
+			continue
+		}
+		adaptationFieldControl := (p[3] >> 4) & 0x3
+		counter := p[3] & 0xf
+		hasPayload := adaptationFieldControl&0x1 != 0
+		discontinuity := adaptationFieldControl&0x2 != 0 && p[4] > 0 && p[5]&0x80 != 0
+
+		last, ok := counters[pid]
+		counters[pid] = counter
+		if !ok || discontinuity {
+			continue
+		}
+		// The counter is only incremented on packets with a payload. A packet
+		// can be duplicated.
+		expected := last
+		if hasPayload {
+			expected = (last + 1) & 0xf
+		}
+		if counter != expected && !(hasPayload && counter == last) {
+			return fmt.Errorf(
+				"%w: continuity counter of pid %d went from %d to %d at offset %d",
+				ErrInvalidFragment,
+				pid,
+				last,
+				counter,
+				offset,
+			)
+		}
+	}
+	return nil
+}
+
+// isADTS returns true if the data starts with an ADTS header.
+func isADTS(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xff && b[1]&0xf6 == 0xf0
+}
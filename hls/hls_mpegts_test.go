@@ -0,0 +1,96 @@
+package hls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tsPacket returns a MPEG-TS packet with a payload.
+func tsPacket(pid uint16, counter byte) []byte {
+	p := make([]byte, tsPacketSize)
+	p[0] = tsSyncByte
+	p[1] = byte(pid>>8) & 0x1f
+	p[2] = byte(pid)
+	p[3] = 0x10 | counter&0xf
+	return p
+}
+
+func tsPackets(packets ...[]byte) []byte {
+	var b []byte
+	for _, p := range packets {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestValidateFragment(t *testing.T) {
+	tests := []struct {
+		title   string
+		input   []byte
+		isError bool
+	}{
+		{
+			title: "Valid",
+			input: tsPackets(
+				tsPacket(0, 0),
+				tsPacket(256, 15),
+				tsPacket(256, 0),
+				tsPacket(257, 3),
+				tsPacket(256, 1),
+			),
+		},
+		{
+			title:   "Empty",
+			input:   []byte{},
+			isError: true,
+		},
+		{
+			title:   "HTML error page",
+			input:   []byte("<html><body>503 Service Unavailable</body></html>"),
+			isError: true,
+		},
+		{
+			title:   "Truncated",
+			input:   tsPackets(tsPacket(256, 0), tsPacket(256, 1))[:300],
+			isError: true,
+		},
+		{
+			title: "Missing sync byte",
+			input: func() []byte {
+				b := tsPackets(tsPacket(256, 0), tsPacket(256, 1))
+				b[tsPacketSize] = 0
+				return b
+			}(),
+			isError: true,
+		},
+		{
+			title:   "Continuity counter jump",
+			input:   tsPackets(tsPacket(256, 0), tsPacket(256, 1), tsPacket(256, 3)),
+			isError: true,
+		},
+		{
+			title: "Duplicate packet",
+			input: tsPackets(tsPacket(256, 0), tsPacket(256, 0), tsPacket(256, 1)),
+		},
+		{
+			title: "Null packets are ignored",
+			input: tsPackets(tsPacket(tsNullPID, 0), tsPacket(tsNullPID, 0)),
+		},
+		{
+			title: "Audio-only ADTS",
+			input: []byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			err := validateFragment(tt.input)
+			if tt.isError {
+				require.ErrorIs(t, err, ErrInvalidFragment)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidPlaylist is returned when the playlist is not a M3U8 playlist.
+var ErrInvalidPlaylist = errors.New("invalid m3u8 playlist")
+
+// Playlist is a HLS media playlist.
+type Playlist struct {
+	// TargetDuration is the maximum duration of a segment.
+	TargetDuration time.Duration
+	// MediaSequence is the media sequence number of the first segment.
+	MediaSequence int64
+	// HasMediaSequence is true if the playlist has the EXT-X-MEDIA-SEQUENCE tag.
+	HasMediaSequence bool
+	// DiscontinuitySequence is the discontinuity sequence number of the first
+	// segment.
+	DiscontinuitySequence int64
+	// EndList is true if no more segments will be added to the playlist.
+	EndList  bool
+	Segments []Segment
+}
+
+// Segment is a media segment of a playlist.
+type Segment struct {
+	URL      string
+	Duration time.Duration
+	Title    string
+	// SequenceNumber is the media sequence number of the segment. It is only
+	// meaningful if the playlist has a media sequence.
+	SequenceNumber int64
+	// Discontinuity is true if there is a discontinuity before the segment.
+	Discontinuity bool
+	// ProgramDateTime is the date of the first sample of the segment, if known.
+	ProgramDateTime time.Time
+}
+
+// URLs returns the URLs of the segments.
+func (p *Playlist) URLs() []string {
+	urls := make([]string, 0, len(p.Segments))
+	for _, s := range p.Segments {
+		urls = append(urls, s.URL)
+	}
+	return urls
+}
+
+// LastSequenceNumber returns the media sequence number of the last segment.
+func (p *Playlist) LastSequenceNumber() int64 {
+	if len(p.Segments) == 0 {
+		return p.MediaSequence - 1
+	}
+	return p.Segments[len(p.Segments)-1].SequenceNumber
+}
+
+// ParsePlaylist parses a HLS media playlist.
+//
+// The relative segment URIs are resolved against base, if not nil. Duplicated
+// URIs are skipped. Unknown tags are ignored.
+func ParsePlaylist(r io.Reader, base *url.URL) (*Playlist, error) {
+	scanner := bufio.NewScanner(r)
+	p := &Playlist{}
+	exists := make(map[string]bool) // Avoid duplicates
+
+	var (
+		header bool
+		// Attributes of the next segment.
+		duration        time.Duration
+		title           string
+		discontinuity   bool
+		programDateTime time.Time
+		// Number of segments seen, including the duplicated ones.
+		count int64
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !header {
+			line = strings.TrimPrefix(line, "\ufeff")
+			if line != "#EXTM3U" {
+				return nil, ErrInvalidPlaylist
+			}
+			header = true
+			continue
+		}
+
+		if line[0] != '#' {
+			seq := p.MediaSequence + count
+			count++
+			u, err := resolveURI(base, line)
+			if err != nil || exists[u] {
+				duration, title, discontinuity, programDateTime = 0, "", false, time.Time{}
+				continue
+			}
+			exists[u] = true
+			p.Segments = append(p.Segments, Segment{
+				URL:             u,
+				Duration:        duration,
+				Title:           title,
+				SequenceNumber:  seq,
+				Discontinuity:   discontinuity,
+				ProgramDateTime: programDateTime,
+			})
+			duration, title, discontinuity, programDateTime = 0, "", false, time.Time{}
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-TARGETDURATION":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.TargetDuration = time.Duration(v) * time.Second
+			}
+		case "#EXT-X-MEDIA-SEQUENCE":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.MediaSequence = v
+				p.HasMediaSequence = true
+			}
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.DiscontinuitySequence = v
+			}
+		case "#EXTINF":
+			d, t, _ := strings.Cut(value, ",")
+			if v, err := strconv.ParseFloat(d, 64); err == nil {
+				duration = time.Duration(v * float64(time.Second))
+			}
+			title = t
+		case "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case "#EXT-X-PROGRAM-DATE-TIME":
+			if v, ok := parseProgramDateTime(value); ok {
+				programDateTime = v
+			}
+		case "#EXT-X-ENDLIST":
+			p.EndList = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !header {
+		return nil, ErrInvalidPlaylist
+	}
+	return p, nil
+}
+
+// programDateTimeLayouts are the accepted layouts of EXT-X-PROGRAM-DATE-TIME:
+// RFC 3339, and ISO 8601 with an offset without colon.
+var programDateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+}
+
+func parseProgramDateTime(value string) (time.Time, bool) {
+	for _, layout := range programDateTimeLayouts {
+		if v, err := time.Parse(layout, value); err == nil {
+			return v, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func resolveURI(base *url.URL, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if base == nil || u.IsAbs() {
+		return uri, nil
+	}
+	return base.ResolveReference(u).String(), nil
+}
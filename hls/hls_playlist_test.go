@@ -0,0 +1,127 @@
+package hls
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	// Arrange
+	base, err := url.Parse("https://example.com/live/playlist.m3u8?token=a")
+	require.NoError(t, err)
+	input := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-DISCONTINUITY-SEQUENCE:1
+#EXTINF:1.5,first
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:00.000Z
+10.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:2,
+https://cdn.example.com/11.ts
+#EXTINF:2,
+https://cdn.example.com/11.ts
+#EXTINF:2,
+13.ts
+#EXT-X-ENDLIST
+`
+
+	// Act
+	p, err := ParsePlaylist(strings.NewReader(input), base)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, &Playlist{
+		TargetDuration:        2 * time.Second,
+		MediaSequence:         10,
+		HasMediaSequence:      true,
+		DiscontinuitySequence: 1,
+		EndList:               true,
+		Segments: []Segment{
+			{
+				URL:             "https://example.com/live/10.ts",
+				Duration:        1500 * time.Millisecond,
+				Title:           "first",
+				SequenceNumber:  10,
+				ProgramDateTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				URL:            "https://cdn.example.com/11.ts",
+				Duration:       2 * time.Second,
+				SequenceNumber: 11,
+				Discontinuity:  true,
+			},
+			{
+				URL:            "https://example.com/live/13.ts",
+				Duration:       2 * time.Second,
+				SequenceNumber: 13,
+			},
+		},
+	}, p)
+	require.Equal(t, int64(13), p.LastSequenceNumber())
+}
+
+func TestParsePlaylistFixture(t *testing.T) {
+	// Act
+	p, err := ParsePlaylist(bytes.NewReader(fixture1), nil)
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, p.HasMediaSequence)
+	require.Equal(t, time.Second, p.TargetDuration)
+	require.Equal(t, expectedURLs1, p.URLs())
+	require.Equal(t, int64(118617), p.LastSequenceNumber())
+	require.False(t, p.EndList)
+}
+
+func TestParsePlaylistInvalid(t *testing.T) {
+	// Act
+	_, err := ParsePlaylist(strings.NewReader("<html></html>"), nil)
+
+	// Assert
+	require.ErrorIs(t, err, ErrInvalidPlaylist)
+}
+
+func TestParsePlaylistProgramDateTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Time
+		title    string
+	}{
+		{
+			value:    "2024-01-01T09:00:00.000+09:00",
+			expected: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			title:    "RFC 3339",
+		},
+		{
+			value:    "2024-01-01T09:00:00.000+0900",
+			expected: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			title:    "ISO 8601 offset without colon",
+		},
+		{
+			value: "yesterday",
+			title: "Invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			input := "#EXTM3U\n#EXTINF:1,\n#EXT-X-PROGRAM-DATE-TIME:" + tt.value + "\n1.ts\n"
+
+			// Act
+			p, err := ParsePlaylist(strings.NewReader(input), nil)
+
+			// Assert
+			require.NoError(t, err)
+			require.Len(t, p.Segments, 1)
+			require.True(t, tt.expected.Equal(p.Segments[0].ProgramDateTime))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package hls
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GapReason is the reason of a gap in the recording.
+type GapReason string
+
+const (
+	// GapReasonFragmentFailed is used when a fragment failed to be downloaded
+	// and was skipped.
+	GapReasonFragmentFailed GapReason = "fragment_failed"
+	// GapReasonSequenceGap is used when fragments left the playlist before being
+	// fetched.
+	GapReasonSequenceGap GapReason = "sequence_gap"
+)
+
+// Gap is a hole in the recording.
+type Gap struct {
+	Time   time.Time `json:"time"`
+	Reason GapReason `json:"reason"`
+	// URL is the URL of the failed fragment.
+	URL string `json:"url,omitempty"`
+	// FirstSequence and LastSequence are the media sequence numbers of the
+	// missing fragments, if known.
+	FirstSequence int64  `json:"firstSequence,omitempty"`
+	LastSequence  int64  `json:"lastSequence,omitempty"`
+	Count         int64  `json:"count"`
+	Error         string `json:"error,omitempty"`
+}
+
+// QualitySwitch is a change of playlist during the recording.
+type QualitySwitch struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// Report is the integrity report of a recording.
+//
+// A report can be shared by multiple downloaders, for example when the quality
+// is upgraded. It is safe for concurrent use.
+type Report struct {
+	mu sync.Mutex
+
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime,omitzero"`
+	// Fragments is the number of fragments written.
+	Fragments int64 `json:"fragments"`
+	// FailedFragments is the number of fragments skipped after failing to be
+	// downloaded.
+	FailedFragments int64 `json:"failedFragments"`
+	// MissingFragments is the number of fragments which left the playlist before
+	// being fetched.
+	MissingFragments int64           `json:"missingFragments"`
+	Gaps             []Gap           `json:"gaps"`
+	QualitySwitches  []QualitySwitch `json:"qualitySwitches"`
+}
+
+// NewReport creates an empty report starting now.
+func NewReport() *Report {
+	return &Report{
+		StartTime:       time.Now().UTC(),
+		Gaps:            []Gap{},
+		QualitySwitches: []QualitySwitch{},
+	}
+}
+
+// LoadReport reads the report written in the file, to be continued when a
+// recording is resumed.
+func LoadReport(name string) (*Report, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReport()
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", name, err)
+	}
+	if r.Gaps == nil {
+		r.Gaps = []Gap{}
+	}
+	if r.QualitySwitches == nil {
+		r.QualitySwitches = []QualitySwitch{}
+	}
+	r.EndTime = time.Time{}
+	return r, nil
+}
+
+func (r *Report) addFragment() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Fragments++
+}
+
+func (r *Report) addFailedFragment(url string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FailedFragments++
+	r.Gaps = append(r.Gaps, Gap{
+		Time:   time.Now().UTC(),
+		Reason: GapReasonFragmentFailed,
+		URL:    url,
+		Count:  1,
+		Error:  err.Error(),
+	})
+}
+
+func (r *Report) addSequenceGap(first, last int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := last - first + 1
+	r.MissingFragments += count
+	r.Gaps = append(r.Gaps, Gap{
+		Time:          time.Now().UTC(),
+		Reason:        GapReasonSequenceGap,
+		FirstSequence: first,
+		LastSequence:  last,
+		Count:         count,
+	})
+}
+
+// AddQualitySwitch records a change of playlist.
+func (r *Report) AddQualitySwitch(from, to string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.QualitySwitches = append(r.QualitySwitches, QualitySwitch{
+		Time: time.Now().UTC(),
+		From: from,
+		To:   to,
+	})
+}
+
+// Finish sets the end time of the report.
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.EndTime = time.Now().UTC()
+}
+
+// HasGaps returns true if the recording has holes.
+func (r *Report) HasGaps() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Gaps) > 0
+}
+
+// Summary returns a one-line summary of the report.
+func (r *Report) Summary() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parts := []string{fmt.Sprintf("%d fragments", r.Fragments)}
+	if r.FailedFragments > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", r.FailedFragments))
+	}
+	if r.MissingFragments > 0 {
+		parts = append(parts, fmt.Sprintf("%d missing", r.MissingFragments))
+	}
+	if len(r.QualitySwitches) > 0 {
+		parts = append(parts, fmt.Sprintf("%d quality switches", len(r.QualitySwitches)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MarshalJSON marshals a consistent snapshot of the report.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	type report Report
+	return json.Marshal((*report)(r))
+}
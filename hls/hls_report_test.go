@@ -0,0 +1,74 @@
+package hls
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	// Arrange
+	r := NewReport()
+
+	// Act
+	r.addFragment()
+	r.addFragment()
+	r.addFailedFragment("https://example.com/3.ts", errors.New("http error"))
+	r.addSequenceGap(4, 6)
+	r.AddQualitySwitch("1.2Mbps (mid)", "3Mbps (mid)")
+	r.Finish()
+
+	// Assert
+	require.True(t, r.HasGaps())
+	require.Equal(t, "2 fragments, 1 failed, 3 missing, 1 quality switches", r.Summary())
+	b, err := json.Marshal(r)
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(b, &out))
+	require.EqualValues(t, 2, out["fragments"])
+	require.EqualValues(t, 1, out["failedFragments"])
+	require.EqualValues(t, 3, out["missingFragments"])
+	require.Len(t, out["gaps"], 2)
+	require.Len(t, out["qualitySwitches"], 1)
+	require.Contains(t, out, "endTime")
+}
+
+func TestReportNoGaps(t *testing.T) {
+	// Arrange
+	r := NewReport()
+
+	// Act
+	r.addFragment()
+
+	// Assert
+	require.False(t, r.HasGaps())
+	require.Equal(t, "1 fragments", r.Summary())
+}
+
+func TestLoadReport(t *testing.T) {
+	// Arrange
+	name := filepath.Join(t.TempDir(), "name.report.json")
+	r := NewReport()
+	r.addFragment()
+	r.addSequenceGap(4, 6)
+	r.Finish()
+	b, err := json.Marshal(r)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(name, b, 0o644))
+
+	// Act
+	loaded, err := LoadReport(name)
+	_, errMissing := LoadReport(filepath.Join(t.TempDir(), "missing.report.json"))
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, r.StartTime.Equal(loaded.StartTime))
+	require.True(t, loaded.EndTime.IsZero())
+	loaded.addFragment()
+	require.Equal(t, "2 fragments, 3 missing", loaded.Summary())
+	require.ErrorIs(t, errMissing, os.ErrNotExist)
+}
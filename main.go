@@ -10,6 +10,7 @@ import (
 	"github.com/Darkness4/fc2-live-dl-go/cmd/concat"
 	"github.com/Darkness4/fc2-live-dl-go/cmd/download"
 	"github.com/Darkness4/fc2-live-dl-go/cmd/remux"
+	"github.com/Darkness4/fc2-live-dl-go/cmd/subtitle"
 	"github.com/Darkness4/fc2-live-dl-go/cmd/watch"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -59,6 +60,7 @@ var cmd = &cli.Command{
 		watch.Command,
 		remux.Command,
 		concat.Command,
+		subtitle.Command,
 		clean.Command,
 	},
 	Before: func(ctx context.Context, _ *cli.Command) (context.Context, error) {
@@ -53,6 +53,17 @@ func NotifyDownloading(
 	return Notifier.NotifyDownloading(ctx, channelID, labels, metadata)
 }
 
+// NotifyTitleChanged notifies the user that the title of the stream changed during the download.
+func NotifyTitleChanged(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+	oldTitle string,
+) error {
+	return Notifier.NotifyTitleChanged(ctx, channelID, labels, metadata, oldTitle)
+}
+
 // NotifyPostProcessing notifies the user that the program is post processing the stream.
 func NotifyPostProcessing(
 	ctx context.Context,
@@ -64,13 +75,16 @@ func NotifyPostProcessing(
 }
 
 // NotifyFinished notifies the user that the program has finished downloading the stream.
+//
+// The report is the integrity report of the recording, it can be nil.
 func NotifyFinished(
 	ctx context.Context,
 	channelID string,
 	labels map[string]string,
 	metadata any,
+	report any,
 ) error {
-	return Notifier.NotifyFinished(ctx, channelID, labels, metadata)
+	return Notifier.NotifyFinished(ctx, channelID, labels, metadata, report)
 }
 
 // NotifyError notifies the user that the program has encountered an error.
@@ -92,6 +106,38 @@ func NotifyCanceled(
 	return Notifier.NotifyCanceled(ctx, channelID, labels)
 }
 
+// NotifyQueued notifies the user that the download waits for a download slot.
+func NotifyQueued(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+) error {
+	return Notifier.NotifyQueued(ctx, channelID, labels, metadata)
+}
+
+// NotifyPreempted notifies the user that the download was preempted by a download with a
+// higher priority.
+func NotifyPreempted(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+) error {
+	return Notifier.NotifyPreempted(ctx, channelID, labels, metadata)
+}
+
+// NotifySkipped notifies the user that the stream is live but is not recorded.
+func NotifySkipped(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+	reason string,
+) error {
+	return Notifier.NotifySkipped(ctx, channelID, labels, metadata, reason)
+}
+
 // NotifyUpdateAvailable notifies the user that an update is available.
 func NotifyUpdateAvailable(ctx context.Context, version string) error {
 	return Notifier.NotifyUpdateAvailable(ctx, version)
@@ -14,10 +14,14 @@ type NotificationFormats struct {
 	Idle            NotificationFormat `yaml:"idle,omitempty"`
 	PreparingFiles  NotificationFormat `yaml:"preparingFiles,omitempty"`
 	Downloading     NotificationFormat `yaml:"downloading,omitempty"`
+	TitleChanged    NotificationFormat `yaml:"titleChanged,omitempty"`
 	PostProcessing  NotificationFormat `yaml:"postProcessing,omitempty"`
 	Finished        NotificationFormat `yaml:"finished,omitempty"`
 	Error           NotificationFormat `yaml:"error,omitempty"`
 	Canceled        NotificationFormat `yaml:"canceled,omitempty"`
+	Queued          NotificationFormat `yaml:"queued,omitempty"`
+	Preempted       NotificationFormat `yaml:"preempted,omitempty"`
+	Skipped         NotificationFormat `yaml:"skipped,omitempty"`
 	UpdateAvailable NotificationFormat `yaml:"updateAvailable,omitempty"`
 }
 
@@ -37,10 +41,14 @@ type NotificationTemplates struct {
 	Idle            NotificationTemplate
 	PreparingFiles  NotificationTemplate
 	Downloading     NotificationTemplate
+	TitleChanged    NotificationTemplate
 	PostProcessing  NotificationTemplate
 	Finished        NotificationTemplate
 	Error           NotificationTemplate
 	Canceled        NotificationTemplate
+	Queued          NotificationTemplate
+	Preempted       NotificationTemplate
+	Skipped         NotificationTemplate
 	UpdateAvailable NotificationTemplate
 }
 
@@ -84,6 +92,12 @@ var DefaultNotificationFormats = NotificationFormats{
 		Message:  "{{ .MetaData.ChannelData.Title }}",
 		Priority: 7,
 	},
+	TitleChanged: NotificationFormat{
+		Enabled:  new(true),
+		Title:    "{{ .MetaData.ProfileData.Name }} changed the title",
+		Message:  "{{ .MetaData.ChannelData.Title }} (was: {{ .OldTitle }})",
+		Priority: 5,
+	},
 	PostProcessing: NotificationFormat{
 		Enabled:  new(false),
 		Title:    "post-processing {{ .MetaData.ProfileData.Name }}",
@@ -93,7 +107,7 @@ var DefaultNotificationFormats = NotificationFormats{
 	Finished: NotificationFormat{
 		Enabled:  new(true),
 		Title:    "{{ .MetaData.ProfileData.Name }} stream ended",
-		Message:  "{{ .MetaData.ChannelData.Title }}",
+		Message:  "{{ .MetaData.ChannelData.Title }}{{ with .Report }}{{ if .HasGaps }}\nWarning: the recording has gaps ({{ .Summary }}){{ end }}{{ end }}",
 		Priority: 7,
 	},
 	Error: NotificationFormat{
@@ -107,6 +121,24 @@ var DefaultNotificationFormats = NotificationFormats{
 		Title:    "stream download of {{ .ChannelID }} canceled",
 		Priority: 10,
 	},
+	Queued: NotificationFormat{
+		Enabled:  new(true),
+		Title:    "{{ .MetaData.ProfileData.Name }} is queued",
+		Message:  "All download slots are taken. {{ .MetaData.ChannelData.Title }}",
+		Priority: 7,
+	},
+	Preempted: NotificationFormat{
+		Enabled:  new(true),
+		Title:    "stream download of {{ .MetaData.ProfileData.Name }} preempted",
+		Message:  "A channel with a higher priority took the download slot.",
+		Priority: 8,
+	},
+	Skipped: NotificationFormat{
+		Enabled:  new(true),
+		Title:    "{{ .MetaData.ProfileData.Name }} is streaming but skipped",
+		Message:  "{{ .MetaData.ChannelData.Title }} ({{ .Reason }})",
+		Priority: 4,
+	},
 	UpdateAvailable: NotificationFormat{
 		Enabled:  new(true),
 		Title:    "update available ({{ .Version }})",
@@ -140,10 +172,14 @@ func applyNotificationFormatsDefault(newFormat NotificationFormats) Notification
 	formats.Idle.applyNotificationFormatDefault(newFormat.Idle)
 	formats.PreparingFiles.applyNotificationFormatDefault(newFormat.PreparingFiles)
 	formats.Downloading.applyNotificationFormatDefault(newFormat.Downloading)
+	formats.TitleChanged.applyNotificationFormatDefault(newFormat.TitleChanged)
 	formats.PostProcessing.applyNotificationFormatDefault(newFormat.PostProcessing)
 	formats.Finished.applyNotificationFormatDefault(newFormat.Finished)
 	formats.Error.applyNotificationFormatDefault(newFormat.Error)
 	formats.Canceled.applyNotificationFormatDefault(newFormat.Canceled)
+	formats.Queued.applyNotificationFormatDefault(newFormat.Queued)
+	formats.Preempted.applyNotificationFormatDefault(newFormat.Preempted)
+	formats.Skipped.applyNotificationFormatDefault(newFormat.Skipped)
 	formats.UpdateAvailable.applyNotificationFormatDefault(newFormat.UpdateAvailable)
 	return formats
 }
@@ -163,10 +199,14 @@ func initializeTemplates(formats NotificationFormats) NotificationTemplates {
 		Idle:            initializeTemplate(formats.Idle),
 		PreparingFiles:  initializeTemplate(formats.PreparingFiles),
 		Downloading:     initializeTemplate(formats.Downloading),
+		TitleChanged:    initializeTemplate(formats.TitleChanged),
 		PostProcessing:  initializeTemplate(formats.PostProcessing),
 		Finished:        initializeTemplate(formats.Finished),
 		Error:           initializeTemplate(formats.Error),
 		Canceled:        initializeTemplate(formats.Canceled),
+		Queued:          initializeTemplate(formats.Queued),
+		Preempted:       initializeTemplate(formats.Preempted),
+		Skipped:         initializeTemplate(formats.Skipped),
 		UpdateAvailable: initializeTemplate(formats.UpdateAvailable),
 	}
 }
@@ -238,6 +278,62 @@ func (n *FormatedNotifier) NotifyDownloading(
 	)
 }
 
+// NotifyTitleChanged sends a notification that the title of the stream changed
+// during the download.
+func (n *FormatedNotifier) NotifyTitleChanged(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+	oldTitle string,
+) error {
+	if n.NotificationFormats.TitleChanged.Enabled == nil ||
+		(n.NotificationFormats.TitleChanged.Enabled != nil &&
+			!(*n.NotificationFormats.TitleChanged.Enabled)) {
+		return nil
+	}
+	var titleSB strings.Builder
+	var messageSB strings.Builder
+	if err := n.NotificationTemplates.TitleChanged.TitleTemplate.Execute(
+		&titleSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+			OldTitle  string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+			OldTitle:  oldTitle,
+		},
+	); err != nil {
+		return err
+	}
+	if err := n.NotificationTemplates.TitleChanged.MessageTemplate.Execute(
+		&messageSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+			OldTitle  string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+			OldTitle:  oldTitle,
+		},
+	); err != nil {
+		return err
+	}
+	return n.Notify(
+		ctx,
+		titleSB.String(),
+		messageSB.String(),
+		n.NotificationFormats.TitleChanged.Priority,
+	)
+}
+
 // NotifyError sends a notification that the download encountered an error.
 func (n *FormatedNotifier) NotifyError(
 	ctx context.Context,
@@ -294,6 +390,7 @@ func (n *FormatedNotifier) NotifyFinished(
 	channelID string,
 	labels map[string]string,
 	metadata any,
+	report any,
 ) error {
 	if n.NotificationFormats.Finished.Enabled == nil ||
 		(n.NotificationFormats.Finished.Enabled != nil &&
@@ -308,10 +405,12 @@ func (n *FormatedNotifier) NotifyFinished(
 			ChannelID string
 			MetaData  any
 			Labels    map[string]string
+			Report    any
 		}{
 			ChannelID: channelID,
 			MetaData:  metadata,
 			Labels:    labels,
+			Report:    report,
 		},
 	); err != nil {
 		return err
@@ -322,10 +421,12 @@ func (n *FormatedNotifier) NotifyFinished(
 			ChannelID string
 			MetaData  any
 			Labels    map[string]string
+			Report    any
 		}{
 			ChannelID: channelID,
 			MetaData:  metadata,
 			Labels:    labels,
+			Report:    report,
 		},
 	); err != nil {
 		return err
@@ -632,6 +733,162 @@ func (n *FormatedNotifier) NotifyCanceled(
 	)
 }
 
+// NotifyQueued sends a notification that the download waits for a download slot.
+func (n *FormatedNotifier) NotifyQueued(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+) error {
+	if n.NotificationFormats.Queued.Enabled == nil ||
+		(n.NotificationFormats.Queued.Enabled != nil &&
+			!(*n.NotificationFormats.Queued.Enabled)) {
+		return nil
+	}
+	var titleSB strings.Builder
+	var messageSB strings.Builder
+	if err := n.NotificationTemplates.Queued.TitleTemplate.Execute(
+		&titleSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+		},
+	); err != nil {
+		return err
+	}
+	if err := n.NotificationTemplates.Queued.MessageTemplate.Execute(
+		&messageSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+		},
+	); err != nil {
+		return err
+	}
+	return n.Notify(
+		ctx,
+		titleSB.String(),
+		messageSB.String(),
+		n.NotificationFormats.Queued.Priority,
+	)
+}
+
+// NotifyPreempted sends a notification that the download was preempted by a download
+// with a higher priority.
+func (n *FormatedNotifier) NotifyPreempted(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+) error {
+	if n.NotificationFormats.Preempted.Enabled == nil ||
+		(n.NotificationFormats.Preempted.Enabled != nil &&
+			!(*n.NotificationFormats.Preempted.Enabled)) {
+		return nil
+	}
+	var titleSB strings.Builder
+	var messageSB strings.Builder
+	if err := n.NotificationTemplates.Preempted.TitleTemplate.Execute(
+		&titleSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+		},
+	); err != nil {
+		return err
+	}
+	if err := n.NotificationTemplates.Preempted.MessageTemplate.Execute(
+		&messageSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+		},
+	); err != nil {
+		return err
+	}
+	return n.Notify(
+		ctx,
+		titleSB.String(),
+		messageSB.String(),
+		n.NotificationFormats.Preempted.Priority,
+	)
+}
+
+// NotifySkipped sends a notification that the stream is live but is not recorded.
+func (n *FormatedNotifier) NotifySkipped(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+	metadata any,
+	reason string,
+) error {
+	if n.NotificationFormats.Skipped.Enabled == nil ||
+		(n.NotificationFormats.Skipped.Enabled != nil &&
+			!(*n.NotificationFormats.Skipped.Enabled)) {
+		return nil
+	}
+	var titleSB strings.Builder
+	var messageSB strings.Builder
+	if err := n.NotificationTemplates.Skipped.TitleTemplate.Execute(
+		&titleSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+			Reason    string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+			Reason:    reason,
+		},
+	); err != nil {
+		return err
+	}
+	if err := n.NotificationTemplates.Skipped.MessageTemplate.Execute(
+		&messageSB,
+		struct {
+			ChannelID string
+			MetaData  any
+			Labels    map[string]string
+			Reason    string
+		}{
+			ChannelID: channelID,
+			MetaData:  metadata,
+			Labels:    labels,
+			Reason:    reason,
+		},
+	); err != nil {
+		return err
+	}
+	return n.Notify(
+		ctx,
+		titleSB.String(),
+		messageSB.String(),
+		n.NotificationFormats.Skipped.Priority,
+	)
+}
+
 // NotifyUpdateAvailable sends a notification that an update is available.
 func (n *FormatedNotifier) NotifyUpdateAvailable(
 	ctx context.Context,
@@ -1,9 +1,13 @@
 // Package state implements state for debugging.
+//
+// The state can be persisted with the history of the recordings, see Persist.
 package state
 
 import (
 	"context"
 	"encoding/json"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 )
@@ -11,8 +15,13 @@ import (
 // State represents the state of the program.
 type State struct {
 	Channels map[string]*ChannelState `json:"channels"`
+	// Jobs are the pending post-processing jobs.
+	Jobs []Job `json:"jobs,omitempty"`
 
-	mu sync.RWMutex
+	history     []Recording
+	store       *store
+	subscribers map[*subscriber]struct{}
+	mu          sync.RWMutex
 }
 
 // ChannelState represents the state of a channel.
@@ -21,6 +30,10 @@ type ChannelState struct {
 	Extra         map[string]any    `json:"extra,omitempty"`
 	Labels        map[string]string `json:"labels,omitempty"`
 	Errors        []DownloadError   `json:"errors_log"`
+	// Title is the current title of the live stream, while downloading.
+	Title string `json:"title,omitempty"`
+	// Viewers is the current number of viewers, while downloading.
+	Viewers int64 `json:"viewers,omitempty"`
 }
 
 // DownloadError represents an error during a download.
@@ -47,6 +60,14 @@ const (
 	DownloadStateFinished
 	// DownloadStateCanceled is used when the download is canceled.
 	DownloadStateCanceled
+	// DownloadStateQueued is used when the download waits for a download slot.
+	DownloadStateQueued
+	// DownloadStatePreempted is used when the download was stopped by a download with a higher priority.
+	DownloadStatePreempted
+	// DownloadStateSkipped is used when the stream is live but is not recorded.
+	DownloadStateSkipped
+	// DownloadStatePaused is used when the watcher is paused.
+	DownloadStatePaused
 )
 
 // String returns a string representation of a DownloadState.
@@ -66,6 +87,14 @@ func (d DownloadState) String() string {
 		return "FINISHED"
 	case DownloadStateCanceled:
 		return "CANCELED"
+	case DownloadStateQueued:
+		return "QUEUED"
+	case DownloadStatePreempted:
+		return "PREEMPTED"
+	case DownloadStateSkipped:
+		return "SKIPPED"
+	case DownloadStatePaused:
+		return "PAUSED"
 	}
 	return "UNSPECIFIED"
 }
@@ -87,6 +116,14 @@ func DownloadStateFromString(s string) DownloadState {
 		return DownloadStateFinished
 	case "CANCELED":
 		return DownloadStateCanceled
+	case "QUEUED":
+		return DownloadStateQueued
+	case "PREEMPTED":
+		return DownloadStatePreempted
+	case "SKIPPED":
+		return DownloadStateSkipped
+	case "PAUSED":
+		return DownloadStatePaused
 	}
 }
 
@@ -163,10 +200,77 @@ func (s *State) SetChannelState(
 			Errors: make([]DownloadError, 0),
 		}
 	}
-	s.Channels[name].DownloadState = state
-	s.Channels[name].Extra = o.extra
-	s.Channels[name].Labels = o.labels
+	c := s.Channels[name]
+	old := c.DownloadState
+	// The live information is only relevant while downloading.
+	if state != DownloadStateDownloading && (c.Title != "" || c.Viewers != 0) {
+		clearLiveMetrics(context.Background(), name, c.Labels)
+		c.Title = ""
+		c.Viewers = 0
+	}
+	c.DownloadState = state
+	c.Extra = o.extra
+	c.Labels = o.labels
 	setStateMetrics(context.Background(), name, state, o.labels)
+	s.publishLocked(Event{
+		Type:      EventTypeState,
+		ChannelID: name,
+		OldState:  old,
+		NewState:  state,
+		Labels:    o.labels,
+		Extra:     o.extra,
+	})
+}
+
+// DeleteChannelState removes a channel from the state.
+func (s *State) DeleteChannelState(name string) {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.Channels[name]
+	if !ok {
+		return
+	}
+	delete(s.Channels, name)
+	clearStateMetrics(context.Background(), name, c.Labels)
+	clearLiveMetrics(context.Background(), name, c.Labels)
+	s.publishLocked(Event{
+		Type:      EventTypeDelete,
+		ChannelID: name,
+		OldState:  c.DownloadState,
+		Labels:    c.Labels,
+	})
+	s.saveLocked()
+}
+
+// SetChannelLive sets the current title and number of viewers of the live
+// stream being downloaded.
+func (s *State) SetChannelLive(name string, title string, viewers int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Channels[name]; !ok {
+		s.Channels[name] = &ChannelState{
+			Errors: make([]DownloadError, 0),
+		}
+	}
+
+	c := s.Channels[name]
+	if c.Title == title && c.Viewers == viewers {
+		return
+	}
+	setLiveMetrics(context.Background(), name, viewers, c.Labels)
+	c.Title = title
+	c.Viewers = viewers
+	s.publishLocked(Event{
+		Type:      EventTypeLive,
+		ChannelID: name,
+		OldState:  c.DownloadState,
+		NewState:  c.DownloadState,
+		Labels:    c.Labels,
+		Extra:     c.Extra,
+		Title:     title,
+		Viewers:   viewers,
+	})
 }
 
 // SetChannelError sets an error for a channel.
@@ -175,6 +279,7 @@ func (s *State) SetChannelError(name string, err error) {
 		return
 	}
 
+	defer s.flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.Channels[name]; !ok {
@@ -183,13 +288,37 @@ func (s *State) SetChannelError(name string, err error) {
 		}
 	}
 
-	s.Channels[name].Errors = append(s.Channels[name].Errors, DownloadError{
+	c := s.Channels[name]
+	c.Errors = append(c.Errors, DownloadError{
 		Timestamp: time.Now().UTC().String(),
 		Error:     err.Error(),
 	})
+	s.publishLocked(Event{
+		Type:      EventTypeError,
+		ChannelID: name,
+		OldState:  c.DownloadState,
+		NewState:  c.DownloadState,
+		Labels:    c.Labels,
+		Extra:     c.Extra,
+		Error:     err.Error(),
+	})
+	s.saveLocked()
 }
 
-// ReadState returns the current state.
+// ReadState returns a snapshot of the current state.
 func (s *State) ReadState() *State {
-	return s
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	channels := make(map[string]*ChannelState, len(s.Channels))
+	for name, c := range s.Channels {
+		snapshot := *c
+		snapshot.Extra = maps.Clone(c.Extra)
+		snapshot.Labels = maps.Clone(c.Labels)
+		snapshot.Errors = slices.Clone(c.Errors)
+		channels[name] = &snapshot
+	}
+	return &State{
+		Channels: channels,
+		Jobs:     slices.Clone(s.Jobs),
+	}
 }
@@ -0,0 +1,77 @@
+package state
+
+import "time"
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventTypeState is emitted when the download state of a channel is set.
+	EventTypeState EventType = "state"
+	// EventTypeError is emitted when an error is added to a channel.
+	EventTypeError EventType = "error"
+	// EventTypeDelete is emitted when a channel is removed from the state.
+	EventTypeDelete EventType = "delete"
+	// EventTypeLive is emitted when the title or the number of viewers of the
+	// live stream being downloaded changes.
+	EventTypeLive EventType = "live"
+)
+
+// Event is a change of the state of a channel.
+type Event struct {
+	Type      EventType         `json:"type"`
+	ChannelID string            `json:"channel_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	OldState  DownloadState     `json:"old_state"`
+	NewState  DownloadState     `json:"new_state"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Extra     map[string]any    `json:"extra,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Viewers   int64             `json:"viewers,omitempty"`
+}
+
+// subscriber receives the events. Its channel is closed if it is too slow.
+type subscriber struct {
+	ch chan Event
+}
+
+// Subscribe returns a channel receiving the events and a function to
+// unsubscribe.
+//
+// The events are not blocking: if the buffer is full, the channel is closed and
+// the subscriber must subscribe again.
+func (s *State) Subscribe(buffer int) (<-chan Event, func()) {
+	sub := &subscriber{ch: make(chan Event, buffer)}
+	s.mu.Lock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[*subscriber]struct{})
+	}
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+
+	return sub.ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[sub]; ok {
+			delete(s.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// publishLocked sends the event to the subscribers.
+func (s *State) publishLocked(e Event) {
+	if len(s.subscribers) == 0 {
+		return
+	}
+	e.Timestamp = time.Now().UTC()
+	for sub := range s.subscribers {
+		select {
+		case sub.ch <- e:
+		default:
+			delete(s.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
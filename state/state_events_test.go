@@ -0,0 +1,44 @@
+package state_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	events, unsubscribe := s.Subscribe(10)
+	slow, _ := s.Subscribe(1)
+
+	// Test
+	s.SetChannelState("a", state.DownloadStatePreparingFiles, state.WithLabels(map[string]string{"k": "v"}))
+	s.SetChannelState("a", state.DownloadStateDownloading)
+	s.SetChannelError("a", errors.New("failure"))
+	unsubscribe()
+
+	// Assert
+	e := <-events
+	require.Equal(t, state.EventTypeState, e.Type)
+	require.Equal(t, "a", e.ChannelID)
+	require.Equal(t, state.DownloadStateUnspecified, e.OldState)
+	require.Equal(t, state.DownloadStatePreparingFiles, e.NewState)
+	require.Equal(t, map[string]string{"k": "v"}, e.Labels)
+	e = <-events
+	require.Equal(t, state.DownloadStatePreparingFiles, e.OldState)
+	require.Equal(t, state.DownloadStateDownloading, e.NewState)
+	e = <-events
+	require.Equal(t, state.EventTypeError, e.Type)
+	require.Equal(t, "failure", e.Error)
+	_, ok := <-events
+	require.False(t, ok, "channel should be closed after unsubscribe")
+
+	<-slow
+	_, ok = <-slow
+	require.False(t, ok, "slow subscriber should be closed")
+}
@@ -0,0 +1,204 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Recording represents a recording in the history.
+type Recording struct {
+	ID        string            `json:"id"`
+	ChannelID string            `json:"channel_id"`
+	Title     string            `json:"title,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   *time.Time        `json:"end_time,omitempty"`
+	Files     []string          `json:"files"`
+	Status    RecordingStatus   `json:"status"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// RecordingStatus represents the final status of a recording.
+type RecordingStatus int
+
+const (
+	// RecordingStatusUnspecified is used when the recording status is unspecified.
+	RecordingStatusUnspecified RecordingStatus = iota
+	// RecordingStatusRecording is used when the recording is not finished.
+	RecordingStatusRecording
+	// RecordingStatusFinished is used when the stream ended and the recording succeeded.
+	RecordingStatusFinished
+	// RecordingStatusFailed is used when the recording finished with an error.
+	RecordingStatusFailed
+	// RecordingStatusCanceled is used when the recording was canceled.
+	RecordingStatusCanceled
+	// RecordingStatusPreempted is used when the recording was stopped by a download with a higher priority.
+	RecordingStatusPreempted
+	// RecordingStatusInterrupted is used when the program stopped before the end of the recording.
+	RecordingStatusInterrupted
+)
+
+// String returns a string representation of a RecordingStatus.
+func (r RecordingStatus) String() string {
+	switch r {
+	case RecordingStatusUnspecified:
+		return "UNSPECIFIED"
+	case RecordingStatusRecording:
+		return "RECORDING"
+	case RecordingStatusFinished:
+		return "FINISHED"
+	case RecordingStatusFailed:
+		return "FAILED"
+	case RecordingStatusCanceled:
+		return "CANCELED"
+	case RecordingStatusPreempted:
+		return "PREEMPTED"
+	case RecordingStatusInterrupted:
+		return "INTERRUPTED"
+	}
+	return "UNSPECIFIED"
+}
+
+// RecordingStatusFromString returns a RecordingStatus from a string.
+func RecordingStatusFromString(s string) RecordingStatus {
+	switch s {
+	default:
+		return RecordingStatusUnspecified
+	case "RECORDING":
+		return RecordingStatusRecording
+	case "FINISHED":
+		return RecordingStatusFinished
+	case "FAILED":
+		return RecordingStatusFailed
+	case "CANCELED":
+		return RecordingStatusCanceled
+	case "PREEMPTED":
+		return RecordingStatusPreempted
+	case "INTERRUPTED":
+		return RecordingStatusInterrupted
+	}
+}
+
+// MarshalJSON marshals a RecordingStatus into a string.
+func (r RecordingStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON unmarshals a string into a RecordingStatus.
+func (r *RecordingStatus) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	*r = RecordingStatusFromString(s)
+
+	return nil
+}
+
+// StartRecording adds a recording to the history and returns its ID.
+func (s *State) StartRecording(
+	channelID string,
+	title string,
+	labels map[string]string,
+) string {
+	now := time.Now().UTC()
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := fmt.Sprintf("%s-%d", channelID, now.UnixNano())
+	s.history = append(s.history, Recording{
+		ID:        id,
+		ChannelID: channelID,
+		Title:     title,
+		Labels:    labels,
+		StartTime: now,
+		Files:     []string{},
+		Status:    RecordingStatusRecording,
+	})
+	s.saveLocked()
+	return id
+}
+
+// FinishRecording sets the end time, the files and the final status of a
+// recording.
+func (s *State) FinishRecording(
+	id string,
+	status RecordingStatus,
+	files []string,
+	err error,
+) {
+	now := time.Now().UTC()
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.history, func(r Recording) bool {
+		return r.ID == id
+	})
+	if idx < 0 {
+		return
+	}
+	r := &s.history[idx]
+	r.EndTime = &now
+	r.Status = status
+	if files != nil {
+		r.Files = files
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	s.saveLocked()
+}
+
+// SetRecordingFiles sets the files of a recording, once post-processed.
+func (s *State) SetRecordingFiles(id string, files []string) {
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.history, func(r Recording) bool {
+		return r.ID == id
+	})
+	if idx < 0 {
+		return
+	}
+	s.history[idx].Files = files
+	s.saveLocked()
+}
+
+// HistoryQuery filters the history.
+type HistoryQuery struct {
+	// ChannelID filters the recordings of a channel.
+	ChannelID string
+	// Status filters the recordings with a status.
+	Status RecordingStatus
+	// Since filters the recordings started after a time.
+	Since time.Time
+	// Limit is the maximum number of recordings returned. Zero means no limit.
+	Limit int
+}
+
+// History returns the recordings matching the query, the most recent first.
+func (s *State) History(q HistoryQuery) []Recording {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]Recording, 0, len(s.history))
+	for i := len(s.history) - 1; i >= 0; i-- {
+		r := s.history[i]
+		if q.ChannelID != "" && r.ChannelID != q.ChannelID {
+			continue
+		}
+		if q.Status != RecordingStatusUnspecified && r.Status != q.Status {
+			continue
+		}
+		if !q.Since.IsZero() && r.StartTime.Before(q.Since) {
+			continue
+		}
+		res = append(res, r)
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package state_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	id1 := s.StartRecording("a", "title a", nil)
+	id2 := s.StartRecording("b", "title b", nil)
+	s.FinishRecording(id1, state.RecordingStatusFinished, []string{"a.mp4"}, nil)
+	s.FinishRecording(id2, state.RecordingStatusFailed, nil, errors.New("failure"))
+	s.SetRecordingFiles(id2, []string{"b.ts"})
+
+	// Test
+	all := s.History(state.HistoryQuery{})
+	failed := s.History(state.HistoryQuery{Status: state.RecordingStatusFailed})
+	limited := s.History(state.HistoryQuery{Limit: 1})
+
+	// Assert
+	require.Len(t, all, 2)
+	require.Equal(t, id2, all[0].ID)
+	require.Equal(t, []string{"a.mp4"}, all[1].Files)
+	require.NotNil(t, all[1].EndTime)
+	require.Len(t, failed, 1)
+	require.Equal(t, "failure", failed[0].Error)
+	require.Equal(t, []string{"b.ts"}, failed[0].Files)
+	require.Len(t, limited, 1)
+	require.Equal(t, id2, limited[0].ID)
+}
+
+func TestPersist(t *testing.T) {
+	// Arrange
+	filename := filepath.Join(t.TempDir(), "state.json")
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	require.NoError(t, s.Persist(filename, state.WithMaxHistory(2), state.WithMaxErrors(1)))
+	s.SetChannelState("test", state.DownloadStateDownloading)
+	s.SetChannelError("test", errors.New("error1"))
+	s.SetChannelError("test", errors.New("error2"))
+	id := s.StartRecording("test", "first", nil)
+	s.FinishRecording(id, state.RecordingStatusFinished, []string{"first.mp4"}, nil)
+	s.StartRecording("test", "second", nil)
+	s.StartRecording("test", "third", nil)
+
+	// Test
+	reloaded := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	err := reloaded.Persist(filename)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, state.DownloadStateUnspecified, reloaded.GetChannelState("test"))
+	errs := reloaded.ReadState().Channels["test"].Errors
+	require.Len(t, errs, 1)
+	require.Equal(t, "error2", errs[0].Error)
+	history := reloaded.History(state.HistoryQuery{})
+	require.Len(t, history, 2)
+	require.Equal(t, "third", history[0].Title)
+	require.Equal(t, state.RecordingStatusInterrupted, history[0].Status)
+	require.Equal(t, "second", history[1].Title)
+}
@@ -0,0 +1,145 @@
+package state
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Job represents a post-processing job.
+type Job struct {
+	ID        string  `json:"id"`
+	ChannelID string  `json:"channel_id"`
+	Kind      JobKind `json:"kind"`
+	// Input is the file to remux, or the prefix of the files to concatenate.
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// Format is the format of the concatenated file.
+	Format string `json:"format,omitempty"`
+	// AudioOnly keeps only the audio of the concatenated files.
+	AudioOnly bool `json:"audio_only,omitempty"`
+	// EmbedChat muxes the chat of the inputs as a subtitle track.
+	EmbedChat bool `json:"embed_chat,omitempty"`
+	// Chapters writes the chapters of the inputs, from their timeline.
+	Chapters bool `json:"chapters,omitempty"`
+	// Recording is the recording which ended with the job, and RecordingStart
+	// the start of its video timeline, used to align its chat and its
+	// timeline. The report of a resumed recording only covers the last run.
+	Recording      string    `json:"recording,omitempty"`
+	RecordingStart time.Time `json:"recording_start,omitzero"`
+	// Destination is where the output is moved once done. Empty means the
+	// output is not moved.
+	Destination string `json:"destination,omitempty"`
+	// RecordingID is the recording of the history whose files are set by a
+	// finish job.
+	RecordingID string `json:"recording_id,omitempty"`
+	// Intermediates are the files deleted by a finish job. They are kept if a
+	// previous job of the chain failed.
+	Intermediates []string `json:"intermediates,omitempty"`
+	// Files are the files of the recording, moved by a finish job to their
+	// final name, if any. The files which don't exist are skipped.
+	Files      []string          `json:"files,omitempty"`
+	FinalNames map[string]string `json:"final_names,omitempty"`
+	// Labels, Metadata and Report are sent in the finished notification by a
+	// finish job. Empty Metadata means no notification.
+	Labels   map[string]string `json:"labels,omitempty"`
+	Metadata json.RawMessage   `json:"metadata,omitempty"`
+	Report   json.RawMessage   `json:"report,omitempty"`
+	// Then are the jobs run one after the other once the job is done, even if
+	// it failed.
+	Then      []Job     `json:"then,omitempty"`
+	Status    JobStatus `json:"status"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobKind is the kind of a Job.
+type JobKind string
+
+const (
+	// JobKindRemux remuxes a recording.
+	JobKindRemux JobKind = "remux"
+	// JobKindExtractAudio extracts the audio of a recording.
+	JobKindExtractAudio JobKind = "extract_audio"
+	// JobKindConcat concatenates the recordings with the same prefix.
+	JobKindConcat JobKind = "concat"
+	// JobKindFinish deletes the intermediates of a recording, moves its files
+	// out of the scratch directory and notifies that it is finished.
+	JobKindFinish JobKind = "finish"
+)
+
+// JobStatus represents the status of a Job.
+type JobStatus int
+
+const (
+	// JobStatusUnspecified is used when the job status is unspecified.
+	JobStatusUnspecified JobStatus = iota
+	// JobStatusQueued is used when the job waits for a worker.
+	JobStatusQueued
+	// JobStatusRunning is used when the job is running.
+	JobStatusRunning
+	// JobStatusFailed is used when the job finished with an error. It can be retried.
+	JobStatusFailed
+)
+
+// String returns a string representation of a JobStatus.
+func (j JobStatus) String() string {
+	switch j {
+	case JobStatusUnspecified:
+		return "UNSPECIFIED"
+	case JobStatusQueued:
+		return "QUEUED"
+	case JobStatusRunning:
+		return "RUNNING"
+	case JobStatusFailed:
+		return "FAILED"
+	}
+	return "UNSPECIFIED"
+}
+
+// JobStatusFromString returns a JobStatus from a string.
+func JobStatusFromString(s string) JobStatus {
+	switch s {
+	default:
+		return JobStatusUnspecified
+	case "QUEUED":
+		return JobStatusQueued
+	case "RUNNING":
+		return JobStatusRunning
+	case "FAILED":
+		return JobStatusFailed
+	}
+}
+
+// MarshalJSON marshals a JobStatus into a string.
+func (j JobStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.String())
+}
+
+// UnmarshalJSON unmarshals a string into a JobStatus.
+func (j *JobStatus) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	*j = JobStatusFromString(s)
+
+	return nil
+}
+
+// SetJobs replaces the pending post-processing jobs.
+func (s *State) SetJobs(jobs []Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Jobs = slices.Clone(jobs)
+}
+
+// GetJobs returns the pending post-processing jobs.
+func (s *State) GetJobs() []Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Jobs)
+}
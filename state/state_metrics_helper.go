@@ -15,11 +15,7 @@ func setStateMetrics(
 	state DownloadState,
 	labels map[string]string,
 ) {
-	attrs := make([]attribute.KeyValue, 0, len(labels)+1)
-	attrs = append(attrs, attribute.String("channel_id", channelID))
-	for k, v := range labels {
-		attrs = append(attrs, attribute.String(k, v))
-	}
+	attrs := stateMetricsAttributes(channelID, labels)
 	m := metrics.Watcher.State
 	m.Record(
 		ctx,
@@ -27,7 +23,7 @@ func setStateMetrics(
 		metric.WithAttributes(append(attrs, attribute.String("state", state.String()))...),
 	)
 	// Remove the rest of the states from the metrics.
-	for i := DownloadStateUnspecified; i <= DownloadStateCanceled; i++ {
+	for i := DownloadStateUnspecified; i <= DownloadStatePaused; i++ {
 		if i != state {
 			m.Record(
 				ctx,
@@ -37,3 +33,52 @@ func setStateMetrics(
 		}
 	}
 }
+
+// clearStateMetrics removes all the states of a channel from the metrics.
+func clearStateMetrics(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+) {
+	attrs := stateMetricsAttributes(channelID, labels)
+	for i := DownloadStateUnspecified; i <= DownloadStatePaused; i++ {
+		metrics.Watcher.State.Record(
+			ctx,
+			0,
+			metric.WithAttributes(append(attrs, attribute.String("state", i.String()))...),
+		)
+	}
+}
+
+// setLiveMetrics records the number of viewers of the live stream.
+//
+// The title is not recorded in the metrics since its values are unbounded. It
+// is exposed in the state and in the events.
+func setLiveMetrics(
+	ctx context.Context,
+	channelID string,
+	viewers int64,
+	labels map[string]string,
+) {
+	attrs := stateMetricsAttributes(channelID, labels)
+	metrics.Watcher.Viewers.Record(ctx, viewers, metric.WithAttributes(attrs...))
+}
+
+// clearLiveMetrics removes the live stream of a channel from the metrics.
+func clearLiveMetrics(
+	ctx context.Context,
+	channelID string,
+	labels map[string]string,
+) {
+	attrs := stateMetricsAttributes(channelID, labels)
+	metrics.Watcher.Viewers.Record(ctx, 0, metric.WithAttributes(attrs...))
+}
+
+func stateMetricsAttributes(channelID string, labels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(labels)+2)
+	attrs = append(attrs, attribute.String("channel_id", channelID))
+	for k, v := range labels {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	return attrs
+}
@@ -0,0 +1,213 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// errorTimestampLayout is the layout of DownloadError.Timestamp.
+const errorTimestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// PersistOption is an option for Persist.
+type PersistOption func(*persistOptions)
+
+type persistOptions struct {
+	maxHistory int
+	maxErrors  int
+	maxAge     time.Duration
+}
+
+// WithMaxHistory sets the maximum number of recordings kept in the history.
+//
+// A zero value means no limit.
+func WithMaxHistory(n int) PersistOption {
+	return func(o *persistOptions) {
+		o.maxHistory = n
+	}
+}
+
+// WithMaxErrors sets the maximum number of errors kept per channel.
+//
+// A zero value means no limit.
+func WithMaxErrors(n int) PersistOption {
+	return func(o *persistOptions) {
+		o.maxErrors = n
+	}
+}
+
+// WithMaxAge sets the maximum age of the recordings and the errors.
+//
+// A zero value means no limit.
+func WithMaxAge(d time.Duration) PersistOption {
+	return func(o *persistOptions) {
+		o.maxAge = d
+	}
+}
+
+type store struct {
+	filename string
+	opts     *persistOptions
+	// pending is the state encoded by saveLocked, not written yet. It is
+	// guarded by State.mu.
+	pending []byte
+	// writeMu serializes the writes of the file.
+	writeMu sync.Mutex
+}
+
+// persistedState is the content of the state file.
+type persistedState struct {
+	Channels map[string]*ChannelState `json:"channels"`
+	History  []Recording              `json:"history"`
+}
+
+// Persist loads the state from the file, then saves the state in the file on
+// every new error and recording.
+//
+// Recordings which were not finished are marked as interrupted.
+func (s *State) Persist(filename string, opts ...PersistOption) error {
+	o := &persistOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var loaded persistedState
+	b, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot read %s: %w", filename, err)
+	} else if err == nil {
+		if err := json.Unmarshal(b, &loaded); err != nil {
+			return fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+	}
+
+	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Channels == nil {
+		s.Channels = make(map[string]*ChannelState)
+	}
+	for name, c := range loaded.Channels {
+		if c == nil || len(c.Errors) == 0 {
+			continue
+		}
+		current, ok := s.Channels[name]
+		if !ok {
+			// The download state is from the previous run and is outdated.
+			s.Channels[name] = &ChannelState{
+				Labels: c.Labels,
+				Errors: c.Errors,
+			}
+			continue
+		}
+		current.Errors = append(c.Errors, current.Errors...)
+	}
+	for i := range loaded.History {
+		if loaded.History[i].Status == RecordingStatusRecording {
+			loaded.History[i].Status = RecordingStatusInterrupted
+		}
+	}
+	s.history = append(loaded.History, s.history...)
+
+	s.store = &store{
+		filename: filename,
+		opts:     o,
+	}
+	s.saveLocked()
+	return nil
+}
+
+// pruneLocked removes the recordings and the errors exceeding the retention.
+//
+// The slices are replaced instead of filtered in place, since they can be
+// shared with a snapshot.
+func (s *State) pruneLocked(now time.Time) {
+	o := s.store.opts
+	if o.maxAge > 0 {
+		limit := now.Add(-o.maxAge)
+		history := make([]Recording, 0, len(s.history))
+		for _, r := range s.history {
+			if r.EndTime != nil && r.EndTime.Before(limit) {
+				continue
+			}
+			history = append(history, r)
+		}
+		s.history = history
+
+		for _, c := range s.Channels {
+			errs := make([]DownloadError, 0, len(c.Errors))
+			for _, e := range c.Errors {
+				t, err := time.Parse(errorTimestampLayout, e.Timestamp)
+				if err == nil && t.Before(limit) {
+					continue
+				}
+				errs = append(errs, e)
+			}
+			c.Errors = errs
+		}
+	}
+	if o.maxHistory > 0 && len(s.history) > o.maxHistory {
+		s.history = slices.Clone(s.history[len(s.history)-o.maxHistory:])
+	}
+	if o.maxErrors > 0 {
+		for _, c := range s.Channels {
+			if len(c.Errors) > o.maxErrors {
+				c.Errors = slices.Clone(c.Errors[len(c.Errors)-o.maxErrors:])
+			}
+		}
+	}
+}
+
+// saveLocked prunes and encodes the state, if persisted.
+//
+// The state is written by flush, which must be called once the lock is
+// released.
+func (s *State) saveLocked() {
+	if s.store == nil {
+		return
+	}
+	s.pruneLocked(time.Now())
+
+	b, err := json.Marshal(persistedState{
+		Channels: s.Channels,
+		History:  s.history,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to encode state")
+		return
+	}
+	s.store.pending = b
+}
+
+// flush writes the last state encoded by saveLocked in the file, if any.
+//
+// The concurrent saves are coalesced: only the most recent state is written.
+func (s *State) flush() {
+	s.mu.RLock()
+	st := s.store
+	s.mu.RUnlock()
+	if st == nil {
+		return
+	}
+
+	st.writeMu.Lock()
+	defer st.writeMu.Unlock()
+	s.mu.Lock()
+	b := st.pending
+	st.pending = nil
+	s.mu.Unlock()
+	if b == nil {
+		// Already written by a concurrent flush.
+		return
+	}
+	if err := utils.WriteFileAtomic(st.filename, b); err != nil {
+		log.Err(err).Str("file", st.filename).Msg("failed to save state")
+	}
+}
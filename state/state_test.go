@@ -1,7 +1,10 @@
 package state_test
 
 import (
+	"encoding/json"
 	"errors"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/Darkness4/fc2-live-dl-go/state"
@@ -44,3 +47,78 @@ func TestSetChannelError(t *testing.T) {
 	require.Equal(t, "error1", state.ReadState().Channels["test"].Errors[0].Error)
 	require.Equal(t, "error2", state.ReadState().Channels["test"].Errors[1].Error)
 }
+
+func TestDeleteChannelState(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	s.SetChannelState("test", state.DownloadStateIdle)
+
+	// Test
+	s.DeleteChannelState("test")
+	s.DeleteChannelState("unknown")
+
+	// Assert
+	require.Equal(t, state.DownloadStateUnspecified, s.GetChannelState("test"))
+	require.NotContains(t, s.ReadState().Channels, "test")
+}
+
+func TestSetChannelLive(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	s.SetChannelState("test", state.DownloadStateDownloading)
+	events, unsubscribe := s.Subscribe(10)
+	defer unsubscribe()
+
+	// Test
+	s.SetChannelLive("test", "title", 42)
+	s.SetChannelLive("test", "title", 42)
+	live := *s.Channels["test"]
+	s.SetChannelState("test", state.DownloadStatePostProcessing)
+
+	// Assert
+	require.Equal(t, "title", live.Title)
+	require.Equal(t, int64(42), live.Viewers)
+	e := <-events
+	require.Equal(t, state.EventTypeLive, e.Type)
+	require.Equal(t, "title", e.Title)
+	require.Equal(t, int64(42), e.Viewers)
+	e = <-events
+	require.Equal(t, state.EventTypeState, e.Type, "unchanged live information should not be published")
+	require.Empty(t, s.Channels["test"].Title)
+	require.Zero(t, s.Channels["test"].Viewers)
+}
+
+func TestReadState(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	require.NoError(t, s.Persist(
+		filepath.Join(t.TempDir(), "state.json"),
+		state.WithMaxErrors(1),
+	))
+	s.SetChannelState("test", state.DownloadStateDownloading)
+	s.SetChannelError("test", errors.New("error1"))
+
+	// Test
+	snapshot := s.ReadState()
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		// The errors are pruned while the snapshot is encoded.
+		s.SetChannelError("test", errors.New("error2"))
+		s.SetChannelState("test", state.DownloadStateIdle)
+	})
+	_, err := json.Marshal(snapshot)
+	wg.Wait()
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, state.DownloadStateDownloading, snapshot.Channels["test"].DownloadState)
+	require.Len(t, snapshot.Channels["test"].Errors, 1)
+	require.Equal(t, "error1", snapshot.Channels["test"].Errors[0].Error)
+	require.Equal(t, "error2", s.ReadState().Channels["test"].Errors[0].Error)
+}
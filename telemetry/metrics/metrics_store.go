@@ -47,6 +47,9 @@ var (
 	Watcher struct {
 		// State is the current state of the watcher.
 		State metric.Int64Gauge
+		// Viewers is the current number of viewers of the live stream being
+		// downloaded.
+		Viewers metric.Int64Gauge
 	}
 
 	// Cleaner metrics.
@@ -160,6 +163,13 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	Watcher.Viewers, err = meter.Int64Gauge(
+		"watcher.viewers",
+		metric.WithDescription("Current number of viewers of the live stream being downloaded"),
+	)
+	if err != nil {
+		panic(err)
+	}
 
 	// Cleaner
 	Cleaner.FilesRemoved, err = meter.Int64Counter(
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// partSuffix marks the files which are still being written.
+const partSuffix = ".part"
+
+// PartName returns the name of the file while it is being written.
+//
+// The suffix is inserted before the extension so that ffmpeg can still guess
+// the format: "video.mp4" becomes "video.part.mp4".
+func PartName(name string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + partSuffix + ext
+}
+
+// IsPartName returns true if the file is still being written or was left
+// behind by a crash.
+func IsPartName(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == partSuffix || strings.HasSuffix(strings.TrimSuffix(name, ext), partSuffix)
+}
+
+// FinalName returns the name of the file once finalized. It is the inverse of
+// PartName.
+func FinalName(part string) string {
+	ext := filepath.Ext(part)
+	if ext == partSuffix {
+		return strings.TrimSuffix(part, partSuffix)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(part, ext), partSuffix) + ext
+}
+
+// FinalizePart flushes the file to the disk and renames it atomically to its
+// final name.
+func FinalizePart(part string, name string) error {
+	f, err := os.OpenFile(part, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, name); err != nil {
+		return err
+	}
+	// Persist the rename. This is not supported on every platform.
+	if d, err := os.Open(filepath.Dir(name)); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+// WriteFileAtomic writes the data under the .part name of the file, then
+// finalizes it, so that a crash cannot leave a truncated file.
+//
+// The parent directory is created if needed.
+func WriteFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	part := PartName(name)
+	if err := os.WriteFile(part, data, 0o644); err != nil {
+		return err
+	}
+	return FinalizePart(part, name)
+}
+
+// MoveFile moves the file to its destination, which can be on another
+// filesystem.
+//
+// If the file cannot be renamed, it is copied under the .part name of the
+// destination, finalized, then removed.
+func MoveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	part := PartName(dst)
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(part)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(part)
+		return err
+	}
+	if err := FinalizePart(part, dst); err != nil {
+		return err
+	}
+	_ = in.Close()
+	return os.Remove(src)
+}
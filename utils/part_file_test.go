@@ -0,0 +1,99 @@
+//go:build unit
+
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/fc2-live-dl-go/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		title    string
+	}{
+		{
+			input:    "dir/video.mp4",
+			expected: "dir/video.part.mp4",
+			title:    "Positive test",
+		},
+		{
+			input:    "dir/video.fc2chat.json",
+			expected: "dir/video.fc2chat.part.json",
+			title:    "Multiple extensions",
+		},
+		{
+			input:    "dir/video",
+			expected: "dir/video.part",
+			title:    "No extension",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Act
+			actual := utils.PartName(tt.input)
+
+			// Assert
+			require.Equal(t, tt.expected, actual)
+			require.True(t, utils.IsPartName(actual))
+			require.False(t, utils.IsPartName(tt.input))
+			require.Equal(t, tt.input, utils.FinalName(actual))
+		})
+	}
+}
+
+func TestFinalizePart(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	name := filepath.Join(dir, "video.ts")
+	part := utils.PartName(name)
+	require.NoError(t, os.WriteFile(part, []byte("data"), 0o644))
+
+	// Act
+	err := utils.FinalizePart(part, name)
+
+	// Assert
+	require.NoError(t, err)
+	require.NoFileExists(t, part)
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(b))
+}
+
+func TestMoveFile(t *testing.T) {
+	// Arrange
+	src := filepath.Join(t.TempDir(), "video.mp4")
+	dst := filepath.Join(t.TempDir(), "video.mp4")
+	require.NoError(t, os.WriteFile(src, []byte("data"), 0o644))
+
+	// Act
+	err := utils.MoveFile(src, dst)
+
+	// Assert
+	require.NoError(t, err)
+	require.NoFileExists(t, src)
+	b, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(b))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	// Arrange
+	name := filepath.Join(t.TempDir(), "dir", "state.json")
+
+	// Act
+	err := utils.WriteFileAtomic(name, []byte("data"))
+
+	// Assert
+	require.NoError(t, err)
+	require.NoFileExists(t, utils.PartName(name))
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(b))
+}
@@ -3,6 +3,7 @@
 
 #include "arena.h"
 #include <inttypes.h>
+#include <libavcodec/avcodec.h>
 #include <libavformat/avformat.h>
 #include <libavutil/avutil.h>
 #include <libavutil/log.h>
@@ -77,8 +78,216 @@ void fix_ts(int64_t *dts_offset, int64_t **prev_dts, int64_t **prev_duration,
   pkt->pos = -1;
 }
 
+#define SUBTITLE_BUFFER_SIZE (64 * 1024)
+
+static const AVRational ms_time_base = {1, 1000};
+
+/**
+ * Open the subtitle encoder and add the subtitle stream to the output.
+ *
+ * The track is skipped if the output format does not support its codec.
+ */
+int open_subtitle_stream(AVFormatContext *ofmt_ctx,
+                         const subtitle_track *subtitles,
+                         AVCodecContext **enc_ctx, AVStream **out_stream) {
+  int ret;
+
+  if (avformat_query_codec(ofmt_ctx->oformat, subtitles->codec_id,
+                           FF_COMPLIANCE_NORMAL) != 1) {
+    fprintf(stderr,
+            "Output format %s does not support %s subtitles, skipping "
+            "subtitles\n",
+            ofmt_ctx->oformat->name, avcodec_get_name(subtitles->codec_id));
+    return 0;
+  }
+
+  const AVCodec *enc = avcodec_find_encoder(subtitles->codec_id);
+  if (!enc) {
+    fprintf(stderr, "Could not find %s encoder, skipping subtitles\n",
+            avcodec_get_name(subtitles->codec_id));
+    return 0;
+  }
+
+  *enc_ctx = avcodec_alloc_context3(enc);
+  if (!*enc_ctx) {
+    return AVERROR(ENOMEM);
+  }
+  (*enc_ctx)->time_base = ms_time_base;
+  // The header is freed with the encoder context.
+  (*enc_ctx)->subtitle_header = (uint8_t *)av_strdup(subtitles->header);
+  if (!(*enc_ctx)->subtitle_header) {
+    return AVERROR(ENOMEM);
+  }
+  (*enc_ctx)->subtitle_header_size = strlen(subtitles->header);
+
+  if ((ret = avcodec_open2(*enc_ctx, enc, NULL)) < 0) {
+    fprintf(stderr, "Could not open %s encoder: %s\n",
+            avcodec_get_name(subtitles->codec_id), av_err2str(ret));
+    return ret;
+  }
+
+  *out_stream = avformat_new_stream(ofmt_ctx, NULL);
+  if (!*out_stream) {
+    fprintf(stderr, "Failed allocating subtitle stream\n");
+    return AVERROR_UNKNOWN;
+  }
+  if ((ret = avcodec_parameters_from_context((*out_stream)->codecpar,
+                                             *enc_ctx)) < 0) {
+    fprintf(stderr, "Failed to copy subtitle codec parameters: %s\n",
+            av_err2str(ret));
+    return ret;
+  }
+  (*out_stream)->time_base = ms_time_base;
+
+  fprintf(stderr, "Created output stream (%s, %zu events)\n",
+          av_get_media_type_string((*out_stream)->codecpar->codec_type),
+          subtitles->events_count);
+
+  return 0;
+}
+
+/**
+ * Write the subtitle events of the input starting before until (in
+ * milliseconds, in the output).
+ *
+ * The remaining events of the previous inputs start after the end of their
+ * input and are dropped.
+ */
+int write_subtitles(AVFormatContext *ofmt_ctx, AVCodecContext *enc_ctx,
+                    AVStream *out_stream, const subtitle_track *subtitles,
+                    size_t *next_event, size_t input_idx, int64_t input_offset,
+                    int64_t until, int64_t *last_dts, uint8_t *buf,
+                    AVPacket *pkt) {
+  int ret;
+
+  for (; *next_event < subtitles->events_count; (*next_event)++) {
+    const subtitle_event *event = &subtitles->events[*next_event];
+    if (event->input_idx < input_idx) {
+      continue;
+    }
+    if (event->input_idx > input_idx) {
+      break;
+    }
+
+    int64_t start = input_offset + event->start;
+    if (start > until) {
+      break;
+    }
+    // The timestamps must be strictly increasing.
+    if (*last_dts != AV_NOPTS_VALUE && start <= *last_dts) {
+      start = *last_dts + 1;
+    }
+    int64_t duration = FFMAX(event->end - event->start, 1);
+
+    AVSubtitleRect rect = {
+        .type = SUBTITLE_ASS,
+        .ass = (char *)event->dialogue,
+    };
+    AVSubtitleRect *rects[] = {&rect};
+    AVSubtitle sub = {
+        .num_rects = 1,
+        .rects = rects,
+        .start_display_time = 0,
+        .end_display_time = (uint32_t)duration,
+        .pts = av_rescale_q(start, ms_time_base, AV_TIME_BASE_Q),
+    };
+
+    int size = avcodec_encode_subtitle(enc_ctx, buf, SUBTITLE_BUFFER_SIZE, &sub);
+    if (size < 0) {
+      fprintf(stderr, "Failed to encode subtitle event #%zu: %s, skipping\n",
+              *next_event, av_err2str(size));
+      continue;
+    }
+
+    if ((ret = av_new_packet(pkt, size)) < 0) {
+      return ret;
+    }
+    memcpy(pkt->data, buf, size);
+    pkt->stream_index = out_stream->index;
+    pkt->pts = av_rescale_q(start, ms_time_base, out_stream->time_base);
+    pkt->dts = pkt->pts;
+    pkt->duration =
+        av_rescale_q(duration, ms_time_base, out_stream->time_base);
+    pkt->pos = -1;
+    *last_dts = start;
+
+    if ((ret = av_interleaved_write_frame(ofmt_ctx, pkt)) < 0) {
+      fprintf(stderr, "Error writing subtitle packet to output file: %s\n",
+              av_err2str(ret));
+      return ret;
+    }
+  }
+
+  return 0;
+}
+
+/**
+ * Add the chapters to the output, shifted by the start of their input.
+ *
+ * The chapters are added once all the inputs are written, since the start of
+ * the inputs is unknown before. The MKV and MP4 muxers write them with the
+ * trailer. The chapters starting after the end of their input are dropped.
+ */
+int add_chapters(AVFormatContext *ofmt_ctx, const chapter *chapters,
+                 size_t chapters_count, size_t input_files_count,
+                 const int64_t *input_offsets, const int64_t *input_ends) {
+  AVChapter *prev = NULL;
+  int ret;
+
+  for (size_t i = 0; i < chapters_count; i++) {
+    const chapter *c = &chapters[i];
+    if (c->input_idx >= input_files_count) {
+      continue;
+    }
+    int64_t start = input_offsets[c->input_idx] + FFMAX(c->start, 0);
+    if (c->start > 0 && start >= input_ends[c->input_idx]) {
+      continue;
+    }
+    // The chapters must not overlap.
+    if (prev && start <= prev->start) {
+      continue;
+    }
+
+    AVChapter *out_chapter = av_mallocz(sizeof(*out_chapter));
+    if (!out_chapter) {
+      return AVERROR(ENOMEM);
+    }
+    out_chapter->id = ofmt_ctx->nb_chapters + 1;
+    out_chapter->time_base = ms_time_base;
+    out_chapter->start = start;
+    out_chapter->end = start;
+    if ((ret = av_dict_set(&out_chapter->metadata, "title", c->title, 0)) <
+        0) {
+      av_free(out_chapter);
+      return ret;
+    }
+    // The chapters are freed with the output context.
+    if ((ret = av_dynarray_add_nofree(&ofmt_ctx->chapters,
+                                      (int *)&ofmt_ctx->nb_chapters,
+                                      out_chapter)) < 0) {
+      av_dict_free(&out_chapter->metadata);
+      av_free(out_chapter);
+      return ret;
+    }
+
+    if (prev) {
+      prev->end = start;
+    }
+    prev = out_chapter;
+  }
+  if (prev) {
+    prev->end = FFMAX(input_ends[input_files_count - 1], prev->start);
+  }
+
+  fprintf(stderr, "Added %u chapters\n", ofmt_ctx->nb_chapters);
+
+  return 0;
+}
+
 int concat(void *ctx, const char *output_file, size_t input_files_count,
-           const char *input_files[], int audio_only) {
+           const char *input_files[], int audio_only,
+           const subtitle_track *subtitles, const chapter *chapters,
+           size_t chapters_count) {
   av_log_set_level(AV_LOG_ERROR);
 
   if (input_files_count == 0) {
@@ -104,6 +313,21 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
   // input_files_count*stream_mapping_size.
   int64_t **prev_dts = NULL;
   int64_t **prev_duration = NULL;
+
+  // Subtitle track, muxed with the packets of the inputs.
+  AVCodecContext *sub_enc_ctx = NULL;
+  AVStream *sub_stream = NULL;
+  AVPacket *sub_pkt = NULL;
+  uint8_t *sub_buf = NULL;
+  size_t next_event = 0;
+  // Start of the current input in the output, and end of the last packet, in
+  // milliseconds.
+  int64_t input_offset = 0;
+  int64_t last_end = 0;
+  int64_t last_sub_dts = AV_NOPTS_VALUE;
+  // Start and end of each input in the output, in milliseconds.
+  int64_t *input_offsets = NULL;
+  int64_t *input_ends = NULL;
   int ret;
 
   // Alloc arrays
@@ -131,6 +355,18 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
     goto end;
   }
 
+  input_offsets =
+      arena_alloc(&arena, input_files_count * sizeof(*input_offsets));
+  if (!input_offsets) {
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+  input_ends = arena_alloc(&arena, input_files_count * sizeof(*input_ends));
+  if (!input_ends) {
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+
   pkt = av_packet_alloc();
   if (!pkt) {
     fprintf(stderr, "Could not allocate AVPacket\n");
@@ -150,6 +386,8 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
     const char *input_file = input_files[input_idx];
     span = goTraceProcessInputStart(ctx, input_idx, (char *)input_file);
     int stream_index = 0;
+    input_offset = last_end;
+    input_offsets[input_idx] = input_offset;
 
     if ((ret = avformat_open_input(&ifmt_ctx, input_file, 0, 0)) < 0) {
       fprintf(stderr, "Could not open input file '%s': %s, aborting...\n",
@@ -280,6 +518,21 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
     }
 
     if (input_idx == 0) {
+      if (subtitles && subtitles->events_count > 0 && audio_only == 0) {
+        if ((ret = open_subtitle_stream(ofmt_ctx, subtitles, &sub_enc_ctx,
+                                        &sub_stream)) < 0) {
+          goto end;
+        }
+        if (sub_stream) {
+          sub_pkt = av_packet_alloc();
+          sub_buf = av_malloc(SUBTITLE_BUFFER_SIZE);
+          if (!sub_pkt || !sub_buf) {
+            ret = AVERROR(ENOMEM);
+            goto end;
+          }
+        }
+      }
+
       av_dump_format(ofmt_ctx, input_idx, output_file, 1);
 
       if (!(ofmt_ctx->oformat->flags & AVFMT_NOFILE)) {
@@ -328,6 +581,22 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
 
       fix_ts(dts_offset, prev_dts, prev_duration, input_idx, pkt);
 
+      last_end =
+          FFMAX(last_end, av_rescale_q(pkt->dts + FFMAX(pkt->duration, 0),
+                                       out_stream->time_base, ms_time_base));
+
+      // Interleave the subtitles with the packets.
+      if (sub_stream) {
+        if ((ret = write_subtitles(
+                 ofmt_ctx, sub_enc_ctx, sub_stream, subtitles, &next_event,
+                 input_idx, input_offset,
+                 av_rescale_q(pkt->dts, out_stream->time_base, ms_time_base),
+                 &last_sub_dts, sub_buf, sub_pkt)) < 0) {
+          av_packet_unref(pkt);
+          break;
+        }
+      }
+
       ret = av_interleaved_write_frame(ofmt_ctx, pkt);
       /* pkt is now blank (av_interleaved_write_frame() takes ownership of
        * its contents and resets pkt), so that no unreferencing is
@@ -339,10 +608,31 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
       }
     } // while packets.
 
+    // The events until the end of the input.
+    if (sub_stream && (ret == AVERROR_EOF || ret >= 0)) {
+      if ((ret = write_subtitles(ofmt_ctx, sub_enc_ctx, sub_stream, subtitles,
+                                 &next_event, input_idx, input_offset,
+                                 last_end, &last_sub_dts, sub_buf,
+                                 sub_pkt)) < 0) {
+        goto end;
+      }
+    }
+
+    input_ends[input_idx] = last_end;
+
     goTraceProcessInputEnd(span);
     avformat_close_input(&ifmt_ctx);
   } // for each inputs.
 
+  if (chapters && chapters_count > 0 && (ret == AVERROR_EOF || ret >= 0)) {
+    if ((ret = add_chapters(ofmt_ctx, chapters, chapters_count,
+                            input_files_count, input_offsets, input_ends)) <
+        0) {
+      fprintf(stderr, "Failed to add chapters: %s\n", av_err2str(ret));
+      goto end;
+    }
+  }
+
   // Write output file trailer
   av_write_trailer(ofmt_ctx);
 
@@ -351,6 +641,15 @@ end:
   if (pkt)
     av_packet_free(&pkt);
 
+  if (sub_pkt)
+    av_packet_free(&sub_pkt);
+
+  if (sub_buf)
+    av_free(sub_buf);
+
+  if (sub_enc_ctx)
+    avcodec_free_context(&sub_enc_ctx);
+
   if (ifmt_ctx) {
     goTraceProcessInputEnd(span);
     avformat_close_input(&ifmt_ctx);
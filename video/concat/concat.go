@@ -7,6 +7,7 @@ package concat
 
 #include <stddef.h>
 #include <stdlib.h>
+#include <libavcodec/avcodec.h>
 #include <libavutil/common.h>
 */
 import "C"
@@ -16,6 +17,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,6 +25,7 @@ import (
 	"unsafe"
 
 	"github.com/Darkness4/fc2-live-dl-go/telemetry/metrics"
+	"github.com/Darkness4/fc2-live-dl-go/utils"
 	"github.com/Darkness4/fc2-live-dl-go/video/probe"
 	"github.com/gabriel-vasile/mimetype"
 	gopointer "github.com/mattn/go-pointer"
@@ -59,8 +62,11 @@ type Option func(*Options)
 
 // Options are the concatenation options.
 type Options struct {
-	audioOnly int
-	numbered  bool
+	audioOnly   int
+	numbered    bool
+	subtitles   SubtitleLoader
+	chapters    ChapterLoader
+	directories []string
 }
 
 // WithAudioOnly forces the concatenation on audio only.
@@ -81,6 +87,48 @@ func IgnoreExtension() Option {
 	}
 }
 
+// WithSubtitles muxes the subtitles of the inputs as a subtitle track: ASS in
+// MKV, timed text (mov_text) in MP4.
+//
+// The events of each input are shifted by the start of the input in the
+// output. The other containers and the audio-only outputs have no subtitle
+// track.
+func WithSubtitles(loader SubtitleLoader) Option {
+	return func(o *Options) {
+		o.subtitles = loader
+	}
+}
+
+// WithChapters adds chapters to the output: one at the start of each input,
+// and one per chapter of the inputs.
+//
+// The chapters of each input are shifted by the start of the input in the
+// output. An output with a single chapter has no chapters.
+func WithChapters(loader ChapterLoader) Option {
+	return func(o *Options) {
+		o.chapters = loader
+	}
+}
+
+// WithDirectories also looks for the inputs of WithPrefix in the directories,
+// for example the recordings moved out of a scratch directory.
+//
+// On conflict, the inputs of the directory of the prefix are selected first.
+func WithDirectories(dirs ...string) Option {
+	return func(o *Options) {
+		o.directories = append(o.directories, dirs...)
+	}
+}
+
+// withoutMetadata removes the subtitles and the chapters, which are added
+// from the original inputs.
+func withoutMetadata() Option {
+	return func(o *Options) {
+		o.subtitles = nil
+		o.chapters = nil
+	}
+}
+
 func applyOptions(opts []Option) *Options {
 	o := &Options{}
 	for _, opt := range opts {
@@ -114,6 +162,8 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 	attrs = append(attrs, attribute.String("output", output))
 	attrs = append(attrs, attribute.Bool("audio_only", o.audioOnly == 1))
 	attrs = append(attrs, attribute.Bool("numbered", o.numbered))
+	attrs = append(attrs, attribute.Bool("subtitles", o.subtitles != nil))
+	attrs = append(attrs, attribute.Bool("chapters", o.chapters != nil))
 
 	ctx, span := otel.Tracer(tracerName).
 		Start(ctx, "concat.Do", trace.WithAttributes(attrs...))
@@ -133,10 +183,37 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 
 	log.Info().Str("output", output).Strs("inputs", inputs).Any("options", o).Msg("concat")
 
+	// The subtitles and the chapters are loaded from the original inputs, before
+	// remuxing them.
+	var subtitles *C.subtitle_track
+	if o.subtitles != nil && o.audioOnly == 0 {
+		if codec, ok := subtitleCodecOf(output); ok {
+			header, events := loadSubtitles(validInputs, codec, o.subtitles)
+			if len(events) > 0 {
+				var free func()
+				subtitles, free = newCSubtitleTrack(codec, header, events)
+				defer free()
+			}
+		} else {
+			log.Warn().Str("output", output).Msg("the container does not support subtitles, skipping subtitles")
+		}
+	}
+
+	var cChapters *C.chapter
+	var chaptersCount int
+	if o.chapters != nil {
+		if chapters := loadChapters(validInputs, o.chapters); len(chapters) > 1 {
+			var free func()
+			cChapters, free = newCChapters(chapters)
+			defer free()
+			chaptersCount = len(chapters)
+		}
+	}
+
 	// If mixed formats (adts vs asc), we should remux the others first using intermediates or FIFO
 	if areFormatMixed(validInputs) {
 		log.Warn().Msg("mixed formats detected, using intermediates or FIFO to remux files first")
-		i, useFIFO, err := remuxMixedTS(ctx, validInputs, opts...)
+		i, useFIFO, err := remuxMixedTS(ctx, validInputs, append(slices.Clone(opts), withoutMetadata())...)
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
@@ -174,13 +251,23 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 	ctxp := gopointer.Save(&ctx)
 	defer gopointer.Unref(ctxp)
 
-	cOutput := C.CString(output)
+	// The output is written under a .part name and renamed once complete, so
+	// that a crash cannot leave a truncated file with a plausible name.
+	partOutput := utils.PartName(output)
+	cOutput := C.CString(partOutput)
 	defer C.free(unsafe.Pointer(cOutput))
 
-	if err := C.concat(ctxp, cOutput, C.size_t(len(validInputs)), (**C.char)(inputsC), C.int(o.audioOnly)); err != 0 {
-		if err == C.AVERROR_EOF {
-			return nil
-		}
+	if err := C.concat(
+		ctxp,
+		cOutput,
+		C.size_t(len(validInputs)),
+		(**C.char)(inputsC),
+		C.int(o.audioOnly),
+		subtitles,
+		cChapters,
+		C.size_t(chaptersCount),
+	); err != 0 &&
+		err != C.AVERROR_EOF {
 		buf := make([]byte, C.AV_ERROR_MAX_STRING_SIZE)
 		C.av_make_error_string((*C.char)(unsafe.Pointer(&buf[0])), C.AV_ERROR_MAX_STRING_SIZE, err)
 
@@ -189,23 +276,36 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 		span.SetStatus(codes.Error, err.Error())
 		metrics.Concat.Errors.Add(ctx, 1)
 
+		if err := os.Remove(partOutput); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("file", partOutput).Msg("failed to remove partial output")
+		}
+		return err
+	}
+	if err := utils.FinalizePart(partOutput, output); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.Concat.Errors.Add(ctx, 1)
 		return err
 	}
 	return nil
 }
 
 func filterFiles(
-	names []string,
+	paths []string,
 	base string,
-	path string,
 	o *Options,
 ) ([]string, error) {
 	selectedMap := make(map[string]string)
-	for _, name := range names {
+	for _, path := range paths {
+		name := filepath.Base(path)
 		// Ignore files with "combined"
 		if strings.Contains(name, ".combined.") {
 			continue
 		}
+		// Ignore files which are still being written
+		if utils.IsPartName(name) {
+			continue
+		}
 
 		ext := filepath.Ext(name)
 		var uniqueID string
@@ -217,7 +317,7 @@ func filterFiles(
 
 		if strings.HasPrefix(name, base) {
 			if selectedMap[uniqueID] == "" {
-				selectedMap[uniqueID] = filepath.Join(path, name)
+				selectedMap[uniqueID] = path
 				continue
 			}
 
@@ -227,7 +327,7 @@ func filterFiles(
 			) > getFormatPriority(
 				strings.ToLower(filepath.Ext(selectedMap[uniqueID])),
 			) {
-				selectedMap[uniqueID] = filepath.Join(path, name)
+				selectedMap[uniqueID] = path
 			}
 		}
 	}
@@ -240,8 +340,8 @@ func filterFiles(
 	sort.Slice(selected, func(i, j int) bool {
 		a := selected[i]
 		b := selected[j]
-		orderA := extractOrderPart(base, a)
-		orderB := extractOrderPart(base, b)
+		orderA := extractOrderPart(base, filepath.Base(a))
+		orderB := extractOrderPart(base, filepath.Base(b))
 
 		// Check numeric ordering
 		valueA, errA := strconv.Atoi(orderA)
@@ -259,35 +359,31 @@ func filterFiles(
 
 // WithPrefix Concat multiple videos with a prefix.
 //
-// Prefix can be a path.
+// Prefix can be a path. The output is written next to the prefix.
 func WithPrefix(ctx context.Context, remuxFormat string, prefix string, opts ...Option) error {
 	o := applyOptions(opts)
 	path := filepath.Dir(prefix)
 	base := filepath.Base(prefix)
-	entries, err := os.ReadDir(path)
+	paths, err := listFiles(path)
 	if err != nil {
 		log.Err(err).Str("path", path).Msg("failed to read directory")
 		return err
 	}
-	names := make([]string, 0, len(entries))
-	for _, de := range entries {
-		if de.IsDir() {
+	for _, dir := range o.directories {
+		if filepath.Clean(dir) == filepath.Clean(path) {
 			continue
 		}
-		finfo, err := de.Info()
-		if err != nil {
-			log.Err(err).Str("file", de.Name()).Msg("failed to get file info")
-			continue
-		}
-		// Ignore empty files
-		if finfo.Size() == 0 {
+		more, err := listFiles(dir)
+		if errors.Is(err, os.ErrNotExist) {
 			continue
+		} else if err != nil {
+			log.Err(err).Str("path", dir).Msg("failed to read directory")
+			return err
 		}
-
-		names = append(names, de.Name())
+		paths = append(paths, more...)
 	}
 
-	selected, err := filterFiles(names, base, path, o)
+	selected, err := filterFiles(paths, base, o)
 	if err != nil {
 		log.Err(err).Msg("failed to filter files")
 		return err
@@ -324,6 +420,32 @@ func WithPrefix(ctx context.Context, remuxFormat string, prefix string, opts ...
 	return Do(ctx, prefix+".combined."+remuxFormat, validInputs, opts...)
 }
 
+// listFiles returns the paths of the non-empty files of the directory.
+func listFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(entries))
+	for _, de := range entries {
+		if de.IsDir() {
+			continue
+		}
+		finfo, err := de.Info()
+		if err != nil {
+			log.Err(err).Str("file", de.Name()).Msg("failed to get file info")
+			continue
+		}
+		// Ignore empty files
+		if finfo.Size() == 0 {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(dir, de.Name()))
+	}
+	return paths, nil
+}
+
 func areFormatMixed(files []string) bool {
 	if len(files) <= 1 {
 		return false
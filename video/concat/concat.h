@@ -2,6 +2,7 @@
 #define CONCAT_H
 
 #include <stddef.h>
+#include <stdint.h>
 
 typedef void *go_ctx;
 typedef void *go_span;
@@ -29,6 +30,48 @@ extern go_span goTraceProcessInputStart(go_ctx ctx, size_t index,
  */
 extern void goTraceProcessInputEnd(go_span span);
 
+/**
+ * A subtitle event of an input.
+ */
+typedef struct subtitle_event {
+  /** The index of the input file. */
+  size_t input_idx;
+  /** The start of the event in milliseconds, relative to the input. */
+  int64_t start;
+  /** The end of the event in milliseconds, relative to the input. */
+  int64_t end;
+  /**
+   * The ASS dialogue: ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV,
+   * Effect and Text.
+   */
+  const char *dialogue;
+} subtitle_event;
+
+/**
+ * A subtitle track, encoded and muxed with the audio and video streams.
+ */
+typedef struct subtitle_track {
+  /** The codec of the track: AV_CODEC_ID_ASS or AV_CODEC_ID_MOV_TEXT. */
+  int codec_id;
+  /** The ASS script header, with the styles of the dialogues. */
+  const char *header;
+  /** The events, sorted by input, then by start. */
+  const subtitle_event *events;
+  size_t events_count;
+} subtitle_track;
+
+/**
+ * A chapter of an input.
+ */
+typedef struct chapter {
+  /** The index of the input file. */
+  size_t input_idx;
+  /** The start of the chapter in milliseconds, relative to the input. */
+  int64_t start;
+  /** The title of the chapter. */
+  const char *title;
+} chapter;
+
 /**
  * Concat audio and video streams. Streams must be aligned and format must be
  * identical. Remux at the same time.
@@ -38,10 +81,17 @@ extern void goTraceProcessInputEnd(go_span span);
  * @param input_files_count Number of files to be treated.
  * @param output_file The output file name.
  * @param audio_only Only extract audio.
+ * @param subtitles The subtitle track to add, NULL for none. The events are
+ * shifted by the start of their input in the output.
+ * @param chapters The chapters to add, sorted by input, then by start. The
+ * chapters are shifted by the start of their input in the output.
+ * @param chapters_count Number of chapters.
  *
  * @return 0 if the conversion was successful, a negative value on error.
  */
 int concat(void *ctx, const char *output_file, size_t input_files_count,
-           const char *input_files[], int audio_only);
+           const char *input_files[], int audio_only,
+           const subtitle_track *subtitles, const chapter *chapters,
+           size_t chapters_count);
 
 #endif /* CONCAT_H */
@@ -0,0 +1,101 @@
+package concat
+
+/*
+#include "concat.h"
+
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Chapter is a chapter of an input.
+type Chapter struct {
+	// Start is the start of the chapter, relative to the start of the input.
+	Start time.Duration
+	Title string
+}
+
+// ChapterLoader returns the chapters of an input, for example the title
+// changes of a recording.
+//
+// Nil means the input has no chapters.
+type ChapterLoader func(input string) ([]Chapter, error)
+
+// inputChapter is a chapter of the input at index input.
+type inputChapter struct {
+	Chapter
+	input int
+}
+
+// loadChapters loads the chapters of the inputs.
+//
+// Each input starts with a chapter, titled from the last chapter of the input
+// starting before it, or from its position ("Part 2"). The following chapters
+// with the same title as the previous one are dropped.
+//
+// The inputs which fail to load only have their first chapter.
+func loadChapters(inputs []string, loader ChapterLoader) []inputChapter {
+	var chapters []inputChapter
+	for idx, input := range inputs {
+		loaded, err := loader(input)
+		if err != nil {
+			log.Err(err).Str("input", input).Msg("failed to load chapters, skipping")
+			loaded = nil
+		}
+		sorted := slices.SortedStableFunc(slices.Values(loaded), func(a, b Chapter) int {
+			return cmp.Compare(a.Start, b.Start)
+		})
+
+		first := inputChapter{
+			Chapter: Chapter{Title: fmt.Sprintf("Part %d", idx+1)},
+			input:   idx,
+		}
+		for len(sorted) > 0 && sorted[0].Start <= 0 {
+			first.Title = sorted[0].Title
+			sorted = sorted[1:]
+		}
+		chapters = append(chapters, first)
+
+		title := first.Title
+		for _, c := range sorted {
+			if c.Title == title {
+				continue
+			}
+			title = c.Title
+			chapters = append(chapters, inputChapter{Chapter: c, input: idx})
+		}
+	}
+	return chapters
+}
+
+// newCChapters allocates the C chapters. The chapters must be freed after use.
+func newCChapters(chapters []inputChapter) (cChapters *C.chapter, free func()) {
+	cChaptersPtr := C.malloc(C.size_t(len(chapters)) * C.size_t(unsafe.Sizeof(C.chapter{})))
+	cChaptersIndexable := unsafe.Slice((*C.chapter)(cChaptersPtr), len(chapters))
+	cStrings := make([]*C.char, 0, len(chapters))
+
+	for idx, c := range chapters {
+		cTitle := C.CString(c.Title)
+		cStrings = append(cStrings, cTitle)
+		cChaptersIndexable[idx] = C.chapter{
+			input_idx: C.size_t(c.input),
+			start:     C.int64_t(c.Start.Milliseconds()),
+			title:     cTitle,
+		}
+	}
+
+	return (*C.chapter)(cChaptersPtr), func() {
+		for _, s := range cStrings {
+			C.free(unsafe.Pointer(s))
+		}
+		C.free(cChaptersPtr)
+	}
+}
@@ -0,0 +1,165 @@
+package concat
+
+/*
+#include "concat.h"
+
+#include <stdlib.h>
+#include <libavcodec/avcodec.h>
+*/
+import "C"
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SubtitleCodec is the codec of the subtitle track, chosen from the container
+// of the output.
+type SubtitleCodec int
+
+const (
+	// SubtitleCodecASS is the ASS codec, used in MKV.
+	SubtitleCodecASS SubtitleCodec = iota + 1
+	// SubtitleCodecMovText is the timed text codec, used in MP4.
+	SubtitleCodecMovText
+)
+
+// String returns the name of the codec.
+func (c SubtitleCodec) String() string {
+	switch c {
+	case SubtitleCodecASS:
+		return "ass"
+	case SubtitleCodecMovText:
+		return "mov_text"
+	}
+	return "unknown"
+}
+
+// SubtitleEvent is a subtitle event of an input.
+type SubtitleEvent struct {
+	// Start is the start of the event, relative to the start of the input.
+	Start time.Duration
+	// End is the end of the event, relative to the start of the input.
+	End time.Duration
+	// Dialogue is the ASS dialogue without timings: Layer, Style, Name,
+	// MarginL, MarginR, MarginV, Effect and Text.
+	Dialogue string
+}
+
+// Subtitles are the subtitles of an input.
+type Subtitles struct {
+	// Header is the ASS script header, with the styles of the dialogues.
+	Header string
+	Events []SubtitleEvent
+}
+
+// SubtitleLoader returns the subtitles of an input, encoded with the codec.
+//
+// Nil means the input has no subtitles.
+type SubtitleLoader func(input string, codec SubtitleCodec) (*Subtitles, error)
+
+// subtitleCodecOf returns the subtitle codec supported by the container of the
+// output.
+func subtitleCodecOf(output string) (SubtitleCodec, bool) {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".mkv":
+		return SubtitleCodecASS, true
+	case ".mp4", ".m4v", ".mov":
+		return SubtitleCodecMovText, true
+	}
+	return 0, false
+}
+
+// inputEvent is a subtitle event of the input at index input.
+type inputEvent struct {
+	SubtitleEvent
+	input int
+}
+
+// loadSubtitles loads the subtitles of the inputs. The header is the header of
+// the first input with subtitles.
+//
+// The inputs which fail to load have no subtitles.
+func loadSubtitles(
+	inputs []string,
+	codec SubtitleCodec,
+	loader SubtitleLoader,
+) (header string, events []inputEvent) {
+	for idx, input := range inputs {
+		subs, err := loader(input, codec)
+		if err != nil {
+			log.Err(err).Str("input", input).Msg("failed to load subtitles, skipping")
+			continue
+		}
+		if subs == nil || len(subs.Events) == 0 {
+			continue
+		}
+		if header == "" {
+			header = subs.Header
+		}
+		sorted := slices.SortedStableFunc(slices.Values(subs.Events), func(a, b SubtitleEvent) int {
+			return cmp.Compare(a.Start, b.Start)
+		})
+		for _, e := range sorted {
+			if e.Start < 0 {
+				continue
+			}
+			events = append(events, inputEvent{SubtitleEvent: e, input: idx})
+		}
+	}
+	if header == "" {
+		return "", nil
+	}
+	return header, events
+}
+
+// newCSubtitleTrack allocates the C subtitle track. The track must be freed
+// after use.
+func newCSubtitleTrack(
+	codec SubtitleCodec,
+	header string,
+	events []inputEvent,
+) (track *C.subtitle_track, free func()) {
+	track = (*C.subtitle_track)(C.malloc(C.size_t(unsafe.Sizeof(C.subtitle_track{}))))
+	cEventsPtr := C.malloc(C.size_t(len(events)) * C.size_t(unsafe.Sizeof(C.subtitle_event{})))
+	cEvents := unsafe.Slice((*C.subtitle_event)(cEventsPtr), len(events))
+	cStrings := make([]*C.char, 0, len(events)+1)
+
+	switch codec {
+	case SubtitleCodecASS:
+		track.codec_id = C.int(C.AV_CODEC_ID_ASS)
+	case SubtitleCodecMovText:
+		track.codec_id = C.int(C.AV_CODEC_ID_MOV_TEXT)
+	}
+	cHeader := C.CString(header)
+	cStrings = append(cStrings, cHeader)
+	track.header = cHeader
+	track.events = (*C.subtitle_event)(cEventsPtr)
+	track.events_count = C.size_t(len(events))
+
+	for idx, e := range events {
+		// The ReadOrder is the index of the event in the track.
+		cDialogue := C.CString(fmt.Sprintf("%d,%s", idx, e.Dialogue))
+		cStrings = append(cStrings, cDialogue)
+		cEvents[idx] = C.subtitle_event{
+			input_idx: C.size_t(e.input),
+			start:     C.int64_t(e.Start.Milliseconds()),
+			end:       C.int64_t(e.End.Milliseconds()),
+			dialogue:  cDialogue,
+		}
+	}
+
+	return track, func() {
+		for _, s := range cStrings {
+			C.free(unsafe.Pointer(s))
+		}
+		C.free(cEventsPtr)
+		C.free(unsafe.Pointer(track))
+	}
+}
@@ -2,7 +2,11 @@ package concat
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/Darkness4/fc2-live-dl-go/video/probe"
 	"github.com/stretchr/testify/assert"
@@ -84,12 +88,55 @@ func TestFilterFiles(t *testing.T) {
 			},
 			title: "Positive test 2",
 		},
+		{
+			names: []string{
+				"name.mp4",
+				"name.1.ts",
+				"name.1.part.mp4",
+				"name.2.part.ts",
+				"name.combined.part.mp4",
+			},
+			base: "name",
+			path: ".",
+			options: []Option{
+				IgnoreExtension(),
+			},
+			expected: []string{
+				"name.mp4",
+				"name.1.ts",
+			},
+			title: "Ignore part files",
+		},
+		{
+			names: []string{
+				"name.mp4",
+				"name.10.mp4",
+				"name.2.mp4",
+			},
+			base: "name",
+			path: "/archive",
+			options: []Option{
+				IgnoreExtension(),
+			},
+			expected: []string{
+				"/archive/name.mp4",
+				"/archive/name.2.mp4",
+				"/archive/name.10.mp4",
+			},
+			title: "Sort by order in a directory",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			paths := make([]string, 0, len(tt.names))
+			for _, name := range tt.names {
+				paths = append(paths, filepath.Join(tt.path, name))
+			}
+
 			// Act
-			actual, err := filterFiles(tt.names, tt.base, tt.path, applyOptions(tt.options))
+			actual, err := filterFiles(paths, tt.base, applyOptions(tt.options))
 
 			// Assert
 			if tt.isError != nil {
@@ -110,3 +157,197 @@ func TestDo(t *testing.T) {
 	err = probe.Do([]string{"output.mp4"}, probe.WithQuiet())
 	require.NoError(t, err)
 }
+
+func TestDoWithSubtitles(t *testing.T) {
+	tests := []struct {
+		output string
+		title  string
+	}{
+		{
+			output: "output.subtitles.mkv",
+			title:  "ASS in MKV",
+		},
+		{
+			output: "output.subtitles.mp4",
+			title:  "Timed text in MP4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			loader := func(input string, codec SubtitleCodec) (*Subtitles, error) {
+				return &Subtitles{
+					Header: "[Script Info]\nScriptType: v4.00+\n\n" +
+						"[V4+ Styles]\nFormat: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+						"Style: Default,sans-serif,36,&H00FFFFFF,&H00FFFFFF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,1.5,0,2,0,0,0,1\n\n" +
+						"[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n",
+					Events: []SubtitleEvent{
+						{Start: 0, End: time.Second, Dialogue: "0,Default,,0,0,0,,hello"},
+						{Start: time.Second, End: 2 * time.Second, Dialogue: "0,Default,,0,0,0,,world"},
+					},
+				}, nil
+			}
+
+			// Act
+			err := Do(
+				context.Background(),
+				tt.output,
+				[]string{"input.mp4", "input.mp4"},
+				WithSubtitles(loader),
+			)
+
+			// Assert
+			require.NoError(t, err)
+			err = probe.Do([]string{tt.output}, probe.WithQuiet())
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestLoadSubtitles(t *testing.T) {
+	// Arrange
+	loader := func(input string, codec SubtitleCodec) (*Subtitles, error) {
+		switch input {
+		case "a.ts":
+			return &Subtitles{
+				Header: "header",
+				Events: []SubtitleEvent{
+					{Start: 2 * time.Second, End: 3 * time.Second, Dialogue: "b"},
+					{Start: time.Second, End: 2 * time.Second, Dialogue: "a"},
+				},
+			}, nil
+		case "b.ts":
+			return nil, nil
+		case "c.ts":
+			return nil, errors.New("broken")
+		}
+		return &Subtitles{
+			Header: "other",
+			Events: []SubtitleEvent{
+				{Start: -time.Second, End: 0, Dialogue: "dropped"},
+				{Start: 0, End: time.Second, Dialogue: "c"},
+			},
+		}, nil
+	}
+
+	// Act
+	header, events := loadSubtitles(
+		[]string{"a.ts", "b.ts", "c.ts", "d.ts"},
+		SubtitleCodecASS,
+		loader,
+	)
+
+	// Assert
+	require.Equal(t, "header", header)
+	require.Equal(t, []inputEvent{
+		{SubtitleEvent: SubtitleEvent{Start: time.Second, End: 2 * time.Second, Dialogue: "a"}, input: 0},
+		{SubtitleEvent: SubtitleEvent{Start: 2 * time.Second, End: 3 * time.Second, Dialogue: "b"}, input: 0},
+		{SubtitleEvent: SubtitleEvent{Start: 0, End: time.Second, Dialogue: "c"}, input: 3},
+	}, events)
+}
+
+func TestDoWithChapters(t *testing.T) {
+	tests := []struct {
+		output string
+		title  string
+	}{
+		{
+			output: "output.chapters.mkv",
+			title:  "Chapters in MKV",
+		},
+		{
+			output: "output.chapters.mp4",
+			title:  "Chapters in MP4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Arrange
+			loader := func(input string) ([]Chapter, error) {
+				return []Chapter{
+					{Start: 0, Title: "first"},
+					{Start: time.Second, Title: "second"},
+				}, nil
+			}
+
+			// Act
+			err := Do(
+				context.Background(),
+				tt.output,
+				[]string{"input.mp4", "input.mp4"},
+				WithChapters(loader),
+			)
+
+			// Assert
+			require.NoError(t, err)
+			err = probe.Do([]string{tt.output}, probe.WithQuiet())
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestLoadChapters(t *testing.T) {
+	// Arrange
+	loader := func(input string) ([]Chapter, error) {
+		switch input {
+		case "a.ts":
+			return []Chapter{
+				{Start: 2 * time.Second, Title: "b"},
+				{Start: time.Second, Title: "a"},
+				{Start: 3 * time.Second, Title: "b"},
+				{Start: -time.Second, Title: "a"},
+			}, nil
+		case "b.ts":
+			return nil, nil
+		}
+		return nil, errors.New("broken")
+	}
+
+	// Act
+	chapters := loadChapters([]string{"a.ts", "b.ts", "c.ts"}, loader)
+
+	// Assert
+	require.Equal(t, []inputChapter{
+		{Chapter: Chapter{Start: 0, Title: "a"}, input: 0},
+		{Chapter: Chapter{Start: 2 * time.Second, Title: "b"}, input: 0},
+		{Chapter: Chapter{Start: 0, Title: "Part 2"}, input: 1},
+		{Chapter: Chapter{Start: 0, Title: "Part 3"}, input: 2},
+	}, chapters)
+}
+
+func TestWithPrefixDirectories(t *testing.T) {
+	// Arrange
+	input, err := os.ReadFile("input.mp4")
+	require.NoError(t, err)
+	// The first recording was moved out of the scratch directory.
+	archive := t.TempDir()
+	scratch := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(archive, "name.mp4"), input, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(scratch, "name.1.mp4"), input, 0o644))
+	var inputs []string
+	loader := func(input string) ([]Chapter, error) {
+		inputs = append(inputs, input)
+		return nil, nil
+	}
+
+	// Act
+	err = WithPrefix(
+		context.Background(),
+		"mp4",
+		filepath.Join(scratch, "name"),
+		IgnoreExtension(),
+		WithChapters(loader),
+		WithDirectories(archive),
+	)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(archive, "name.mp4"),
+		filepath.Join(scratch, "name.1.mp4"),
+	}, inputs)
+	err = probe.Do([]string{filepath.Join(scratch, "name.combined.mp4")}, probe.WithQuiet())
+	require.NoError(t, err)
+}
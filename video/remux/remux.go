@@ -15,6 +15,17 @@ func WithAudioOnly() Option {
 	return Option(concat.WithAudioOnly())
 }
 
+// WithSubtitles muxes the subtitles of the input as a subtitle track, see
+// concat.WithSubtitles.
+func WithSubtitles(loader concat.SubtitleLoader) Option {
+	return Option(concat.WithSubtitles(loader))
+}
+
+// WithChapters adds the chapters of the input, see concat.WithChapters.
+func WithChapters(loader concat.ChapterLoader) Option {
+	return Option(concat.WithChapters(loader))
+}
+
 // Do remuxes the input file to the output file.
 func Do(ctx context.Context, output string, input string, opts ...Option) error {
 	o := make([]concat.Option, 0, len(opts))